@@ -2,6 +2,25 @@ GeneralChart.init();
 
 tstor.dashboard = {
   _cacheChart: new CacheChart("main-cache-chart", "Cache disk"),
+  loadHistory: function () {
+    var from = Math.floor(Date.now() / 1000) - 60 * 60;
+    fetch("/api/stats/history?from=" + from)
+      .then(function (response) {
+        if (response.ok) {
+          return response.json();
+        } else {
+          tstor.message.error(
+            "Error getting history from server. Response: " + response.status
+          );
+        }
+      })
+      .then(function (points) {
+        GeneralChart.load(points);
+      })
+      .catch(function (error) {
+        tstor.message.error("Error getting stats history: " + error.message);
+      });
+  },
   loadView: function () {
     fetch("/api/status")
       .then(function (response) {
@@ -18,6 +18,21 @@ var GeneralChart = {
         });
         this._chart.update();
     },
+    load: function (points) {
+        for (var i = 1; i < points.length; i++) {
+            var date = new Date(points[i].time);
+            var seconds = (date - new Date(points[i - 1].time)) / 1000;
+            this._downloadData.push({
+                x: date,
+                y: points[i].downloadedBytes / seconds,
+            });
+            this._uploadData.push({
+                x: date,
+                y: points[i].uploadedBytes / seconds,
+            });
+        }
+        this._chart.update();
+    },
     init: function () {
         var domElem = document.getElementById('chart-general-network')
         domElem.height = 300;
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
+
+const apiFlag = "api"
+
+var apiURLFlag = &cli.StringFlag{
+	Name:  apiFlag,
+	Value: "http://127.0.0.1:4444",
+	Usage: "Base URL of running tstor web UI.",
+}
+
+// apiRequest calls running tstor instance API and decodes JSON response into out if it is not nil.
+func apiRequest(c *cli.Context, method, path string, body, out any) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(c.Context, method, strings.TrimSuffix(c.String(apiFlag), "/")+path, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling tstor api: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		return fmt.Errorf("tstor api returned %s: %s", resp.Status, apiErr.Error)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+type verifyReport struct {
+	Hash            string `json:"hash"`
+	Name            string `json:"name"`
+	State           string `json:"state"`
+	TotalPieces     int    `json:"totalPieces"`
+	CheckedPieces   int    `json:"checkedPieces"`
+	CorruptedPieces []int  `json:"corruptedPieces"`
+}
+
+func verifyCommand(c *cli.Context) error {
+	hash := strings.ToLower(c.Args().First())
+	if c.Bool("all") {
+		if err := apiRequest(c, http.MethodPost, "/api/verify", nil, nil); err != nil {
+			return err
+		}
+	} else {
+		if c.NArg() != 1 {
+			return fmt.Errorf("torrent infohash or --all flag required")
+		}
+		if err := apiRequest(c, http.MethodPost, "/api/torrents/"+hash+"/verify", nil, nil); err != nil {
+			return err
+		}
+	}
+
+	for {
+		var reports []verifyReport
+		if err := apiRequest(c, http.MethodGet, "/api/verify", nil, &reports); err != nil {
+			return err
+		}
+
+		running := false
+		for _, r := range reports {
+			if !c.Bool("all") && r.Hash != hash {
+				continue
+			}
+			if r.State == "running" {
+				running = true
+				fmt.Printf("%s %s: %d/%d pieces checked\n", r.Hash, r.Name, r.CheckedPieces, r.TotalPieces)
+			}
+		}
+
+		if !running {
+			for _, r := range reports {
+				if !c.Bool("all") && r.Hash != hash {
+					continue
+				}
+				fmt.Printf("%s %s: %s, %d corrupted pieces %v\n", r.Hash, r.Name, r.State, len(r.CorruptedPieces), r.CorruptedPieces)
+			}
+			return nil
+		}
+
+		select {
+		case <-c.Context.Done():
+			return c.Context.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/urfave/cli/v2"
+)
+
+type dhtItem struct {
+	Target    string `json:"target"`
+	Value     string `json:"value"`
+	PublicKey string `json:"publicKey"`
+	Salt      string `json:"salt"`
+	Seq       int64  `json:"seq"`
+	Mutable   bool   `json:"mutable"`
+}
+
+type dhtKey struct {
+	Name      string `json:"name"`
+	PublicKey string `json:"publicKey"`
+}
+
+var saltFlag = &cli.StringFlag{
+	Name:  "salt",
+	Usage: "Salt of mutable item.",
+}
+
+var dhtCommand = &cli.Command{
+	Name:  "dht",
+	Usage: "Publish and fetch BEP44 items with DHT of running instance.",
+	Subcommands: []*cli.Command{
+		{
+			Name:      "put",
+			Usage:     "Publish an item, it is mutable when signed with a key.",
+			ArgsUsage: "<value>",
+			Flags: []cli.Flag{
+				apiURLFlag,
+				saltFlag,
+				&cli.StringFlag{
+					Name:  "key",
+					Usage: "Name of a key to sign mutable item.",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				if c.NArg() != 1 {
+					return fmt.Errorf("value required")
+				}
+
+				var item dhtItem
+				err := apiRequest(c, http.MethodPost, "/api/dht/items", map[string]string{
+					"value": c.Args().First(),
+					"key":   c.String("key"),
+					"salt":  c.String("salt"),
+				}, &item)
+				if err != nil {
+					return err
+				}
+
+				fmt.Printf("target: %s\n", item.Target)
+				if item.Mutable {
+					fmt.Printf("public key: %s\nseq: %d\n", item.PublicKey, item.Seq)
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "get",
+			Usage:     "Fetch an item by its target.",
+			ArgsUsage: "<target>",
+			Flags:     []cli.Flag{apiURLFlag, saltFlag},
+			Action: func(c *cli.Context) error {
+				if c.NArg() != 1 {
+					return fmt.Errorf("target required")
+				}
+
+				path := "/api/dht/items/" + c.Args().First()
+				if salt := c.String("salt"); salt != "" {
+					path += "?salt=" + url.QueryEscape(salt)
+				}
+
+				var item dhtItem
+				if err := apiRequest(c, http.MethodGet, path, nil, &item); err != nil {
+					return err
+				}
+
+				if item.Mutable {
+					fmt.Printf("seq: %d\n", item.Seq)
+				}
+				fmt.Println(item.Value)
+				return nil
+			},
+		},
+		{
+			Name:      "rm",
+			Usage:     "Delete an item from the local node store.",
+			ArgsUsage: "<target>",
+			Flags:     []cli.Flag{apiURLFlag},
+			Action: func(c *cli.Context) error {
+				if c.NArg() != 1 {
+					return fmt.Errorf("target required")
+				}
+				return apiRequest(c, http.MethodDelete, "/api/dht/items/"+c.Args().First(), nil, nil)
+			},
+		},
+		{
+			Name:  "keys",
+			Usage: "List keys for signing mutable items.",
+			Flags: []cli.Flag{apiURLFlag},
+			Action: func(c *cli.Context) error {
+				var keys []dhtKey
+				if err := apiRequest(c, http.MethodGet, "/api/dht/keys", nil, &keys); err != nil {
+					return err
+				}
+				for _, k := range keys {
+					fmt.Printf("%s %s\n", k.Name, k.PublicKey)
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "genkey",
+			Usage:     "Generate a new key for signing mutable items.",
+			ArgsUsage: "<name>",
+			Flags:     []cli.Flag{apiURLFlag},
+			Action: func(c *cli.Context) error {
+				if c.NArg() != 1 {
+					return fmt.Errorf("key name required")
+				}
+
+				var key dhtKey
+				err := apiRequest(c, http.MethodPost, "/api/dht/keys", map[string]string{"name": c.Args().First()}, &key)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("%s %s\n", key.Name, key.PublicKey)
+				return nil
+			},
+		},
+		{
+			Name:      "delkey",
+			Usage:     "Delete a key.",
+			ArgsUsage: "<name>",
+			Flags:     []cli.Flag{apiURLFlag},
+			Action: func(c *cli.Context) error {
+				if c.NArg() != 1 {
+					return fmt.Errorf("key name required")
+				}
+				return apiRequest(c, http.MethodDelete, "/api/dht/keys/"+c.Args().First(), nil, nil)
+			},
+		},
+	},
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/urfave/cli/v2"
+)
+
+type importResult struct {
+	InfoHash    string   `json:"infohash"`
+	Name        string   `json:"name"`
+	TorrentFile string   `json:"torrentFile"`
+	Pieces      int      `json:"pieces"`
+	Verified    int      `json:"verified"`
+	Files       int      `json:"files"`
+	Imported    int      `json:"imported"`
+	Skipped     []string `json:"skipped"`
+}
+
+var importCommand = &cli.Command{
+	Name:      "import",
+	Usage:     "Import data downloaded by another client into storage of running instance.",
+	ArgsUsage: "<directory>",
+	Flags: []cli.Flag{
+		apiURLFlag,
+		&cli.StringFlag{
+			Name:  "torrent",
+			Usage: "Path to torrent file of the data.",
+		},
+		&cli.StringFlag{
+			Name:  "magnet",
+			Usage: "Magnet URI of the data, metainfo is fetched from peers.",
+		},
+		&cli.StringFlag{
+			Name:  "mode",
+			Value: "copy",
+			Usage: "How data is placed into storage: copy, hardlink or reflink.",
+		},
+	},
+	Action: func(c *cli.Context) error {
+		if c.NArg() != 1 {
+			return fmt.Errorf("data directory required")
+		}
+		if c.String("torrent") == "" && c.String("magnet") == "" {
+			return fmt.Errorf("--torrent or --magnet flag required")
+		}
+
+		// directory is resolved by running instance
+		dir, err := filepath.Abs(c.Args().First())
+		if err != nil {
+			return err
+		}
+
+		body := map[string]any{
+			"dir":    dir,
+			"mode":   c.String("mode"),
+			"magnet": c.String("magnet"),
+		}
+		if p := c.String("torrent"); p != "" {
+			data, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			body["torrent"] = data
+		}
+
+		var res importResult
+		if err := apiRequest(c, http.MethodPost, "/api/import", body, &res); err != nil {
+			return err
+		}
+
+		fmt.Printf("%s %s: verified %d/%d pieces, imported %d/%d files\n", res.InfoHash, res.Name, res.Verified, res.Pieces, res.Imported, res.Files)
+		for _, f := range res.Skipped {
+			fmt.Printf("skipped %s\n", f)
+		}
+		fmt.Printf("torrent file saved to %s\n", res.TorrentFile)
+		return nil
+	},
+}
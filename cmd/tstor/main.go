@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 
 	"net"
@@ -9,6 +10,7 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"sync"
 	"syscall"
 	"time"
 
@@ -51,6 +53,24 @@ func main() {
 			return run(c.String(configFlag))
 		},
 
+		Commands: []*cli.Command{
+			{
+				Name:      "verify",
+				Usage:     "Verify stored data of a torrent in running instance.",
+				ArgsUsage: "[infohash]",
+				Flags: []cli.Flag{
+					apiURLFlag,
+					&cli.BoolFlag{
+						Name:  "all",
+						Usage: "Verify all torrents.",
+					},
+				},
+				Action: verifyCommand,
+			},
+			dhtCommand,
+			importCommand,
+		},
+
 		HideHelpCommand: true,
 	}
 
@@ -77,7 +97,7 @@ func run(configPath string) error {
 		return fmt.Errorf("error creating metadata folder: %w", err)
 	}
 
-	fis, err := storage.NewFileItemStore(filepath.Join(conf.TorrentClient.MetadataFolder, "items"), 2*time.Hour)
+	fis, err := storage.NewFileItemStore(filepath.Join(conf.TorrentClient.MetadataFolder, "items"), time.Duration(conf.TorrentClient.DHTItemsExpiry)*time.Minute)
 	if err != nil {
 		return fmt.Errorf("error starting item store: %w", err)
 	}
@@ -99,19 +119,90 @@ func run(configPath string) error {
 		return err
 	}
 
-	c, err := storage.NewClient(st, fis, &conf.TorrentClient, id)
+	ipFilter, err := storage.NewIPFilter(filepath.Join(conf.TorrentClient.MetadataFolder, "banned-ips"), conf.TorrentClient.Blocklist)
+	if err != nil {
+		return fmt.Errorf("error loading banned peers: %w", err)
+	}
+
+	c, err := storage.NewClient(st, fis, ipFilter, &conf.TorrentClient, id)
 	if err != nil {
 		return fmt.Errorf("error starting torrent client: %w", err)
 	}
 	c.AddDhtNodes(conf.TorrentClient.DHTNodes)
 	defer c.Close()
 
-	ts := service.NewService(c, rep, conf.TorrentClient.AddTimeout, conf.TorrentClient.ReadTimeout)
+	// stats history and export jobs need ordered key iteration, which gokv store of torrents metadata
+	// doesn't provide, so like piece completion and DHT items they are kept in their own badger databases
+	history, err := storage.NewStatsHistory(filepath.Join(conf.TorrentClient.MetadataFolder, "stats-history"))
+	if err != nil {
+		return fmt.Errorf("error opening stats history: %w", err)
+	}
+	defer history.Close()
+
+	dhtKeys, err := storage.NewDHTKeys(filepath.Join(conf.TorrentClient.MetadataFolder, "dht-keys"))
+	if err != nil {
+		return fmt.Errorf("error opening dht keys: %w", err)
+	}
+
+	exports, err := storage.NewExportJobs(filepath.Join(conf.TorrentClient.MetadataFolder, "exports"))
+	if err != nil {
+		return fmt.Errorf("error opening export jobs: %w", err)
+	}
+	defer exports.Close()
+
+	ts := service.NewService(c, rep, history, ipFilter, fis, dhtKeys, exports, st, &conf.TorrentClient)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// background jobs are stopped before the client and the stores they use are closed
+	var jobs sync.WaitGroup
+	run := func(job func()) {
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			job()
+		}()
+	}
+	defer func() {
+		cancel()
+		jobs.Wait()
+		ts.Stats().SaveHistory()
+	}()
+
+	run(func() { ts.Stats().RunHistory(ctx) })
+	run(func() { ts.RunSeeding(ctx) })
+	run(func() { ts.RunQueue(ctx) })
+
+	if conf.TorrentClient.Scrub.Enabled {
+		run(func() {
+			ts.RunScrub(ctx, time.Duration(conf.TorrentClient.Scrub.Interval)*time.Hour, conf.TorrentClient.Scrub.BytesPerSecond)
+		})
+	}
+
+	if conf.TorrentClient.Dedup.Enabled {
+		if _, ok := st.(storage.Deduplicator); !ok {
+			log.Warn().Str("storage", conf.TorrentClient.Storage).Msg("dedup is not supported by storage, it is disabled")
+		} else {
+			run(func() { ts.RunDedup(ctx, time.Duration(conf.TorrentClient.Dedup.Interval)*time.Minute) })
+		}
+	}
 
 	if err := os.MkdirAll(conf.DataFolder, 0744); err != nil {
 		return fmt.Errorf("error creating data folder: %w", err)
 	}
-	cfs := host.NewStorage(conf.DataFolder, ts)
+	cfs := host.NewStorage(conf.DataFolder, conf.Searches, ts)
+	run(func() { ts.RunLifecycle(ctx, cfs, time.Duration(conf.TorrentClient.IdleTimeout)*time.Minute) })
+	if conf.Watch.Enabled {
+		run(func() { ts.RunWatch(ctx, cfs, conf.DataFolder, conf.Watch.Pin) })
+	}
+
+	// export folder is created by the first export
+	run(func() { ts.RunExports(ctx, cfs, conf.Export.TargetDir) })
+
+	if len(conf.Feeds) > 0 {
+		run(func() { ts.RunFeeds(ctx, conf.Feeds, conf.DataFolder) })
+	}
 
 	if conf.Mounts.Fuse.Enabled {
 		mh := fuse.NewHandler(conf.Mounts.Fuse.AllowOther, conf.Mounts.Fuse.Path)
@@ -133,8 +224,8 @@ func run(configPath string) error {
 	}
 	if conf.Mounts.HttpFs.Enabled {
 		go func() {
-			httpfs := httpfs.NewHTTPFS(cfs)
-			err = nethttp.ListenAndServe(fmt.Sprintf("0.0.0.0:%d", conf.Mounts.HttpFs.Port), nethttp.FileServer(httpfs))
+			hfs := httpfs.NewHTTPFS(cfs)
+			err = nethttp.ListenAndServe(fmt.Sprintf("0.0.0.0:%d", conf.Mounts.HttpFs.Port), httpfs.TimeoutHandler(cfs, nethttp.FileServer(hfs)))
 			if err != nil {
 				log.Error().Err(err).Msg("error starting HTTPFS")
 			}
@@ -176,7 +267,7 @@ func run(configPath string) error {
 	go func() {
 		logFilename := filepath.Join(conf.Log.Path, dlog.FileName)
 
-		err = http.New(nil, service.NewStats(), ts, logFilename, conf)
+		err = http.New(nil, ts.Stats(), ts, logFilename, conf)
 		log.Error().Err(err).Msg("error initializing HTTP server")
 	}()
 
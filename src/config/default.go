@@ -2,6 +2,9 @@ package config
 
 var defaultConfig = Config{
 	DataFolder: "./data",
+	Export: Export{
+		TargetDir: "./export",
+	},
 	WebUi: WebUi{
 		Port: 4444,
 		IP:   "0.0.0.0",
@@ -30,11 +33,44 @@ var defaultConfig = Config{
 		DataFolder:     "./torrent/data",
 		MetadataFolder: "./torrent/metadata",
 		DHTNodes:       []string{},
+		DHTItemsExpiry: 2 * 60,
+		Storage:        "mmap",
+		FilesLayout:    "name-hash",
+
+		Network: Network{
+			ListenPort:      42069,
+			Encryption:      "prefer",
+			ConnsPerTorrent: 50,
+		},
 
 		// GlobalCacheSize: 2048,
 
 		AddTimeout:  60,
 		ReadTimeout: 120,
+
+		Dedup: Dedup{
+			Enabled:  false,
+			Interval: 60,
+		},
+
+		Prefetch: []Prefetch{
+			{
+				Extensions: []string{".mp4", ".m4v", ".mov", ".mkv", ".webm", ".avi"},
+				Head:       1024,
+				Tail:       1024,
+			},
+			{
+				Extensions: []string{".zip", ".7z", ".rar"},
+				Head:       64,
+				Tail:       1024,
+			},
+		},
+
+		Scrub: Scrub{
+			Enabled:        false,
+			Interval:       24 * 7,
+			BytesPerSecond: 10 * 1024 * 1024,
+		},
 	},
 
 	Log: Log{
@@ -8,6 +8,45 @@ type Config struct {
 	Log           Log           `koanf:"log"`
 
 	DataFolder string `koanf:"dataFolder"`
+	// Searches are listed in /.views/search/<name> directories
+	Searches []SavedSearch `koanf:"searches"`
+	Export   Export        `koanf:"export"`
+	Watch    Watch         `koanf:"watch"`
+	Feeds    []Feed        `koanf:"feeds"`
+}
+
+// Feed is an RSS or Atom feed polled for torrents, matching ones are saved into data folder
+type Feed struct {
+	Name string `koanf:"name"`
+	URL  string `koanf:"url"`
+	// Interval in minutes between polls, 15 is used if not set
+	Interval int `koanf:"interval"`
+	// Include and Exclude are regular expressions matched against item titles,
+	// item is added if it matches any include expression and none of exclude ones
+	Include []string `koanf:"include"`
+	Exclude []string `koanf:"exclude"`
+	// Dir is a data folder subdirectory torrent files are saved to, feeds/<name> is used if not set
+	Dir string `koanf:"dir"`
+}
+
+// Watch configures watching of data folder for torrent files
+type Watch struct {
+	// Enabled loads torrent files as soon as they appear in data folder instead of on first access, disabled by default
+	Enabled bool `koanf:"enabled"`
+	// Pin pins loaded torrents, so they are not unloaded when idle
+	Pin bool `koanf:"pin"`
+}
+
+// Export configures export of files out of filesystem
+type Export struct {
+	// TargetDir is a directory files are exported to
+	TargetDir string `koanf:"target_dir"`
+}
+
+// SavedSearch is a filename search query, see /api/search for query syntax
+type SavedSearch struct {
+	Name  string `koanf:"name"`
+	Query string `koanf:"query"`
 }
 
 type WebUi struct {
@@ -24,21 +63,116 @@ type Log struct {
 }
 
 type TorrentClient struct {
+	// ReadTimeout in seconds is a default of FirstByteTimeout and StallTimeout
 	ReadTimeout int `koanf:"read_timeout,omitempty"`
-	AddTimeout  int `koanf:"add_timeout,omitempty"`
+	// AddTimeout in seconds to wait for metadata of added magnets, it is a default of MetadataTimeout
+	AddTimeout int `koanf:"add_timeout,omitempty"`
+	// MetadataTimeout in seconds to wait for torrent info when torrent is opened
+	MetadataTimeout int `koanf:"metadata_timeout,omitempty"`
+	// FirstByteTimeout in seconds to wait for the first data of a read
+	FirstByteTimeout int `koanf:"first_byte_timeout,omitempty"`
+	// StallTimeout in seconds to wait for more data of a started read
+	StallTimeout int `koanf:"stall_timeout,omitempty"`
+	// IdleTimeout in minutes after which not accessed torrent is unloaded, 0 disables unloading
+	IdleTimeout int `koanf:"idle_timeout,omitempty"`
+	// MaxActiveDownloads limits number of torrents downloading at the same time, 0 means unlimited
+	MaxActiveDownloads int `koanf:"max_active_downloads,omitempty"`
 
 	DHTNodes    []string `koanf:"dhtnodes,omitempty"`
 	DisableIPv6 bool     `koanf:"disable_ipv6,omitempty"`
+	Network     Network  `koanf:"network"`
+	// Blocklist is a path to a file or a directory of files with P2P or CIDR formatted address lists to block
+	Blocklist string `koanf:"blocklist,omitempty"`
+	// DHTItemsExpiry in minutes after which stored BEP44 items are removed, must be positive
+	DHTItemsExpiry int `koanf:"dht_items_expiry,omitempty"`
 
 	DataFolder     string `koanf:"data_folder,omitempty"`
 	MetadataFolder string `koanf:"metadata_folder,omitempty"`
+	// Storage of torrent data: mmap stores pieces in a single file per torrent,
+	// files stores torrent files as is and allows deduplication of files shared between torrents
+	Storage string `koanf:"storage,omitempty"`
+	// FilesLayout of files storage directories: name-hash, infohash or name.
+	// Data stored with name layout is moved when layout is changed.
+	FilesLayout string `koanf:"files_layout,omitempty"`
+	Dedup       Dedup  `koanf:"dedup"`
 
 	// GlobalCacheSize int64 `koanf:"global_cache_size,omitempty"`
 
+	Scrub   Scrub   `koanf:"scrub"`
+	Seeding Seeding `koanf:"seeding"`
+	// Prefetch rules are applied to files of added torrents, first rule matching file is used
+	Prefetch []Prefetch `koanf:"prefetch"`
+	// Categories configure torrents by category assigned to them
+	Categories []Category `koanf:"categories"`
+
 	Routes  []Route  `koanf:"routes"`
 	Servers []Server `koanf:"servers"`
 }
 
+// Network configures peer connections of torrent client
+type Network struct {
+	// ListenHost is an address to accept peer connections on, empty means all interfaces
+	ListenHost string `koanf:"listen_host"`
+	// ListenPort for peer connections, 0 selects a random free port
+	ListenPort int `koanf:"listen_port"`
+	// Proxy is an URL of http, https or socks5 proxy used only for HTTP and websocket trackers and web seeds,
+	// peer connections, UDP trackers and DHT aren't proxied
+	Proxy string `koanf:"proxy"`
+	// Encryption is a peer protocol encryption policy: prefer, require, allow or disable
+	Encryption string `koanf:"encryption"`
+	DisableUTP bool   `koanf:"disable_utp"`
+	DisableTCP bool   `koanf:"disable_tcp"`
+	// ConnsPerTorrent limits established peer connections per torrent, it isn't a limit of upload
+	// slots, but client uploads to every connected interested peer, so it bounds peers served at once
+	ConnsPerTorrent int `koanf:"conns_per_torrent"`
+}
+
+// Prefetch prioritizes start and end of files, where media containers and archives keep
+// their headers and indexes, e.g. MP4 moov atom, MKV cues or zip central directory
+type Prefetch struct {
+	// Extensions of matched files, all files are matched if empty
+	Extensions []string `koanf:"extensions"`
+	// Head and Tail sizes in KiB downloaded with high priority
+	Head int `koanf:"head"`
+	Tail int `koanf:"tail"`
+}
+
+// Scrub configures periodic background verification of stored torrent data
+type Scrub struct {
+	Enabled bool `koanf:"enabled"`
+	// Interval between scrub runs in hours, must be positive
+	Interval int `koanf:"interval"`
+	// BytesPerSecond limits disk read rate of scrubbing, 0 means unlimited
+	BytesPerSecond int64 `koanf:"bytes_per_second"`
+}
+
+// Dedup configures periodic linking of files duplicated across torrents, requires files storage
+type Dedup struct {
+	Enabled bool `koanf:"enabled"`
+	// Interval between dedup runs in minutes, must be positive
+	Interval int `koanf:"interval"`
+}
+
+// Seeding is a seeding policy of complete torrents. It is configured globally and per category
+// and can be overridden per torrent, json tags are used by stored and API policies.
+type Seeding struct {
+	// Ratio of uploaded to downloaded bytes to stop seeding at, 0 means unlimited
+	Ratio float64 `koanf:"ratio" json:"ratio"`
+	// SeedTime in minutes to stop seeding after, 0 means unlimited
+	SeedTime int `koanf:"seed_time" json:"seedTime"`
+	// PinnedOnly allows seeding only of pinned torrents
+	PinnedOnly bool `koanf:"pinned_only" json:"pinnedOnly"`
+}
+
+// Category configures torrents with the category
+type Category struct {
+	Name string `koanf:"name"`
+	// Priority in download queue, torrents with higher priority are queued before others
+	Priority int `koanf:"priority"`
+	// Seeding policy of torrents with the category, global policy is used if not set
+	Seeding *Seeding `koanf:"seeding"`
+}
+
 type Route struct {
 	Name          string    `koanf:"name"`
 	Torrents      []Torrent `koanf:"torrents"`
@@ -40,7 +40,7 @@ func (fs *fuseFS) Open(path string, flags int) (errc int, fh uint64) {
 	}
 	if err != nil {
 		fs.log.Error().Err(err).Str("path", path).Msg("error opening file")
-		return -fuse.EIO, fhNone
+		return errno(err, -fuse.EIO), fhNone
 	}
 
 	return 0, fh
@@ -70,7 +70,10 @@ func (fs *fuseFS) Getattr(path string, stat *fuse.Stat_t, fh uint64) (errc int)
 	}
 	if err != nil {
 		fs.log.Error().Err(err).Str("path", path).Msg("error getting holder when reading file attributes")
-		return -fuse.EIO
+		return errno(err, -fuse.EIO)
+	}
+	if fh == fhNone {
+		defer file.Close()
 	}
 
 	if file.IsDir() {
@@ -92,7 +95,10 @@ func (fs *fuseFS) Read(path string, dest []byte, off int64, fh uint64) int {
 	}
 	if err != nil {
 		fs.log.Error().Err(err).Str("path", path).Msg("error getting holder reading data from file")
-		return -fuse.EIO
+		return errno(err, -fuse.EIO)
+	}
+	if fh == fhNone {
+		defer file.Close()
 	}
 
 	end := int(math.Min(float64(len(dest)), float64(int64(file.Size())-off)))
@@ -105,7 +111,7 @@ func (fs *fuseFS) Read(path string, dest []byte, off int64, fh uint64) int {
 	n, err := file.ReadAt(buf, off)
 	if err != nil && err != io.EOF {
 		log.Error().Err(err).Str("path", path).Msg("error reading data")
-		return -fuse.EIO
+		return errno(err, -fuse.EIO)
 	}
 
 	dest = buf[:n]
@@ -136,7 +142,7 @@ func (fs *fuseFS) Readdir(path string,
 	paths, err := fs.fh.ListDir(path)
 	if err != nil {
 		fs.log.Error().Err(err).Str("path", path).Msg("error reading directory")
-		return -fuse.ENOSYS
+		return errno(err, -fuse.ENOSYS)
 	}
 
 	for _, p := range paths {
@@ -149,6 +155,14 @@ func (fs *fuseFS) Readdir(path string,
 	return 0
 }
 
+// errno reports read timeouts as ETIMEDOUT, so applications can retry, other errors are reported as errc
+func errno(err error, errc int) int {
+	if errors.Is(err, vfs.ErrReadTimeout) {
+		return -fuse.ETIMEDOUT
+	}
+	return errc
+}
+
 const fhNone = ^uint64(0)
 
 var ErrHolderEmpty = errors.New("file holder is empty")
@@ -160,6 +174,7 @@ type fileHandler struct {
 	fs     vfs.Filesystem
 }
 
+// GetFile returns file of open holder, file is opened if holder is fhNone and must be closed by caller
 func (fh *fileHandler) GetFile(path string, fhi uint64) (vfs.File, error) {
 	fh.mu.RLock()
 	defer fh.mu.RUnlock()
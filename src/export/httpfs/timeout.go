@@ -0,0 +1,101 @@
+package httpfs
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.kmsign.ru/royalcat/tstor/src/host/vfs"
+)
+
+// retryAfter is suggested to clients when torrent data isn't received in time
+const retryAfter = 10 * time.Second
+
+// TimeoutHandler checks requested file is available before next handler starts responding,
+// so read timeouts are reported with 503 Service Unavailable when torrent metadata isn't received
+// and 504 Gateway Timeout when file data isn't received, both with Retry-After header.
+// Timeouts after response is started abort it.
+func TimeoutHandler(fs vfs.Filesystem, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var terr *vfs.TimeoutError
+		if err := checkAvailable(fs, r); errors.As(err, &terr) {
+			writeTimeout(w, terr)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkAvailable stats requested file and reads the first requested byte of GET requests,
+// other errors are left to next handler
+func checkAvailable(fs vfs.Filesystem, r *http.Request) error {
+	if r.Method == http.MethodOptions {
+		return nil
+	}
+
+	name := path.Clean("/" + r.URL.Path)
+	info, err := fs.Stat(name)
+	if err != nil || info.IsDir() || r.Method != http.MethodGet {
+		return err
+	}
+
+	off := rangeStart(r.Header.Get("Range"), info.Size())
+	if off >= info.Size() {
+		return nil
+	}
+
+	f, err := fs.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.ReadAt(make([]byte, 1), off)
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
+
+// rangeStart returns offset of the first range of Range header, 0 if header is missing or invalid
+func rangeStart(header string, size int64) int64 {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return 0
+	}
+	spec, _, _ = strings.Cut(spec, ",")
+	start, end, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0
+	}
+
+	if start == "" {
+		// suffix range is a number of last bytes
+		n, err := strconv.ParseInt(end, 10, 64)
+		if err != nil || n <= 0 {
+			return 0
+		}
+		return max(size-n, 0)
+	}
+
+	off, err := strconv.ParseInt(start, 10, 64)
+	if err != nil || off < 0 {
+		return 0
+	}
+	return off
+}
+
+func writeTimeout(w http.ResponseWriter, err *vfs.TimeoutError) {
+	code := http.StatusGatewayTimeout
+	if err.Op == vfs.TimeoutMetadata {
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter/time.Second)))
+	http.Error(w, err.Error(), code)
+}
@@ -0,0 +1,82 @@
+package httpfs
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"git.kmsign.ru/royalcat/tstor/src/host/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+// slowFs times out on metadata of /pending and on data of /slow
+type slowFs struct {
+	*vfs.MemoryFs
+}
+
+func (s *slowFs) Stat(name string) (fs.FileInfo, error) {
+	if name == "/pending" {
+		return nil, &vfs.TimeoutError{Op: vfs.TimeoutMetadata, Timeout: time.Second}
+	}
+	return s.MemoryFs.Stat(name)
+}
+
+func (s *slowFs) Open(name string) (vfs.File, error) {
+	f, err := s.MemoryFs.Open(name)
+	if err != nil || name != "/slow" {
+		return f, err
+	}
+	return &slowFile{File: f}, nil
+}
+
+type slowFile struct {
+	vfs.File
+}
+
+func (f *slowFile) ReadAt(p []byte, off int64) (int, error) {
+	return 0, &vfs.TimeoutError{Op: vfs.TimeoutFirstByte, Timeout: time.Second}
+}
+
+func TestTimeoutHandler(t *testing.T) {
+	require := require.New(t)
+
+	mfs := vfs.NewMemoryFS(map[string]*vfs.MemoryFile{
+		"/ok":   vfs.NewMemoryFile("ok", []byte("data")),
+		"/slow": vfs.NewMemoryFile("slow", []byte("data")),
+	})
+	sfs := &slowFs{MemoryFs: mfs}
+	h := TimeoutHandler(sfs, http.FileServer(NewHTTPFS(sfs)))
+
+	get := func(path, rangeHeader string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/ok", "")
+	require.Equal(http.StatusOK, w.Code)
+	require.Equal("data", w.Body.String())
+
+	w = get("/slow", "")
+	require.Equal(http.StatusGatewayTimeout, w.Code)
+	require.Equal("10", w.Header().Get("Retry-After"))
+
+	w = get("/pending", "")
+	require.Equal(http.StatusServiceUnavailable, w.Code)
+	require.Equal("10", w.Header().Get("Retry-After"))
+
+	// range after end of file isn't read
+	w = get("/slow", "bytes=10-")
+	require.Equal(http.StatusRequestedRangeNotSatisfiable, w.Code)
+
+	require.Equal(int64(2), rangeStart("bytes=2-3", 4))
+	require.Equal(int64(1), rangeStart("bytes=-3", 4))
+	require.Equal(int64(0), rangeStart("bytes=-10", 4))
+	require.Equal(int64(0), rangeStart("items=1-2", 4))
+}
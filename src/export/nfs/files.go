@@ -0,0 +1,113 @@
+package nfs
+
+import (
+	"sync"
+	"time"
+
+	"git.kmsign.ru/royalcat/tstor/src/host/vfs"
+)
+
+// fileIdleTimeout is a time after which a shared file handle not used by NFS calls is closed
+const fileIdleTimeout = time.Minute
+
+// openFiles shares a single handle of a file between NFS calls. go-nfs opens a file for every READ call
+// and never closes it, so shared handles are closed when they aren't used for idleTimeout.
+type openFiles struct {
+	fs          vfs.Filesystem
+	idleTimeout time.Duration
+
+	mu    sync.Mutex
+	files map[string]*sharedFile
+}
+
+func newOpenFiles(fs vfs.Filesystem, idleTimeout time.Duration) *openFiles {
+	return &openFiles{
+		fs:          fs,
+		idleTimeout: idleTimeout,
+		files:       map[string]*sharedFile{},
+	}
+}
+
+// sharedFile is an open file used by NFS calls, its fields except file are protected by openFiles.mu
+type sharedFile struct {
+	file vfs.File
+
+	// reads is a number of running reads
+	reads    int
+	lastUsed time.Time
+	timer    *time.Timer
+}
+
+// open returns shared handle of the file, it's opened if there is none
+func (o *openFiles) open(name string) (*sharedFile, error) {
+	key := vfs.AbsPath(name)
+
+	o.mu.Lock()
+	if f, ok := o.files[key]; ok {
+		f.lastUsed = time.Now()
+		o.mu.Unlock()
+		return f, nil
+	}
+	o.mu.Unlock()
+
+	// opening may wait for torrent info, it's done without lock
+	file, err := o.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if f, ok := o.files[key]; ok {
+		// opened concurrently
+		f.lastUsed = time.Now()
+		_ = file.Close()
+		return f, nil
+	}
+
+	f := &sharedFile{
+		file:     file,
+		lastUsed: time.Now(),
+	}
+	f.timer = time.AfterFunc(o.idleTimeout, func() { o.expire(key, f) })
+	o.files[key] = f
+	return f, nil
+}
+
+// expire closes the file if it's not used for idleTimeout
+func (o *openFiles) expire(key string, f *sharedFile) {
+	o.mu.Lock()
+	if o.files[key] != f {
+		o.mu.Unlock()
+		return
+	}
+	if f.reads > 0 {
+		f.timer.Reset(o.idleTimeout)
+		o.mu.Unlock()
+		return
+	}
+	if idle := time.Since(f.lastUsed); idle < o.idleTimeout {
+		f.timer.Reset(o.idleTimeout - idle)
+		o.mu.Unlock()
+		return
+	}
+	delete(o.files, key)
+	o.mu.Unlock()
+
+	_ = f.file.Close()
+}
+
+// use marks the file as used by a read until returned function is called
+func (o *openFiles) use(f *sharedFile) func() {
+	o.mu.Lock()
+	f.reads++
+	o.mu.Unlock()
+
+	return func() {
+		o.mu.Lock()
+		f.reads--
+		f.lastUsed = time.Now()
+		o.mu.Unlock()
+	}
+}
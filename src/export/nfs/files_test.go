@@ -0,0 +1,91 @@
+package nfs
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"git.kmsign.ru/royalcat/tstor/src/host/vfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingFs counts open handles of its files
+type countingFs struct {
+	*vfs.MemoryFs
+	opened atomic.Int64
+}
+
+func (c *countingFs) Open(name string) (vfs.File, error) {
+	f, err := c.MemoryFs.Open(vfs.AbsPath(name))
+	if err != nil {
+		return nil, err
+	}
+	c.opened.Add(1)
+	return &countingFile{File: f, fs: c}, nil
+}
+
+type countingFile struct {
+	vfs.File
+	fs     *countingFs
+	closed atomic.Bool
+}
+
+func (f *countingFile) Close() error {
+	if f.closed.CompareAndSwap(false, true) {
+		f.fs.opened.Add(-1)
+	}
+	return nil
+}
+
+func TestBillyFsSharedFiles(t *testing.T) {
+	require := require.New(t)
+
+	cfs := &countingFs{MemoryFs: vfs.NewMemoryFS(map[string]*vfs.MemoryFile{
+		"/a": vfs.NewMemoryFile("a", []byte("data a")),
+		"/b": vfs.NewMemoryFile("b", []byte("data b")),
+	})}
+	bfs := &billyFsWrapper{fs: cfs, files: newOpenFiles(cfs, 100*time.Millisecond)}
+
+	// go-nfs opens file for every read and never closes it
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			f, err := bfs.Open(name)
+			if !assert.NoError(t, err) {
+				return
+			}
+			buf := make([]byte, 4)
+			_, err = f.ReadAt(buf, 0)
+			assert.NoError(t, err)
+		}([]string{"a", "/b"}[i%2])
+	}
+	wg.Wait()
+	require.Equal(int64(2), cfs.opened.Load())
+
+	// used file is kept open
+	for i := 0; i < 5; i++ {
+		time.Sleep(50 * time.Millisecond)
+		f, err := bfs.Open("a")
+		require.NoError(err)
+		_, err = f.ReadAt(make([]byte, 4), 0)
+		require.NoError(err)
+	}
+	require.Equal(int64(1), cfs.opened.Load())
+
+	// idle files are closed
+	require.Eventually(func() bool {
+		return cfs.opened.Load() == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	f, err := bfs.Open("/a")
+	require.NoError(err)
+	buf := make([]byte, 6)
+	_, err = f.ReadAt(buf, 0)
+	require.NoError(err)
+	require.Equal("data a", string(buf))
+	require.Equal(int64(1), cfs.opened.Load())
+}
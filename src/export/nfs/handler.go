@@ -7,10 +7,10 @@ import (
 )
 
 func NewNFSv3Handler(fs vfs.Filesystem) (nfs.Handler, error) {
-	bfs := &billyFsWrapper{fs: fs}
+	bfs := newBillyFsWrapper(fs)
 	handler := nfshelper.NewNullAuthHandler(bfs)
 	cacheHelper := nfshelper.NewCachingHandler(handler, 1024*16)
 	//  cacheHelper := NewCachingHandler(handler)
 
-	return cacheHelper, nil
+	return timeoutHandler{Handler: cacheHelper}, nil
 }
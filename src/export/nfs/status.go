@@ -0,0 +1,26 @@
+package nfs
+
+import (
+	"errors"
+
+	"git.kmsign.ru/royalcat/tstor/src/host/vfs"
+	nfs "github.com/willscott/go-nfs"
+)
+
+// timeoutHandler reports read timeouts as NFS3ERR_JUKEBOX, so clients retry the call later.
+// go-nfs procedure handlers report filesystem errors of reads and stats with their own status,
+// so the status of NFSStatusError returned by billy filesystem is lost without it.
+type timeoutHandler struct {
+	nfs.Handler
+}
+
+var _ nfs.ErrorMapper = timeoutHandler{}
+
+// MapError implements nfs.ErrorMapper.
+func (timeoutHandler) MapError(err error) error {
+	var serr *nfs.NFSStatusError
+	if errors.Is(err, vfs.ErrReadTimeout) && errors.As(err, &serr) && serr.NFSStatus != nfs.NFSStatusJukebox {
+		return &nfs.NFSStatusError{NFSStatus: nfs.NFSStatusJukebox, WrappedErr: err}
+	}
+	return err
+}
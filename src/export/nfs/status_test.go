@@ -0,0 +1,113 @@
+package nfs
+
+import (
+	"io"
+	"io/fs"
+	"net"
+	"testing"
+	"time"
+
+	"git.kmsign.ru/royalcat/tstor/src/host/vfs"
+	"github.com/stretchr/testify/require"
+	wnfs "github.com/willscott/go-nfs"
+	nfsc "github.com/willscott/go-nfs-client/nfs"
+	"github.com/willscott/go-nfs-client/nfs/rpc"
+	"github.com/willscott/go-nfs-client/nfs/xdr"
+)
+
+// slowFs times out on data of /slow and on metadata of /pending, go-nfs uses relative paths
+type slowFs struct {
+	*vfs.MemoryFs
+}
+
+func (s *slowFs) Stat(name string) (fs.FileInfo, error) {
+	name = vfs.AbsPath(name)
+	if name == "/pending" {
+		return nil, &vfs.TimeoutError{Op: vfs.TimeoutMetadata, Timeout: time.Second}
+	}
+	return s.MemoryFs.Stat(name)
+}
+
+func (s *slowFs) Open(name string) (vfs.File, error) {
+	name = vfs.AbsPath(name)
+	f, err := s.MemoryFs.Open(name)
+	if err != nil || name != "/slow" {
+		return f, err
+	}
+	return &slowFile{File: f}, nil
+}
+
+type slowFile struct {
+	vfs.File
+}
+
+func (f *slowFile) ReadAt(p []byte, off int64) (int, error) {
+	return 0, &vfs.TimeoutError{Op: vfs.TimeoutFirstByte, Timeout: time.Second}
+}
+
+func TestJukeboxOnTimeout(t *testing.T) {
+	require := require.New(t)
+
+	mfs := vfs.NewMemoryFS(map[string]*vfs.MemoryFile{
+		"/":        vfs.NewMemoryFile("/", nil),
+		"/ok":      vfs.NewMemoryFile("ok", []byte("data")),
+		"/slow":    vfs.NewMemoryFile("slow", []byte("data")),
+		"/pending": vfs.NewMemoryFile("pending", []byte("data")),
+	})
+	handler, err := NewNFSv3Handler(&slowFs{MemoryFs: mfs})
+	require.NoError(err)
+
+	listener, err := net.Listen("tcp", "localhost:0")
+	require.NoError(err)
+	defer listener.Close()
+	go func() {
+		_ = wnfs.Serve(listener, handler)
+	}()
+
+	c, err := rpc.DialTCP(listener.Addr().Network(), nil, listener.Addr().String())
+	require.NoError(err)
+	defer c.Close()
+
+	mounter := nfsc.Mount{Client: c}
+	target, err := mounter.Mount("/", rpc.AuthNull)
+	require.NoError(err)
+
+	header := func(proc uint32) rpc.Header {
+		return rpc.Header{
+			Rpcvers: 2,
+			Prog:    nfsc.Nfs3Prog,
+			Vers:    nfsc.Nfs3Vers,
+			Proc:    proc,
+			Cred:    rpc.AuthNull,
+			Verf:    rpc.AuthNull,
+		}
+	}
+	call := func(proc uint32, name string) uint32 {
+		_, fh, err := target.Lookup(name)
+		require.NoError(err)
+
+		var res io.ReadSeeker
+		if proc == nfsc.NFSProc3Read {
+			res, err = c.Call(&struct {
+				rpc.Header
+				FH     []byte
+				Offset uint64
+				Count  uint32
+			}{Header: header(proc), FH: fh, Count: 4})
+		} else {
+			res, err = c.Call(&struct {
+				rpc.Header
+				FH []byte
+			}{Header: header(proc), FH: fh})
+		}
+		require.NoError(err)
+		status, err := xdr.ReadUint32(res)
+		require.NoError(err)
+		return status
+	}
+
+	require.Equal(uint32(wnfs.NFSStatusOk), call(nfsc.NFSProc3Read, "/ok"))
+	require.Equal(uint32(wnfs.NFSStatusJukebox), call(nfsc.NFSProc3Read, "/slow"))
+	require.Equal(uint32(wnfs.NFSStatusOk), call(nfsc.NFSProc3Getattr, "/ok"))
+	require.Equal(uint32(wnfs.NFSStatusJukebox), call(nfsc.NFSProc3Getattr, "/pending"))
+}
@@ -1,6 +1,7 @@
 package nfs
 
 import (
+	"io"
 	"io/fs"
 	"path/filepath"
 
@@ -9,7 +10,15 @@ import (
 )
 
 type billyFsWrapper struct {
-	fs vfs.Filesystem
+	fs    vfs.Filesystem
+	files *openFiles
+}
+
+func newBillyFsWrapper(fs vfs.Filesystem) *billyFsWrapper {
+	return &billyFsWrapper{
+		fs:    fs,
+		files: newOpenFiles(fs, fileIdleTimeout),
+	}
 }
 
 var _ billy.Filesystem = (*billyFsWrapper)(nil)
@@ -46,25 +55,27 @@ func (*billyFsWrapper) MkdirAll(filename string, perm fs.FileMode) error {
 
 // Open implements billy.Filesystem.
 func (f *billyFsWrapper) Open(filename string) (billy.File, error) {
-	file, err := f.fs.Open(filename)
+	file, err := f.files.open(filename)
 	if err != nil {
 		return nil, billyErr(err)
 	}
 	return &billyFile{
-		name: filename,
-		file: file,
+		name:  filename,
+		file:  file,
+		files: f.files,
 	}, nil
 }
 
 // OpenFile implements billy.Filesystem.
 func (f *billyFsWrapper) OpenFile(filename string, flag int, perm fs.FileMode) (billy.File, error) {
-	file, err := f.fs.Open(filename)
+	file, err := f.files.open(filename)
 	if err != nil {
 		return nil, billyErr(err)
 	}
 	return &billyFile{
-		name: filename,
-		file: file,
+		name:  filename,
+		file:  file,
+		files: f.files,
 	}, nil
 }
 
@@ -130,16 +141,18 @@ func (*billyFsWrapper) TempFile(dir string, prefix string) (billy.File, error) {
 	return nil, billyErr(vfs.ErrNotImplemented)
 }
 
+// billyFile is a shared file handle, it's closed when it isn't used by NFS calls
 type billyFile struct {
-	name string
-	file vfs.File
+	name  string
+	file  *sharedFile
+	files *openFiles
 }
 
 var _ billy.File = (*billyFile)(nil)
 
-// Close implements billy.File.
+// Close implements billy.File. Shared handle is kept open, it is closed when idle.
 func (f *billyFile) Close() error {
-	return f.Close()
+	return nil
 }
 
 // Name implements billy.File.
@@ -149,12 +162,22 @@ func (f *billyFile) Name() string {
 
 // Read implements billy.File.
 func (f *billyFile) Read(p []byte) (n int, err error) {
-	return f.Read(p)
+	defer f.files.use(f.file)()
+	n, err = f.file.file.Read(p)
+	if err != nil && err != io.EOF {
+		err = billyErr(err)
+	}
+	return n, err
 }
 
 // ReadAt implements billy.File.
 func (f *billyFile) ReadAt(p []byte, off int64) (n int, err error) {
-	return f.ReadAt(p, off)
+	defer f.files.use(f.file)()
+	n, err = f.file.file.ReadAt(p, off)
+	if err != nil && err != io.EOF {
+		err = billyErr(err)
+	}
+	return n, err
 }
 
 // Seek implements billy.File.
@@ -4,13 +4,14 @@ import (
 	"fmt"
 	"net/http"
 
+	"git.kmsign.ru/royalcat/tstor/src/export/httpfs"
 	"git.kmsign.ru/royalcat/tstor/src/host/vfs"
 	"github.com/rs/zerolog/log"
 )
 
 func NewWebDAVServer(fs vfs.Filesystem, port int, user, pass string) error {
 
-	srv := newHandler(fs)
+	srv := httpfs.TimeoutHandler(fs, newHandler(fs))
 
 	serveMux := http.NewServeMux()
 
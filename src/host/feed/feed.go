@@ -0,0 +1,224 @@
+package feed
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// maxFeedSize limits size of fetched feed
+const maxFeedSize = 16 * 1024 * 1024
+
+// Item is a feed entry linking a torrent
+type Item struct {
+	// ID is a guid of the item, link is used if feed doesn't provide it
+	ID    string
+	Title string
+	// Link is a magnet or an url of torrent file
+	Link      string
+	Published time.Time
+}
+
+func (i Item) IsMagnet() bool {
+	return strings.HasPrefix(i.Link, "magnet:")
+}
+
+// Fetch downloads and parses RSS or Atom feed
+func Fetch(ctx context.Context, client *http.Client, url string) ([]Item, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching feed %s: %s", url, resp.Status)
+	}
+
+	return Parse(io.LimitReader(resp.Body, maxFeedSize))
+}
+
+type rssFeed struct {
+	Items []struct {
+		Title     string `xml:"title"`
+		Link      string `xml:"link"`
+		GUID      string `xml:"guid"`
+		PubDate   string `xml:"pubDate"`
+		Enclosure struct {
+			URL  string `xml:"url,attr"`
+			Type string `xml:"type,attr"`
+		} `xml:"enclosure"`
+		// MagnetURI is used by ezRSS and torrent trackers
+		MagnetURI string `xml:"magnetURI"`
+	} `xml:"channel>item"`
+}
+
+type atomFeed struct {
+	Entries []struct {
+		Title   string `xml:"title"`
+		ID      string `xml:"id"`
+		Updated string `xml:"updated"`
+		Links   []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+			Type string `xml:"type,attr"`
+		} `xml:"link"`
+	} `xml:"entry"`
+}
+
+// Parse parses RSS 2.0 or Atom feed, entries without torrent links are skipped
+func Parse(r io.Reader) ([]Item, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var root struct {
+		XMLName xml.Name
+	}
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("parsing feed: %w", err)
+	}
+
+	items := []Item{}
+	switch root.XMLName.Local {
+	case "rss":
+		var feed rssFeed
+		if err := xml.Unmarshal(data, &feed); err != nil {
+			return nil, fmt.Errorf("parsing rss feed: %w", err)
+		}
+		for _, i := range feed.Items {
+			u := torrentLink(
+				link{i.MagnetURI, ""},
+				link{i.Enclosure.URL, i.Enclosure.Type},
+				link{i.Link, ""},
+			)
+			if u == "" {
+				continue
+			}
+			items = append(items, newItem(i.GUID, strings.TrimSpace(i.Title), u, parseTime(i.PubDate)))
+		}
+	case "feed":
+		var feed atomFeed
+		if err := xml.Unmarshal(data, &feed); err != nil {
+			return nil, fmt.Errorf("parsing atom feed: %w", err)
+		}
+		for _, e := range feed.Entries {
+			links := []link{}
+			// enclosures go first
+			for _, l := range e.Links {
+				if l.Rel == "enclosure" {
+					links = append(links, link{l.Href, l.Type})
+				}
+			}
+			for _, l := range e.Links {
+				if l.Rel != "enclosure" {
+					links = append(links, link{l.Href, l.Type})
+				}
+			}
+			u := torrentLink(links...)
+			if u == "" {
+				continue
+			}
+			items = append(items, newItem(e.ID, strings.TrimSpace(e.Title), u, parseTime(e.Updated)))
+		}
+	default:
+		return nil, fmt.Errorf("unknown feed format: %s", root.XMLName.Local)
+	}
+
+	return items, nil
+}
+
+func newItem(id, title, link string, published time.Time) Item {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		id = link
+	}
+	return Item{
+		ID:        id,
+		Title:     title,
+		Link:      link,
+		Published: published,
+	}
+}
+
+type link struct {
+	url, mimeType string
+}
+
+// torrentLink returns first link to magnet or torrent file
+func torrentLink(links ...link) string {
+	for _, l := range links {
+		u := strings.TrimSpace(l.url)
+		switch {
+		case u == "":
+			continue
+		case strings.HasPrefix(u, "magnet:"),
+			l.mimeType == "application/x-bittorrent",
+			strings.HasSuffix(strings.ToLower(strings.SplitN(u, "?", 2)[0]), ".torrent"):
+			return u
+		}
+	}
+	return ""
+}
+
+func parseTime(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{time.RFC1123Z, time.RFC1123, time.RFC3339} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Filter matches item titles, item matches if it matches any include expression and none of exclude ones
+type Filter struct {
+	include, exclude []*regexp.Regexp
+}
+
+// NewFilter compiles filter expressions, empty include list matches all items
+func NewFilter(include, exclude []string) (*Filter, error) {
+	f := &Filter{}
+	for _, e := range include {
+		re, err := regexp.Compile(e)
+		if err != nil {
+			return nil, fmt.Errorf("include filter %q: %w", e, err)
+		}
+		f.include = append(f.include, re)
+	}
+	for _, e := range exclude {
+		re, err := regexp.Compile(e)
+		if err != nil {
+			return nil, fmt.Errorf("exclude filter %q: %w", e, err)
+		}
+		f.exclude = append(f.exclude, re)
+	}
+	return f, nil
+}
+
+func (f *Filter) Match(title string) bool {
+	for _, re := range f.exclude {
+		if re.MatchString(title) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, re := range f.include {
+		if re.MatchString(title) {
+			return true
+		}
+	}
+	return false
+}
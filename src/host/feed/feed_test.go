@@ -0,0 +1,123 @@
+package feed
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testRSS = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:torrent="http://xmlns.ezrss.it/0.1/">
+<channel>
+	<title>test</title>
+	<item>
+		<title>Show S01E01 1080p</title>
+		<guid>show-1</guid>
+		<pubDate>Mon, 02 Jan 2006 15:04:05 -0700</pubDate>
+		<enclosure url="http://example.com/download/1" type="application/x-bittorrent" length="1000"/>
+	</item>
+	<item>
+		<title>Show S01E02 720p</title>
+		<link>http://example.com/show-2.torrent</link>
+	</item>
+	<item>
+		<title>Show S01E03 1080p</title>
+		<guid>show-3</guid>
+		<link>http://example.com/page/3</link>
+		<torrent:magnetURI>magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567</torrent:magnetURI>
+	</item>
+	<item>
+		<title>News</title>
+		<link>http://example.com/news</link>
+	</item>
+</channel>
+</rss>`
+
+const testAtom = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+	<title>test</title>
+	<entry>
+		<title>Album</title>
+		<id>urn:album</id>
+		<updated>2006-01-02T15:04:05Z</updated>
+		<link href="http://example.com/album"/>
+		<link rel="enclosure" href="http://example.com/album.torrent"/>
+	</entry>
+	<entry>
+		<title>Page</title>
+		<id>urn:page</id>
+		<link href="http://example.com/page"/>
+	</entry>
+</feed>`
+
+func TestFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rss":
+			w.Write([]byte(testRSS))
+		case "/atom":
+			w.Write([]byte(testAtom))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	t.Run("rss", func(t *testing.T) {
+		require := require.New(t)
+
+		items, err := Fetch(context.Background(), srv.Client(), srv.URL+"/rss")
+		require.NoError(err)
+		require.Len(items, 3)
+
+		require.Equal("show-1", items[0].ID)
+		require.Equal("Show S01E01 1080p", items[0].Title)
+		require.Equal("http://example.com/download/1", items[0].Link)
+		require.True(items[0].Published.Equal(time.Date(2006, 1, 2, 22, 4, 5, 0, time.UTC)))
+
+		require.Equal("http://example.com/show-2.torrent", items[1].ID)
+		require.False(items[1].IsMagnet())
+
+		require.Equal("show-3", items[2].ID)
+		require.True(items[2].IsMagnet())
+	})
+
+	t.Run("atom", func(t *testing.T) {
+		require := require.New(t)
+
+		items, err := Fetch(context.Background(), srv.Client(), srv.URL+"/atom")
+		require.NoError(err)
+		require.Equal([]Item{{
+			ID:        "urn:album",
+			Title:     "Album",
+			Link:      "http://example.com/album.torrent",
+			Published: time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC),
+		}}, items)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := Fetch(context.Background(), srv.Client(), srv.URL+"/missing")
+		require.Error(t, err)
+	})
+}
+
+func TestFilter(t *testing.T) {
+	require := require.New(t)
+
+	f, err := NewFilter([]string{`(?i)show`}, []string{`720p`})
+	require.NoError(err)
+	require.True(f.Match("Show S01E01 1080p"))
+	require.False(f.Match("Show S01E02 720p"))
+	require.False(f.Match("News"))
+
+	f, err = NewFilter(nil, nil)
+	require.NoError(err)
+	require.True(f.Match("News"))
+
+	_, err = NewFilter([]string{"("}, nil)
+	require.Error(err)
+}
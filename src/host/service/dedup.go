@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"git.kmsign.ru/royalcat/tstor/src/host/storage"
+)
+
+var ErrDedupUnsupported = errors.New("storage doesn't support deduplication")
+
+// Duplicates lists files duplicated across loaded torrents
+func (s *Service) Duplicates() ([]storage.DuplicateGroup, error) {
+	if s.dedup == nil {
+		return nil, ErrDedupUnsupported
+	}
+	return s.dedup.Duplicates()
+}
+
+// Deduplicate links duplicate files to a single stored copy and updates completion
+// of pieces which data was linked, returns number of linked pieces
+func (s *Service) Deduplicate() (int, error) {
+	if s.dedup == nil {
+		return 0, ErrDedupUnsupported
+	}
+
+	linked, err := s.dedup.Deduplicate()
+
+	n := 0
+	for _, lp := range linked {
+		t, ok := s.c.Torrent(lp.InfoHash)
+		if !ok {
+			continue
+		}
+		for _, i := range lp.Pieces {
+			t.Piece(i).UpdateCompletion()
+		}
+		n += len(lp.Pieces)
+	}
+
+	return n, err
+}
+
+// RunDedup periodically deduplicates stored files until ctx is canceled.
+// Non positive interval disables it.
+func (s *Service) RunDedup(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		s.log.Error("dedup interval must be positive, dedup is disabled", "interval", interval)
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		n, err := s.Deduplicate()
+		if err != nil {
+			s.log.Error("error deduplicating files", "error", err)
+			continue
+		}
+		if n > 0 {
+			s.log.Info("pieces linked from duplicate files", "pieces", n)
+		}
+	}
+}
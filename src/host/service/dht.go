@@ -0,0 +1,180 @@
+package service
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"git.kmsign.ru/royalcat/tstor/src/host/storage"
+	"github.com/anacrolix/dht/v2"
+	"github.com/anacrolix/dht/v2/bep44"
+	"github.com/anacrolix/dht/v2/exts/getput"
+	"github.com/anacrolix/dht/v2/krpc"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+)
+
+var ErrDHTDisabled = errors.New("dht is disabled")
+
+const dhtTimeout = time.Minute
+
+type DHTItem struct {
+	// Target is hex encoded address of the item in DHT
+	Target string `json:"target"`
+	Value  string `json:"value"`
+	// PublicKey is hex encoded key of a mutable item, empty for immutable ones
+	PublicKey string `json:"publicKey,omitempty"`
+	Salt      string `json:"salt,omitempty"`
+	Seq       int64  `json:"seq"`
+	Mutable   bool   `json:"mutable"`
+}
+
+func (s *Service) dhtServer() (*dht.Server, error) {
+	for _, ds := range s.c.DhtServers() {
+		if w, ok := ds.(torrent.AnacrolixDhtServerWrapper); ok {
+			return w.Server, nil
+		}
+	}
+	return nil, ErrDHTDisabled
+}
+
+func parseTarget(target string) (bep44.Target, error) {
+	var t bep44.Target
+	b, err := hex.DecodeString(target)
+	if err != nil || len(b) != len(t) {
+		return t, fmt.Errorf("invalid target: %s", target)
+	}
+	copy(t[:], b)
+	return t, nil
+}
+
+// PutDHTItem publishes value to DHT, item is immutable if keyName is empty
+// and mutable signed with the stored key otherwise
+func (s *Service) PutDHTItem(ctx context.Context, value string, keyName string, salt string) (*DHTItem, error) {
+	srv, err := s.dhtServer()
+	if err != nil {
+		return nil, err
+	}
+
+	var priv ed25519.PrivateKey
+	if keyName != "" {
+		priv, err = s.dhtKeys.Get(keyName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	item, err := bep44.NewItem(value, []byte(salt), 0, 0, priv)
+	if err != nil {
+		return nil, err
+	}
+	target := item.Target()
+
+	ctx, cancel := context.WithTimeout(ctx, dhtTimeout)
+	defer cancel()
+
+	var seq int64
+	_, err = getput.Put(ctx, krpc.ID(target), srv, item.Salt, func(autoSeq int64) bep44.Put {
+		put := item.ToPut()
+		if item.IsMutable() {
+			// sequence must grow for nodes to replace previous value
+			seq = autoSeq + 1
+			put.Seq = seq
+			put.Sign(priv)
+		}
+		return put
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := &DHTItem{
+		Target:  hex.EncodeToString(target[:]),
+		Value:   value,
+		Salt:    salt,
+		Seq:     seq,
+		Mutable: item.IsMutable(),
+	}
+	if item.IsMutable() {
+		out.PublicKey = hex.EncodeToString(item.K[:])
+	}
+
+	return out, nil
+}
+
+// GetDHTItem fetches item from DHT, items stored by the local node are returned if DHT lookup fails
+func (s *Service) GetDHTItem(ctx context.Context, target string, salt string) (*DHTItem, error) {
+	t, err := parseTarget(target)
+	if err != nil {
+		return nil, err
+	}
+
+	srv, err := s.dhtServer()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, dhtTimeout)
+	defer cancel()
+
+	res, _, err := getput.Get(ctx, t, srv, nil, []byte(salt))
+	if err == nil {
+		var value string
+		if err := bencode.Unmarshal(res.V, &value); err != nil {
+			value = string(res.V)
+		}
+		return &DHTItem{
+			Target:  target,
+			Value:   value,
+			Salt:    salt,
+			Seq:     res.Seq,
+			Mutable: res.Mutable,
+		}, nil
+	}
+	s.log.Debug("dht lookup failed, looking for local item", "target", target, "error", err)
+
+	item, lerr := s.dhtItems.Get(t)
+	if errors.Is(lerr, bep44.ErrItemNotFound) {
+		return nil, fmt.Errorf("%w: %s", storage.ErrNotFound, err.Error())
+	}
+	if lerr != nil {
+		return nil, lerr
+	}
+
+	out := &DHTItem{
+		Target:  target,
+		Value:   fmt.Sprint(item.V),
+		Salt:    string(item.Salt),
+		Seq:     item.Seq,
+		Mutable: item.IsMutable(),
+	}
+	if item.IsMutable() {
+		out.PublicKey = hex.EncodeToString(item.K[:])
+	}
+	return out, nil
+}
+
+// DeleteDHTItem removes item from the local node store, copies stored by other nodes expire by themselves
+func (s *Service) DeleteDHTItem(target string) error {
+	t, err := parseTarget(target)
+	if err != nil {
+		return err
+	}
+
+	return s.dhtItems.Del(t)
+}
+
+func (s *Service) DHTKeys() ([]storage.DHTKey, error) {
+	return s.dhtKeys.List()
+}
+
+func (s *Service) CreateDHTKey(name string) (storage.DHTKey, error) {
+	return s.dhtKeys.Create(name)
+}
+
+func (s *Service) DeleteDHTKey(name string) error {
+	return s.dhtKeys.Delete(name)
+}
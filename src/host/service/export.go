@@ -0,0 +1,484 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"git.kmsign.ru/royalcat/tstor/src/host/storage"
+	"git.kmsign.ru/royalcat/tstor/src/host/vfs"
+)
+
+var ErrExportsNotStarted = errors.New("exports are not started")
+
+const (
+	exportChunkSize = 1024 * 1024
+	// exportSaveInterval is how often progress of running job is persisted
+	exportSaveInterval = 5 * time.Second
+	// exportPartSuffix is a suffix of partially exported files, copying is resumed from their size
+	exportPartSuffix = ".tstor-part"
+)
+
+type exportJobs struct {
+	store *storage.ExportJobs
+
+	mu        sync.Mutex
+	root      vfs.Filesystem
+	targetDir string
+	// running job and its cancel func
+	running string
+	cancel  context.CancelFunc
+	// progress of running job, it is saved periodically
+	progress *storage.ExportJob
+
+	wake chan struct{}
+	// link hardlinks file on local disk
+	link func(src, dst string) error
+}
+
+func newExportJobs(store *storage.ExportJobs) *exportJobs {
+	return &exportJobs{
+		store: store,
+		wake:  make(chan struct{}, 1),
+		link:  linkFile,
+	}
+}
+
+func newExportID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Export queues export of file or directory from filesystem into export directory,
+// target is a path relative to export directory, source name is used if it is empty
+func (s *Service) Export(source, target string, mode storage.ExportMode) (*storage.ExportJob, error) {
+	e := s.exports
+	e.mu.Lock()
+	root := e.root
+	e.mu.Unlock()
+	if root == nil {
+		return nil, ErrExportsNotStarted
+	}
+
+	if !mode.Valid() {
+		return nil, fmt.Errorf("unknown export mode: %s", mode)
+	}
+	source = vfs.AbsPath(path.Clean(source))
+	if _, err := root.Stat(source); err != nil {
+		return nil, err
+	}
+	if target == "" {
+		target = path.Base(source)
+	}
+	target = path.Clean(target)
+	if !filepath.IsLocal(target) {
+		return nil, fmt.Errorf("target must be a relative path inside export directory: %s", target)
+	}
+
+	now := time.Now()
+	job := storage.ExportJob{
+		ID:      newExportID(),
+		Source:  source,
+		Target:  target,
+		Mode:    mode,
+		State:   storage.ExportQueued,
+		Created: now,
+		Updated: now,
+	}
+	if err := e.store.Save(job); err != nil {
+		return nil, err
+	}
+
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+
+	return &job, nil
+}
+
+// ExportJobs lists export jobs with progress of running one
+func (s *Service) ExportJobs() ([]storage.ExportJob, error) {
+	jobs, err := s.exports.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	s.exports.mu.Lock()
+	defer s.exports.mu.Unlock()
+	for i, j := range jobs {
+		if s.exports.progress != nil && j.ID == s.exports.progress.ID {
+			jobs[i] = *s.exports.progress
+		}
+	}
+	return jobs, nil
+}
+
+func (s *Service) ExportJob(id string) (*storage.ExportJob, error) {
+	s.exports.mu.Lock()
+	if p := s.exports.progress; p != nil && p.ID == id {
+		job := *p
+		s.exports.mu.Unlock()
+		return &job, nil
+	}
+	s.exports.mu.Unlock()
+
+	job, err := s.exports.store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// DeleteExport cancels unfinished job, it is kept with canceled state, so its clients see it stopped.
+// Finished jobs are removed. Exported files are kept.
+func (s *Service) DeleteExport(id string) error {
+	e := s.exports
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	job, err := e.store.Get(id)
+	if err != nil {
+		return err
+	}
+	if job.State != storage.ExportQueued && job.State != storage.ExportRunning {
+		return e.store.Delete(id)
+	}
+
+	if e.running == id {
+		e.cancel()
+		if e.progress != nil {
+			e.progress.State = storage.ExportCanceled
+			job = *e.progress
+		}
+	}
+	job.State = storage.ExportCanceled
+	job.Updated = time.Now()
+	return e.store.Save(job)
+}
+
+// RunExports runs queued export jobs one by one until ctx is canceled,
+// jobs interrupted by restart are resumed
+func (s *Service) RunExports(ctx context.Context, root vfs.Filesystem, targetDir string) {
+	e := s.exports
+	e.mu.Lock()
+	e.root = root
+	e.targetDir = targetDir
+	e.mu.Unlock()
+
+	for {
+		job, err := s.nextExport()
+		if err != nil {
+			s.log.Error("error listing export jobs", "error", err)
+		}
+
+		if job == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-e.wake:
+				continue
+			}
+		}
+
+		jobCtx, cancel := context.WithCancel(ctx)
+		e.mu.Lock()
+		// job canceled after it was selected isn't run
+		if stored, err := e.store.Get(job.ID); err != nil || stored.State == storage.ExportCanceled {
+			e.mu.Unlock()
+			cancel()
+			continue
+		}
+		e.running = job.ID
+		e.cancel = cancel
+		e.mu.Unlock()
+
+		s.runExport(jobCtx, job)
+		cancel()
+
+		e.mu.Lock()
+		e.running = ""
+		e.cancel = nil
+		e.progress = nil
+		e.mu.Unlock()
+
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// nextExport returns the oldest unfinished job, running state means it was interrupted by restart
+func (s *Service) nextExport() (*storage.ExportJob, error) {
+	jobs, err := s.exports.store.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, j := range jobs {
+		if j.State == storage.ExportQueued || j.State == storage.ExportRunning {
+			return &j, nil
+		}
+	}
+	return nil, nil
+}
+
+type exportFile struct {
+	source string
+	// target is a path on local disk
+	target string
+	size   int64
+}
+
+func (s *Service) runExport(ctx context.Context, job *storage.ExportJob) {
+	e := s.exports
+	log := s.log.With("export", job.ID, "source", job.Source)
+
+	files, err := e.listFiles(job.Source, filepath.Join(e.targetDir, filepath.FromSlash(job.Target)))
+
+	// files completed before restart are skipped, linked ones are already counted
+	completed := make(map[string]bool, len(job.CompletedFiles))
+	for _, p := range job.CompletedFiles {
+		completed[p] = true
+	}
+
+	e.mu.Lock()
+	job.State = storage.ExportRunning
+	job.Error = ""
+	job.DoneFiles, job.DoneBytes = 0, 0
+	job.TotalFiles, job.TotalBytes = len(files), 0
+	for _, f := range files {
+		job.TotalBytes += f.size
+	}
+	e.progress = job
+	e.mu.Unlock()
+
+	if err == nil {
+		err = s.saveExport(job)
+	}
+
+	lastSave := time.Now()
+	for _, f := range files {
+		if err != nil {
+			break
+		}
+
+		if completed[f.source] {
+			e.mu.Lock()
+			job.DoneFiles++
+			job.DoneBytes += f.size
+			e.mu.Unlock()
+			continue
+		}
+
+		var linked bool
+		linked, err = e.exportFile(ctx, f, job.Mode, func(n int64) {
+			e.mu.Lock()
+			job.DoneBytes += n
+			e.mu.Unlock()
+
+			if time.Since(lastSave) > exportSaveInterval {
+				lastSave = time.Now()
+				if err := s.saveExport(job); err != nil {
+					log.Error("error saving export progress", "error", err)
+				}
+			}
+		})
+		if err != nil {
+			err = fmt.Errorf("exporting %s: %w", f.source, err)
+			break
+		}
+
+		e.mu.Lock()
+		job.DoneFiles++
+		if linked {
+			job.LinkedFiles++
+		}
+		job.CompletedFiles = append(job.CompletedFiles, f.source)
+		e.mu.Unlock()
+
+		lastSave = time.Now()
+		if err := s.saveExport(job); err != nil {
+			log.Error("error saving export progress", "error", err)
+		}
+	}
+
+	e.mu.Lock()
+	canceled := job.State == storage.ExportCanceled
+	e.mu.Unlock()
+
+	switch {
+	case canceled:
+		log.Info("export canceled")
+	case ctx.Err() != nil:
+		// job is resumed after restart
+		log.Info("export interrupted")
+		return
+	case err != nil:
+		e.mu.Lock()
+		job.State = storage.ExportFailed
+		job.Error = err.Error()
+		e.mu.Unlock()
+		log.Error("export failed", "error", err)
+	default:
+		e.mu.Lock()
+		job.State = storage.ExportDone
+		e.mu.Unlock()
+		log.Info("export done", "files", job.DoneFiles, "linked", job.LinkedFiles)
+	}
+
+	if err := s.saveExport(job); err != nil {
+		log.Error("error saving export job", "error", err)
+	}
+}
+
+func (s *Service) saveExport(job *storage.ExportJob) error {
+	s.exports.mu.Lock()
+	defer s.exports.mu.Unlock()
+
+	job.Updated = time.Now()
+	// deleted job must not be saved again
+	stored, err := s.exports.store.Get(job.ID)
+	if err != nil {
+		return err
+	}
+	// job canceled before its progress was tracked stays canceled
+	if stored.State == storage.ExportCanceled {
+		job.State = storage.ExportCanceled
+	}
+	return s.exports.store.Save(*job)
+}
+
+// listFiles lists files of source recursively
+func (e *exportJobs) listFiles(source, target string) ([]exportFile, error) {
+	info, err := e.root.Stat(source)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []exportFile{{source: source, target: target, size: info.Size()}}, nil
+	}
+
+	entries, err := e.root.ReadDir(source)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []exportFile{}
+	for _, entry := range entries {
+		p := path.Join(source, entry.Name())
+		// views and excluded files are not exported
+		if p == vfs.ViewsDir || e.isTrashDir(p) {
+			continue
+		}
+		nested, err := e.listFiles(p, filepath.Join(target, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, nested...)
+	}
+	return files, nil
+}
+
+// isTrashDir reports whether p is a virtual directory of excluded torrent files,
+// directories named the same inside torrents or in data folder are exported
+func (e *exportJobs) isTrashDir(p string) bool {
+	rfs, ok := e.root.(*vfs.ResolveFS)
+	return ok && rfs.IsTrashDir(p)
+}
+
+// exportFile exports single file replacing existing target, partial copies are resumed
+func (e *exportJobs) exportFile(ctx context.Context, f exportFile, mode storage.ExportMode, progress func(n int64)) (linked bool, err error) {
+	if err := os.MkdirAll(filepath.Dir(f.target), 0744); err != nil {
+		return false, err
+	}
+
+	src, err := e.root.Open(f.source)
+	if err != nil {
+		return false, err
+	}
+	defer src.Close()
+
+	if mode == storage.ExportHardlink {
+		if df, ok := src.(vfs.DiskFile); ok {
+			if p, ok := df.DiskPath(); ok {
+				err := e.link(p, f.target)
+				if err == nil {
+					progress(f.size)
+					return true, nil
+				}
+				// links across filesystems are not possible, file is copied
+				if !errors.Is(err, syscall.EXDEV) {
+					return false, err
+				}
+			}
+		}
+	}
+
+	return false, copyExportFile(ctx, src, f, progress)
+}
+
+func linkFile(src, dst string) error {
+	// part files are written to, so links use other name
+	tmp := dst + ".tstor-link"
+	_ = os.Remove(tmp)
+	if err := os.Link(src, tmp); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+func copyExportFile(ctx context.Context, src vfs.File, f exportFile, progress func(n int64)) error {
+	part := f.target + exportPartSuffix
+	out, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	st, err := out.Stat()
+	if err != nil {
+		return err
+	}
+	off := st.Size()
+	if off > f.size {
+		off = 0
+		if err := out.Truncate(0); err != nil {
+			return err
+		}
+	}
+	progress(off)
+
+	buf := make([]byte, exportChunkSize)
+	for off < f.size {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		n, err := src.ReadAt(buf[:min(int64(len(buf)), f.size-off)], off)
+		if n > 0 {
+			if _, werr := out.WriteAt(buf[:n], off); werr != nil {
+				return werr
+			}
+			off += int64(n)
+			progress(int64(n))
+		}
+		if err != nil && !(errors.Is(err, io.EOF) && off == f.size) {
+			return err
+		}
+	}
+
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(part, f.target)
+}
@@ -0,0 +1,255 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"git.kmsign.ru/royalcat/tstor/src/host/storage"
+	"git.kmsign.ru/royalcat/tstor/src/host/vfs"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingFs records read offsets and blocks reads until unblocked
+type blockingFs struct {
+	*vfs.OsFS
+	reading chan struct{}
+	unblock chan struct{}
+	// offsets of reads
+	reads chan int64
+}
+
+func (b *blockingFs) Open(name string) (vfs.File, error) {
+	f, err := b.OsFS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &blockingFile{File: f, fs: b}, nil
+}
+
+type blockingFile struct {
+	vfs.File
+	fs *blockingFs
+}
+
+func (f *blockingFile) DiskPath() (string, bool) {
+	return f.File.(vfs.DiskFile).DiskPath()
+}
+
+func (f *blockingFile) ReadAt(p []byte, off int64) (int, error) {
+	if f.fs.reads != nil {
+		f.fs.reads <- off
+	}
+	if f.fs.unblock != nil {
+		select {
+		case f.fs.reading <- struct{}{}:
+		default:
+		}
+		<-f.fs.unblock
+	}
+	return f.File.ReadAt(p, off)
+}
+
+func newExportTest(t *testing.T) (*Service, *blockingFs, string) {
+	src, target := t.TempDir(), t.TempDir()
+
+	store, err := storage.NewExportJobs(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+
+	s := &Service{
+		exports: newExportJobs(store),
+		log:     slog.Default(),
+	}
+	root := &blockingFs{OsFS: vfs.NewOsFs(src)}
+	s.exports.root = root
+	s.exports.targetDir = target
+	return s, root, src
+}
+
+// runExportJobs runs queued jobs until all of them are finished
+func runExportJobs(t *testing.T, s *Service) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.RunExports(ctx, s.exports.root, s.exports.targetDir)
+	}()
+
+	require.Eventually(t, func() bool {
+		job, err := s.nextExport()
+		require.NoError(t, err)
+		return job == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, data := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.NoError(t, os.WriteFile(p, []byte(data), 0644))
+	}
+}
+
+func readFile(t *testing.T, p string) string {
+	data, err := os.ReadFile(p)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestExportResume(t *testing.T) {
+	require := require.New(t)
+	s, root, src := newExportTest(t)
+	target := s.exports.targetDir
+
+	writeFiles(t, src, map[string]string{
+		"dir/done":    "done data",
+		"dir/partial": "0123456789",
+		"dir/same":    "new data",
+	})
+	// completed file isn't exported again
+	writeFiles(t, target, map[string]string{"dir/done": "kept"})
+	// target of same size, which isn't completed, is replaced
+	writeFiles(t, target, map[string]string{"dir/same": "old data"})
+	// partial copy is resumed from its size
+	writeFiles(t, target, map[string]string{"dir/partial" + exportPartSuffix: "01234"})
+
+	job, err := s.Export("/dir", "", storage.ExportCopy)
+	require.NoError(err)
+	job.State = storage.ExportRunning
+	job.CompletedFiles = []string{"/dir/done"}
+	require.NoError(s.exports.store.Save(*job))
+
+	root.reads = make(chan int64, 16)
+	runExportJobs(t, s)
+	close(root.reads)
+
+	require.Equal("kept", readFile(t, filepath.Join(target, "dir/done")))
+	require.Equal("0123456789", readFile(t, filepath.Join(target, "dir/partial")))
+	require.Equal("new data", readFile(t, filepath.Join(target, "dir/same")))
+	require.NoFileExists(filepath.Join(target, "dir/partial"+exportPartSuffix))
+
+	var offsets []int64
+	for off := range root.reads {
+		offsets = append(offsets, off)
+	}
+	require.ElementsMatch([]int64{5, 0}, offsets)
+
+	job, err = s.ExportJob(job.ID)
+	require.NoError(err)
+	require.Equal(storage.ExportDone, job.State)
+	require.Equal(3, job.DoneFiles)
+	require.Equal(int64(len("done data")+10+len("new data")), job.DoneBytes)
+	require.ElementsMatch([]string{"/dir/done", "/dir/partial", "/dir/same"}, job.CompletedFiles)
+}
+
+func TestExportHardlinkFallback(t *testing.T) {
+	require := require.New(t)
+	s, _, src := newExportTest(t)
+	target := s.exports.targetDir
+
+	writeFiles(t, src, map[string]string{"a": "data a", "b": "data b"})
+
+	// links across filesystems fail with EXDEV, b is on other filesystem
+	s.exports.link = func(p, dst string) error {
+		if filepath.Base(p) == "b" {
+			return &os.LinkError{Op: "link", Old: p, New: dst, Err: syscall.EXDEV}
+		}
+		return linkFile(p, dst)
+	}
+
+	a, err := s.Export("/a", "", storage.ExportHardlink)
+	require.NoError(err)
+	b, err := s.Export("/b", "", storage.ExportHardlink)
+	require.NoError(err)
+	runExportJobs(t, s)
+
+	a, err = s.ExportJob(a.ID)
+	require.NoError(err)
+	require.Equal(storage.ExportDone, a.State)
+	require.Equal(1, a.LinkedFiles)
+	srcInfo, err := os.Stat(filepath.Join(src, "a"))
+	require.NoError(err)
+	targetInfo, err := os.Stat(filepath.Join(target, "a"))
+	require.NoError(err)
+	require.True(os.SameFile(srcInfo, targetInfo))
+
+	b, err = s.ExportJob(b.ID)
+	require.NoError(err)
+	require.Equal(storage.ExportDone, b.State)
+	require.Equal(0, b.LinkedFiles)
+	require.Equal("data b", readFile(t, filepath.Join(target, "b")))
+}
+
+func TestExportDeleteRunning(t *testing.T) {
+	require := require.New(t)
+	s, root, src := newExportTest(t)
+	target := s.exports.targetDir
+
+	writeFiles(t, src, map[string]string{"a": "data a", "b": "data b"})
+	root.reading = make(chan struct{}, 1)
+	root.unblock = make(chan struct{})
+
+	a, err := s.Export("/a", "", storage.ExportCopy)
+	require.NoError(err)
+	b, err := s.Export("/b", "", storage.ExportCopy)
+	require.NoError(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.RunExports(ctx, root, target)
+	}()
+
+	select {
+	case <-root.reading:
+	case <-time.After(5 * time.Second):
+		t.Fatal("export isn't started")
+	}
+	require.NoError(s.DeleteExport(a.ID))
+	close(root.unblock)
+
+	// canceled job is kept with its terminal state and next job is run
+	require.Eventually(func() bool {
+		job, err := s.ExportJob(b.ID)
+		require.NoError(err)
+		return job.State == storage.ExportDone
+	}, 5*time.Second, 10*time.Millisecond)
+	job, err := s.ExportJob(a.ID)
+	require.NoError(err)
+	require.Equal(storage.ExportCanceled, job.State)
+	require.Equal("data b", readFile(t, filepath.Join(target, "b")))
+
+	// finished jobs are removed
+	require.NoError(s.DeleteExport(a.ID))
+	_, err = s.ExportJob(a.ID)
+	require.ErrorIs(err, storage.ErrNotFound)
+	require.NoError(s.DeleteExport(b.ID))
+	_, err = s.ExportJob(b.ID)
+	require.ErrorIs(err, storage.ErrNotFound)
+
+	cancel()
+	<-done
+}
+
+func TestExportTrashNamedDir(t *testing.T) {
+	require := require.New(t)
+	s, _, src := newExportTest(t)
+	target := s.exports.targetDir
+
+	// directory named as torrent trash in data folder is a regular directory
+	writeFiles(t, src, map[string]string{"dir/.trash/a": "data a"})
+	_, err := s.Export("/dir", "", storage.ExportCopy)
+	require.NoError(err)
+	runExportJobs(t, s)
+
+	require.Equal("data a", readFile(t, filepath.Join(target, "dir", ".trash", "a")))
+}
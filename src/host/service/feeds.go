@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"git.kmsign.ru/royalcat/tstor/src/config"
+	"git.kmsign.ru/royalcat/tstor/src/host/feed"
+	"git.kmsign.ru/royalcat/tstor/src/host/storage"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+const (
+	defaultFeedInterval = 15 * time.Minute
+	// maxTorrentFileSize limits size of downloaded torrent files
+	maxTorrentFileSize = 16 * 1024 * 1024
+)
+
+var feedClient = &http.Client{Timeout: time.Minute}
+
+// RunFeeds polls feeds until ctx is canceled, torrents of matching items are saved into feed
+// directories in dataDir, so they appear in filesystem. Added items are remembered in repository.
+func (s *Service) RunFeeds(ctx context.Context, feeds []config.Feed, dataDir string) {
+	var wg sync.WaitGroup
+	for _, f := range feeds {
+		if err := s.validateFeed(f); err != nil {
+			s.log.Error("invalid feed, it is disabled", "feed", f.Name, "error", err)
+			continue
+		}
+		filter, err := feed.NewFilter(f.Include, f.Exclude)
+		if err != nil {
+			s.log.Error("invalid feed filter, feed is disabled", "feed", f.Name, "error", err)
+			continue
+		}
+
+		dir := f.Dir
+		if dir == "" {
+			dir = filepath.Join("feeds", f.Name)
+		}
+		dir = filepath.Join(dataDir, dir)
+
+		interval := time.Duration(f.Interval) * time.Minute
+		if interval <= 0 {
+			interval = defaultFeedInterval
+		}
+
+		wg.Add(1)
+		go func(f config.Feed) {
+			defer wg.Done()
+			s.runFeed(ctx, f, filter, dir, interval)
+		}(f)
+	}
+	wg.Wait()
+}
+
+func (s *Service) validateFeed(f config.Feed) error {
+	switch {
+	case f.Name == "":
+		return errors.New("feed name is required")
+	case f.URL == "":
+		return errors.New("feed url is required")
+	case !filepath.IsLocal(f.Name):
+		return fmt.Errorf("feed name must be a valid directory name: %s", f.Name)
+	case f.Dir != "" && !filepath.IsLocal(f.Dir):
+		return fmt.Errorf("feed dir must be a relative path inside data folder: %s", f.Dir)
+	}
+	return nil
+}
+
+func (s *Service) runFeed(ctx context.Context, f config.Feed, filter *feed.Filter, dir string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.pollFeed(ctx, f, filter, dir); err != nil {
+			s.log.Error("error polling feed", "feed", f.Name, "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pollFeed adds new matching items of the feed, failed items are retried on next poll
+func (s *Service) pollFeed(ctx context.Context, f config.Feed, filter *feed.Filter, dir string) error {
+	items, err := feed.Fetch(ctx, feedClient, f.URL)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !filter.Match(item.Title) {
+			continue
+		}
+		seen, err := s.rep.FeedItemAdded(f.Name, item.ID)
+		if err != nil {
+			return err
+		}
+		if seen {
+			continue
+		}
+
+		mi, err := s.feedMetainfo(ctx, item)
+		if err != nil {
+			s.log.Warn("error fetching feed item torrent", "feed", f.Name, "item", item.Title, "error", err)
+			continue
+		}
+		info, err := mi.UnmarshalInfo()
+		if err != nil {
+			s.log.Warn("invalid feed item torrent", "feed", f.Name, "item", item.Title, "error", err)
+			continue
+		}
+
+		torrentFile, err := saveTorrentFile(mi, info.BestName(), dir)
+		if err != nil {
+			return err
+		}
+		err = s.rep.AddFeedItem(f.Name, storage.FeedItem{
+			ID:          item.ID,
+			Title:       item.Title,
+			TorrentFile: torrentFile,
+			Added:       time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+		s.log.Info("feed item added", "feed", f.Name, "item", item.Title, "infohash", mi.HashInfoBytes().HexString())
+	}
+
+	return nil
+}
+
+// feedMetainfo downloads torrent file of the item or fetches metainfo of its magnet from peers
+func (s *Service) feedMetainfo(ctx context.Context, item feed.Item) (*metainfo.MetaInfo, error) {
+	if item.IsMagnet() {
+		return s.magnetMetainfo(ctx, item.Link)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, item.Link, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := feedClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading torrent file: %s", resp.Status)
+	}
+	return metainfo.Load(io.LimitReader(resp.Body, maxTorrentFileSize))
+}
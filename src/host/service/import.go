@@ -0,0 +1,155 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"git.kmsign.ru/royalcat/tstor/src/host/storage"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+var ErrImportUnsupported = errors.New("storage doesn't support import")
+
+type ImportSource struct {
+	// Torrent is a content of torrent file, Magnet is used if it is empty
+	Torrent []byte
+	Magnet  string
+	// Dir is a local directory with downloaded data
+	Dir  string
+	Mode storage.ImportMode
+}
+
+type ImportResult struct {
+	InfoHash string `json:"infohash"`
+	Name     string `json:"name"`
+	// TorrentFile is a path the torrent file was saved to
+	TorrentFile string `json:"torrentFile"`
+
+	storage.ImportReport
+}
+
+// ImportTorrent adopts data downloaded by other clients, verified pieces are not downloaded again.
+// Torrent file is saved into torrentsDir, so torrent appears in filesystem.
+func (s *Service) ImportTorrent(ctx context.Context, src ImportSource, torrentsDir string) (*ImportResult, error) {
+	if s.importer == nil {
+		return nil, ErrImportUnsupported
+	}
+	if !src.Mode.Valid() {
+		return nil, fmt.Errorf("unknown import mode: %s", src.Mode)
+	}
+	if _, err := os.Stat(src.Dir); err != nil {
+		return nil, err
+	}
+
+	mi, err := s.importMetainfo(ctx, src)
+	if err != nil {
+		return nil, err
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return nil, err
+	}
+	hash := mi.HashInfoBytes()
+
+	report, err := s.importer.Import(ctx, &info, hash, src.Dir, src.Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	// loaded torrent must read completion imported into storage
+	if t, ok := s.c.Torrent(hash); ok {
+		for i := 0; i < t.NumPieces(); i++ {
+			t.Piece(i).UpdateCompletion()
+		}
+	}
+
+	torrentFile, err := saveTorrentFile(mi, info.BestName(), torrentsDir)
+	if err != nil {
+		return nil, err
+	}
+	s.log.Info("torrent imported", "infohash", hash.HexString(), "verified", report.Verified, "pieces", report.Pieces)
+
+	return &ImportResult{
+		InfoHash:     hash.HexString(),
+		Name:         info.BestName(),
+		TorrentFile:  torrentFile,
+		ImportReport: *report,
+	}, nil
+}
+
+// importMetainfo loads torrent file or fetches metainfo of magnet from peers
+func (s *Service) importMetainfo(ctx context.Context, src ImportSource) (*metainfo.MetaInfo, error) {
+	if len(src.Torrent) != 0 {
+		return metainfo.Load(bytes.NewReader(src.Torrent))
+	}
+	if src.Magnet == "" {
+		return nil, errors.New("torrent file or magnet is required")
+	}
+	return s.magnetMetainfo(ctx, src.Magnet)
+}
+
+// magnetMetainfo fetches metainfo of magnet from peers, torrent is not kept loaded
+func (s *Service) magnetMetainfo(ctx context.Context, magnet string) (*metainfo.MetaInfo, error) {
+	spec, err := metainfo.ParseMagnetUri(magnet)
+	if err != nil {
+		return nil, err
+	}
+	_, loaded := s.c.Torrent(spec.InfoHash)
+
+	t, err := s.c.AddMagnet(magnet)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(s.addTimeout))
+	defer cancel()
+	select {
+	case <-ctx.Done():
+		if !loaded {
+			t.Drop()
+		}
+		return nil, fmt.Errorf("fetching magnet metainfo timed out")
+	case <-t.GotInfo():
+	}
+
+	mi := t.Metainfo()
+	if !loaded {
+		// torrent is loaded again from saved torrent file
+		t.Drop()
+	}
+	return &mi, nil
+}
+
+func saveTorrentFile(mi *metainfo.MetaInfo, name string, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0744); err != nil {
+		return "", err
+	}
+
+	name = strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+	if name == "" || name == "." || name == ".." {
+		name = mi.HashInfoBytes().HexString()
+	}
+
+	p := filepath.Join(dir, name+".torrent")
+	if existing, err := metainfo.LoadFromFile(p); err == nil && existing.HashInfoBytes() == mi.HashInfoBytes() {
+		return p, nil
+	} else if err == nil {
+		p = filepath.Join(dir, name+" ("+mi.HashInfoBytes().HexString()[:8]+").torrent")
+	}
+
+	f, err := os.Create(p)
+	if err != nil {
+		return "", err
+	}
+	if err := mi.Write(f); err != nil {
+		f.Close()
+		return "", err
+	}
+	return p, f.Close()
+}
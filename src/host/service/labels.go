@@ -0,0 +1,88 @@
+package service
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"git.kmsign.ru/royalcat/tstor/src/host/storage"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+type Category struct {
+	Name     string `json:"name"`
+	Priority int    `json:"priority"`
+	// Seeding policy of the category, nil if global policy is used
+	Seeding *storage.SeedingPolicy `json:"seeding,omitempty"`
+}
+
+// Categories lists categories from config, torrents can have categories not listed there
+func (s *Service) Categories() []Category {
+	out := make([]Category, 0, len(s.categories))
+	for _, c := range s.categories {
+		cat := Category{
+			Name:     c.Name,
+			Priority: c.Priority,
+		}
+		if c.Seeding != nil {
+			p := *c.Seeding
+			cat.Seeding = &p
+		}
+		out = append(out, cat)
+	}
+	slices.SortFunc(out, func(a, b Category) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return out
+}
+
+func (s *Service) Labels(hash metainfo.Hash) (storage.Labels, error) {
+	return s.rep.Labels(hash)
+}
+
+func (s *Service) ListLabels() (map[metainfo.Hash]storage.Labels, error) {
+	return s.rep.ListLabels()
+}
+
+// SetLabels replaces torrent labels, torrent doesn't have to be loaded.
+// Queue position and seeding policy of loaded torrent are updated by its new category
+func (s *Service) SetLabels(hash metainfo.Hash, l storage.Labels) error {
+	tags := make([]string, 0, len(l.Tags))
+	for _, tag := range l.Tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		if !validDirName(tag) {
+			return fmt.Errorf("invalid tag: %q", tag)
+		}
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	slices.Sort(tags)
+	l.Tags = tags
+	l.Category = strings.TrimSpace(l.Category)
+	if l.Category != "" && !validDirName(l.Category) {
+		return fmt.Errorf("invalid category: %q", l.Category)
+	}
+
+	if err := s.rep.SetLabels(hash, l); err != nil {
+		return err
+	}
+
+	s.queue.setPriority(hash, s.categories[l.Category].Priority)
+	s.updateQueue()
+
+	t, ok := s.c.Torrent(hash)
+	if !ok {
+		return nil
+	}
+	return s.applySeedingState(t)
+}
+
+// validDirName reports whether tag, category or saved search name can be used as a directory name in views
+func validDirName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, "/\\")
+}
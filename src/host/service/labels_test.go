@@ -0,0 +1,34 @@
+package service
+
+import (
+	"testing"
+
+	"git.kmsign.ru/royalcat/tstor/src/config"
+	"git.kmsign.ru/royalcat/tstor/src/host/storage"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetLabels(t *testing.T) {
+	require := require.New(t)
+
+	s := newTestService(t, config.TorrentClient{})
+
+	// torrent doesn't have to be loaded
+	hash := metainfo.Hash{1}
+	require.NoError(s.SetLabels(hash, storage.Labels{Category: " movies ", Tags: []string{"b", " a", "", "b"}}))
+	l, err := s.Labels(hash)
+	require.NoError(err)
+	require.Equal(storage.Labels{Category: "movies", Tags: []string{"a", "b"}}, l)
+
+	for _, name := range []string{"a/b", "a\\b", ".", ".."} {
+		require.Error(s.SetLabels(hash, storage.Labels{Tags: []string{name}}), name)
+		require.Error(s.SetLabels(hash, storage.Labels{Category: name}), name)
+	}
+
+	to := addTestTorrent(t, s, "loaded", true)
+	require.NoError(s.SetLabels(to.InfoHash(), storage.Labels{Category: "movies"}))
+	l, err = s.Labels(to.InfoHash())
+	require.NoError(err)
+	require.Equal("movies", l.Category)
+}
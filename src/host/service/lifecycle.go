@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"git.kmsign.ru/royalcat/tstor/src/host/vfs"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+const lifecycleInterval = time.Minute
+
+// RunLifecycle drops torrents which source files were removed and unloads torrents
+// not accessed for idleTimeout, 0 disables idle unloading. Pinned torrents are not unloaded.
+// Unloaded torrents are evicted from rfs, so they are loaded again on next access.
+func (s *Service) RunLifecycle(ctx context.Context, rfs *vfs.ResolveFS, idleTimeout time.Duration) {
+	ticker := time.NewTicker(lifecycleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		s.dropMissing(rfs)
+
+		if idleTimeout > 0 {
+			s.unloadIdle(rfs, idleTimeout)
+		}
+	}
+}
+
+func (s *Service) dropMissing(rfs *vfs.ResolveFS) {
+	for _, fs := range rfs.EvictMissing() {
+		tfs, ok := fs.(*vfs.TorrentFs)
+		if !ok {
+			continue
+		}
+
+		hash := tfs.InfoHash()
+		err := s.dropEvicted(rfs, tfs)
+		switch {
+		case err == nil:
+			s.log.Info("torrent file removed, torrent dropped", "hash", hash.HexString())
+		case err != errTorrentInUse && err != ErrTorrentNotFound:
+			s.log.Error("error dropping torrent", "hash", hash.HexString(), "error", err)
+		}
+	}
+}
+
+// dropEvicted drops torrent of tfs evicted from rfs. Torrent loaded from other torrent file,
+// e.g. renamed one or a copy, is kept and errTorrentInUse is returned.
+func (s *Service) dropEvicted(rfs *vfs.ResolveFS, tfs *vfs.TorrentFs) error {
+	hash := tfs.InfoHash()
+	if others := loadedTorrentFs(rfs, hash); len(others) > 0 {
+		s.fsMu.Lock()
+		if s.torrentFs[hash] == tfs {
+			s.torrentFs[hash] = others[0]
+		}
+		s.fsMu.Unlock()
+		return errTorrentInUse
+	}
+	return s.dropUnused(tfs, func(*vfs.TorrentFs) bool { return true })
+}
+
+// loadedTorrentFs returns filesystems of torrent cached in rfs, a torrent is loaded
+// from every torrent file with its infohash
+func loadedTorrentFs(rfs *vfs.ResolveFS, hash metainfo.Hash) []*vfs.TorrentFs {
+	var out []*vfs.TorrentFs
+	for _, fs := range rfs.Nested() {
+		if tfs, ok := fs.(*vfs.TorrentFs); ok && tfs.InfoHash() == hash {
+			out = append(out, tfs)
+		}
+	}
+	return out
+}
+
+// errTorrentInUse is returned by dropUnused when torrent is used again
+var errTorrentInUse = errors.New("torrent is in use")
+
+// dropUnused drops torrent of tfs when tfs is still its current filesystem and unused reports true.
+// Check and drop are done under fsMu, so torrent isn't dropped when it is loaded again in between.
+func (s *Service) dropUnused(tfs *vfs.TorrentFs, unused func(*vfs.TorrentFs) bool) error {
+	s.fsMu.Lock()
+	defer s.fsMu.Unlock()
+
+	hash := tfs.InfoHash()
+	if current, ok := s.torrentFs[hash]; ok && current != tfs {
+		return errTorrentInUse
+	}
+	if !unused(tfs) {
+		return errTorrentInUse
+	}
+	return s.dropTorrent(hash)
+}
+
+func (s *Service) unloadIdle(rfs *vfs.ResolveFS, idleTimeout time.Duration) {
+	isIdle := func(tfs *vfs.TorrentFs) bool {
+		// torrent with open files is in use, e.g. paused video
+		return tfs.OpenFiles() == 0 && time.Since(tfs.LastAccess()) > idleTimeout
+	}
+
+	s.fsMu.Lock()
+	idle := map[metainfo.Hash]*vfs.TorrentFs{}
+	for hash, tfs := range s.torrentFs {
+		if isIdle(tfs) {
+			idle[hash] = tfs
+		}
+	}
+	s.fsMu.Unlock()
+
+	for hash := range idle {
+		// pinned torrents are kept loaded
+		if state, err := s.rep.SeedingState(hash); err == nil && state.Pinned {
+			delete(idle, hash)
+		}
+	}
+
+	for hash, tfs := range idle {
+		// torrent can be loaded from several torrent files, it is unloaded when all of them are idle
+		loaded := append(loadedTorrentFs(rfs, hash), tfs)
+		allIdle := func(*vfs.TorrentFs) bool {
+			for _, tfs := range loaded {
+				if !isIdle(tfs) {
+					return false
+				}
+			}
+			return true
+		}
+		if !allIdle(tfs) {
+			continue
+		}
+
+		s.log.Info("unloading idle torrent", "hash", hash.HexString(), "lastAccess", tfs.LastAccess())
+
+		// evicted before drop, resolver lock is taken before fsMu when filesystem is created.
+		// Torrent accessed in between is loaded again and kept
+		for _, tfs := range loaded {
+			rfs.Evict(tfs)
+		}
+		err := s.dropUnused(tfs, allIdle)
+		if err == errTorrentInUse {
+			s.log.Info("idle torrent is in use again, keeping it", "hash", hash.HexString())
+		} else if err != nil && err != ErrTorrentNotFound {
+			s.log.Error("error unloading torrent", "hash", hash.HexString(), "error", err)
+		}
+	}
+}
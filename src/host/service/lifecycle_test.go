@@ -0,0 +1,65 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"git.kmsign.ru/royalcat/tstor/src/config"
+	"git.kmsign.ru/royalcat/tstor/src/host/vfs"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDropMissingSharedInfoHash(t *testing.T) {
+	require := require.New(t)
+
+	s := newTestService(t, config.TorrentClient{})
+
+	dir := t.TempDir()
+	info := metainfo.Info{
+		Name:        "data.bin",
+		PieceLength: 16 * 1024,
+		Length:      100,
+		Pieces:      make([]byte, 20),
+	}
+	infoBytes, err := bencode.Marshal(info)
+	require.NoError(err)
+	mi := metainfo.MetaInfo{InfoBytes: infoBytes}
+	hash := mi.HashInfoBytes()
+	// two torrent files of the same torrent
+	for _, name := range []string{"a.torrent", "b.torrent"} {
+		f, err := os.Create(filepath.Join(dir, name))
+		require.NoError(err)
+		require.NoError(mi.Write(f))
+		require.NoError(f.Close())
+	}
+
+	rfs := vfs.NewResolveFS(vfs.NewOsFs(dir), map[string]vfs.FsFactory{
+		".torrent": s.NewTorrentFs,
+	})
+	for _, p := range []string{"/a.torrent", "/b.torrent"} {
+		_, err := rfs.ReadDir(p)
+		require.NoError(err)
+	}
+
+	// torrent is kept while other torrent file is loaded
+	require.NoError(os.Remove(filepath.Join(dir, "b.torrent")))
+	s.dropMissing(rfs)
+	to, ok := s.c.Torrent(hash)
+	require.True(ok)
+	f, err := rfs.Open("/a.torrent/data.bin")
+	require.NoError(err)
+	require.NoError(f.Close())
+	s.fsMu.Lock()
+	current := s.torrentFs[hash]
+	s.fsMu.Unlock()
+	require.Equal([]*vfs.TorrentFs{current}, loadedTorrentFs(rfs, hash))
+
+	require.NoError(os.Remove(filepath.Join(dir, "a.torrent")))
+	s.dropMissing(rfs)
+	_, ok = s.c.Torrent(hash)
+	require.False(ok)
+	<-to.Closed()
+}
@@ -0,0 +1,324 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"git.kmsign.ru/royalcat/tstor/src/host/storage"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/tracker"
+	"github.com/anacrolix/torrent/types/infohash"
+)
+
+type PeerInfo struct {
+	Address string `json:"address"`
+	Network string `json:"network"`
+	Client  string `json:"client"`
+	// Source is a way peer was discovered, e.g. Tr for tracker, Hg for DHT, X for PEX
+	Source string `json:"source"`
+	// DownloadRate is an average rate of useful data received from peer in bytes per second,
+	// anacrolix client doesn't expose upload rate per peer
+	DownloadRate      float64 `json:"downloadRate"`
+	PrefersEncryption bool    `json:"prefersEncryption"`
+	Pieces            uint64  `json:"pieces"`
+	Banned            bool    `json:"banned"`
+}
+
+// Peers lists peers currently connected for the torrent
+func (s *Service) Peers(hash metainfo.Hash) ([]PeerInfo, error) {
+	t, ok := s.c.Torrent(hash)
+	if !ok {
+		return nil, ErrTorrentNotFound
+	}
+
+	conns := t.PeerConns()
+	out := make([]PeerInfo, 0, len(conns))
+	for _, pc := range conns {
+		client, _ := pc.PeerClientName.Load().(string)
+		info := PeerInfo{
+			Address:           pc.RemoteAddr.String(),
+			Network:           pc.Network,
+			Client:            client,
+			Source:            string(pc.Discovery),
+			DownloadRate:      pc.DownloadRate(),
+			PrefersEncryption: pc.PeerPrefersEncryption,
+			Pieces:            pc.PeerPieces().GetCardinality(),
+		}
+		if ip := peerIP(pc.RemoteAddr); ip != nil {
+			info.Banned = s.ipFilter.IsBlocked(ip)
+		}
+		out = append(out, info)
+	}
+
+	slices.SortFunc(out, func(a, b PeerInfo) int {
+		switch {
+		case a.DownloadRate > b.DownloadRate:
+			return -1
+		case a.DownloadRate < b.DownloadRate:
+			return 1
+		}
+		return 0
+	})
+
+	return out, nil
+}
+
+func peerIP(addr torrent.PeerRemoteAddr) net.IP {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
+
+// BanPeer blocks connections with the address for all torrents and closes established ones.
+// anacrolix client can't close a single connection, so torrents connected to the address
+// drop all their connections and other peers are added again to be reconnected.
+func (s *Service) BanPeer(addr netip.Addr) error {
+	if err := s.ipFilter.Ban(addr); err != nil {
+		return err
+	}
+
+	addr = addr.Unmap()
+	for _, t := range s.c.Torrents() {
+		banned := false
+		var others []torrent.PeerInfo
+		for _, pc := range t.PeerConns() {
+			if ip, ok := netip.AddrFromSlice(peerIP(pc.RemoteAddr)); ok && ip.Unmap() == addr {
+				banned = true
+				continue
+			}
+			// remote address of incoming connection isn't a listen address, such peers connect again themselves
+			others = append(others, torrent.PeerInfo{
+				Addr:               pc.RemoteAddr,
+				Source:             pc.Discovery,
+				SupportsEncryption: pc.PeerPrefersEncryption,
+			})
+		}
+		if !banned {
+			continue
+		}
+
+		t.SetMaxEstablishedConns(t.SetMaxEstablishedConns(0))
+		t.AddPeers(others)
+	}
+	return nil
+}
+
+func (s *Service) UnbanPeer(addr netip.Addr) error {
+	return s.ipFilter.Unban(addr)
+}
+
+func (s *Service) BannedPeers() []netip.Addr {
+	return s.ipFilter.Banned()
+}
+
+func (s *Service) BlocklistStats() storage.BlocklistStats {
+	return s.ipFilter.Stats()
+}
+
+// ReloadBlocklist reads blocklist files again, new connections are checked against updated list
+func (s *Service) ReloadBlocklist() error {
+	return s.ipFilter.ReloadBlocklist()
+}
+
+// TrackerInfo is a tracker of torrent with swarm info scraped when trackers are listed.
+// Last announce isn't reported by the API: anacrolix/torrent keeps announce results private
+// to its tracker announcers and doesn't report them with callbacks.
+type TrackerInfo struct {
+	URL       string    `json:"url"`
+	Tier      int       `json:"tier"`
+	Seeders   int32     `json:"seeders"`
+	Leechers  int32     `json:"leechers"`
+	Completed int32     `json:"completed"`
+	Scraped   time.Time `json:"scraped,omitempty"`
+	// Error is an error of the scrape
+	Error string `json:"error,omitempty"`
+}
+
+const (
+	scrapeTimeout = 10 * time.Second
+	// scrapeInterval is a minimal interval between scrapes of a tracker for a torrent,
+	// trackers are listed on every refresh of the web UI
+	scrapeInterval = 5 * time.Minute
+)
+
+type scrapeKey struct {
+	hash metainfo.Hash
+	url  string
+}
+
+type scrapeResult struct {
+	seeders, completed, leechers int32
+	err                          error
+	// at is a time of the scrape, failed scrapes are cached too
+	at time.Time
+}
+
+// scrapeCache keeps results of recent scrapes, so trackers aren't scraped on every listing
+type scrapeCache struct {
+	mu      sync.Mutex
+	results map[scrapeKey]scrapeResult
+}
+
+func newScrapeCache() *scrapeCache {
+	return &scrapeCache{results: map[scrapeKey]scrapeResult{}}
+}
+
+// get returns result scraped less than scrapeInterval ago
+func (c *scrapeCache) get(k scrapeKey) (scrapeResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r, ok := c.results[k]
+	if !ok || time.Since(r.at) >= scrapeInterval {
+		return scrapeResult{}, false
+	}
+	return r, true
+}
+
+func (c *scrapeCache) set(k scrapeKey, r scrapeResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// expired results of removed trackers and dropped torrents are forgotten
+	for k, r := range c.results {
+		if time.Since(r.at) >= scrapeInterval {
+			delete(c.results, k)
+		}
+	}
+	c.results[k] = r
+}
+
+// Trackers lists trackers torrent announces to with swarm info scraped from each tracker,
+// a tracker is scraped again only if the last scrape is older than scrapeInterval
+func (s *Service) Trackers(ctx context.Context, hash metainfo.Hash) ([]TrackerInfo, error) {
+	t, ok := s.c.Torrent(hash)
+	if !ok {
+		return nil, ErrTorrentNotFound
+	}
+
+	o, err := s.rep.TrackerOverrides(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	mi := t.Metainfo()
+	var out []TrackerInfo
+	for tier, urls := range o.Apply(mi.UpvertedAnnounceList()) {
+		for _, url := range urls {
+			out = append(out, TrackerInfo{
+				URL:  url,
+				Tier: tier,
+			})
+		}
+	}
+
+	scrapeCtx, cancel := context.WithTimeout(ctx, scrapeTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := range out {
+		wg.Add(1)
+		go func(ti *TrackerInfo) {
+			defer wg.Done()
+			k := scrapeKey{hash: hash, url: ti.URL}
+			res, ok := s.scrapes.get(k)
+			if !ok {
+				res = scrape(scrapeCtx, ti.URL, hash)
+				// scrape interrupted by canceled request isn't cached, timed out one is
+				if ctx.Err() == nil {
+					s.scrapes.set(k, res)
+				}
+			}
+			if res.err != nil {
+				ti.Error = res.err.Error()
+				return
+			}
+			ti.Seeders = res.seeders
+			ti.Leechers = res.leechers
+			ti.Completed = res.completed
+			ti.Scraped = res.at
+		}(&out[i])
+	}
+	wg.Wait()
+
+	return out, nil
+}
+
+func scrape(ctx context.Context, url string, hash metainfo.Hash) scrapeResult {
+	res := scrapeResult{at: time.Now()}
+
+	cl, err := tracker.NewClient(url, tracker.NewClientOpts{})
+	if err != nil {
+		res.err = err
+		return res
+	}
+	defer cl.Close()
+
+	resp, err := cl.Scrape(ctx, []infohash.T{hash})
+	if err != nil {
+		res.err = err
+		return res
+	}
+	if len(resp) == 0 {
+		res.err = fmt.Errorf("empty scrape response")
+		return res
+	}
+
+	res.seeders = resp[0].Seeders
+	res.completed = resp[0].Completed
+	res.leechers = resp[0].Leechers
+	return res
+}
+
+// AddTrackers adds trackers to the torrent, change is persisted and applied on next torrent load
+func (s *Service) AddTrackers(hash metainfo.Hash, urls []string) error {
+	t, ok := s.c.Torrent(hash)
+	if !ok {
+		return ErrTorrentNotFound
+	}
+
+	o, err := s.rep.TrackerOverrides(hash)
+	if err != nil {
+		return err
+	}
+	for _, url := range urls {
+		o.Removed = slices.DeleteFunc(o.Removed, func(r string) bool { return r == url })
+		if !slices.Contains(o.Added, url) {
+			o.Added = append(o.Added, url)
+		}
+	}
+	err = s.rep.SetTrackerOverrides(hash, o)
+	if err != nil {
+		return err
+	}
+
+	t.AddTrackers([][]string{urls})
+	return nil
+}
+
+// RemoveTracker removes tracker from the torrent, anacrolix client can't stop announcing
+// to a tracker of loaded torrent, so it takes effect after the torrent is loaded again.
+func (s *Service) RemoveTracker(hash metainfo.Hash, url string) error {
+	if _, ok := s.c.Torrent(hash); !ok {
+		return ErrTorrentNotFound
+	}
+
+	o, err := s.rep.TrackerOverrides(hash)
+	if err != nil {
+		return err
+	}
+	o.Added = slices.DeleteFunc(o.Added, func(a string) bool { return a == url })
+	if !slices.Contains(o.Removed, url) {
+		o.Removed = append(o.Removed, url)
+	}
+
+	return s.rep.SetTrackerOverrides(hash, o)
+}
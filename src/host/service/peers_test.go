@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"git.kmsign.ru/royalcat/tstor/src/config"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestLeecher creates client downloading the torrent without any data, so it stays connected
+// to other peers of the torrent
+func newTestLeecher(t *testing.T, to *torrent.Torrent) *torrent.Client {
+	require := require.New(t)
+
+	cfg := torrent.NewDefaultClientConfig()
+	cfg.DataDir = t.TempDir()
+	cfg.ListenPort = 0
+	cfg.NoDHT = true
+	cfg.DisableTrackers = true
+	c, err := torrent.NewClient(cfg)
+	require.NoError(err)
+	t.Cleanup(func() { c.Close() })
+
+	mi := to.Metainfo()
+	spec, err := torrent.TorrentSpecFromMetaInfoErr(&mi)
+	require.NoError(err)
+	lt, _, err := c.AddTorrentSpec(spec)
+	require.NoError(err)
+	lt.DownloadAll()
+	return c
+}
+
+func TestPeersBanPeer(t *testing.T) {
+	require := require.New(t)
+
+	s := newTestService(t, config.TorrentClient{})
+	to := addTestTorrent(t, s, "peers", false)
+	to.DownloadAll()
+	leecher := newTestLeecher(t, to)
+	// leecher is added with IPv4 address only, AddClientPeer adds addresses of all its listeners
+	leecherAddr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: leecher.LocalPort()}
+	addLeecher := func() { to.AddPeers([]torrent.PeerInfo{{Addr: leecherAddr}}) }
+	addLeecher()
+
+	require.Eventually(func() bool {
+		return len(to.PeerConns()) == 1
+	}, 10*time.Second, 10*time.Millisecond)
+
+	peers, err := s.Peers(to.InfoHash())
+	require.NoError(err)
+	require.Len(peers, 1)
+	addr, err := netip.ParseAddrPort(peers[0].Address)
+	require.NoError(err)
+	require.Equal(leecher.LocalPort(), int(addr.Port()))
+	require.False(peers[0].Banned)
+
+	// established connection is closed and the address isn't connected again
+	require.NoError(s.BanPeer(addr.Addr()))
+	require.Contains(s.BannedPeers(), addr.Addr())
+	require.Empty(to.PeerConns())
+	addLeecher()
+	require.Never(func() bool {
+		return len(to.PeerConns()) > 0
+	}, 200*time.Millisecond, 10*time.Millisecond)
+
+	require.NoError(s.UnbanPeer(addr.Addr()))
+	addLeecher()
+	require.Eventually(func() bool {
+		return len(to.PeerConns()) == 1
+	}, 10*time.Second, 10*time.Millisecond)
+}
+
+func TestTrackersScrapeCached(t *testing.T) {
+	require := require.New(t)
+
+	s := newTestService(t, config.TorrentClient{})
+	to := addTestTorrent(t, s, "trackers", false)
+
+	var scrapes atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/scrape" {
+			http.NotFound(w, r)
+			return
+		}
+		scrapes.Add(1)
+		ih := to.InfoHash()
+		bencode.NewEncoder(w).Encode(map[string]any{
+			"files": map[string]any{
+				string(ih[:]): map[string]int{"complete": 3, "incomplete": 2, "downloaded": 7},
+			},
+		})
+	}))
+	t.Cleanup(srv.Close)
+
+	url := srv.URL + "/announce"
+	require.NoError(s.AddTrackers(to.InfoHash(), []string{url}))
+
+	for i := 0; i < 3; i++ {
+		trackers, err := s.Trackers(context.Background(), to.InfoHash())
+		require.NoError(err)
+		require.Len(trackers, 1)
+		tr := trackers[0]
+		require.Equal(url, tr.URL)
+		require.Empty(tr.Error)
+		require.Equal(int32(3), tr.Seeders)
+		require.Equal(int32(2), tr.Leechers)
+		require.Equal(int32(7), tr.Completed)
+		require.False(tr.Scraped.IsZero())
+	}
+	require.Equal(int32(1), scrapes.Load())
+
+	_, err := s.Trackers(context.Background(), [20]byte{1})
+	require.ErrorIs(err, ErrTorrentNotFound)
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"path"
+	"slices"
+	"strings"
+
+	"git.kmsign.ru/royalcat/tstor/src/config"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/types"
+)
+
+// prefetchRule is a config.Prefetch with sizes in bytes
+type prefetchRule struct {
+	extensions []string
+	head, tail int64
+}
+
+func newPrefetchRules(cfg []config.Prefetch) []prefetchRule {
+	rules := make([]prefetchRule, 0, len(cfg))
+	for _, p := range cfg {
+		r := prefetchRule{
+			head: int64(p.Head) * 1024,
+			tail: int64(p.Tail) * 1024,
+		}
+		for _, ext := range p.Extensions {
+			ext = strings.ToLower(ext)
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			r.extensions = append(r.extensions, ext)
+		}
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// prefetchRuleFor returns first rule matching file name
+func prefetchRuleFor(rules []prefetchRule, name string) (prefetchRule, bool) {
+	ext := strings.ToLower(path.Ext(name))
+	for _, r := range rules {
+		if len(r.extensions) == 0 || slices.Contains(r.extensions, ext) {
+			return r, true
+		}
+	}
+	return prefetchRule{}, false
+}
+
+// prefetch raises priority of pieces at start and end of files, where media containers and archives
+// keep their headers and indexes, so directory listing and playback start without waiting for them.
+// Torrent info must be available.
+func (s *Service) prefetch(t *torrent.Torrent) {
+	if len(s.prefetchRules) == 0 {
+		return
+	}
+
+	excluded, err := s.rep.ExcludedFiles(t.InfoHash())
+	if err != nil {
+		s.log.Error("error listing excluded files", "hash", t.InfoHash().HexString(), "error", err)
+		return
+	}
+
+	files := make([]prefetchFile, 0, len(t.Files()))
+	for _, f := range t.Files() {
+		files = append(files, prefetchFile{path: f.Path(), offset: f.Offset(), length: f.Length()})
+	}
+	pieces := prefetchPieces(s.prefetchRules, files, t.Info().PieceLength, excluded)
+
+	for _, i := range pieces {
+		t.Piece(i).SetPriority(types.PiecePriorityHigh)
+	}
+	if len(pieces) > 0 {
+		s.log.Debug("prefetching file headers", "hash", t.InfoHash().HexString(), "pieces", len(pieces))
+	}
+}
+
+// prefetchFile is a torrent file position in torrent data
+type prefetchFile struct {
+	path           string
+	offset, length int64
+}
+
+// prefetchPieces returns sorted indexes of pieces covering head and tail of files matching rules,
+// empty and excluded files are skipped
+func prefetchPieces(rules []prefetchRule, files []prefetchFile, pieceLength int64, excluded []string) []int {
+	pieces := map[int]struct{}{}
+	for _, f := range files {
+		if f.length == 0 || slices.Contains(excluded, f.path) {
+			continue
+		}
+		r, ok := prefetchRuleFor(rules, f.path)
+		if !ok {
+			continue
+		}
+
+		begin, end := f.offset, f.offset+f.length
+		if r.head > 0 {
+			for i := begin / pieceLength; i*pieceLength < min(begin+r.head, end); i++ {
+				pieces[int(i)] = struct{}{}
+			}
+		}
+		if r.tail > 0 {
+			for i := max(end-r.tail, begin) / pieceLength; i*pieceLength < end; i++ {
+				pieces[int(i)] = struct{}{}
+			}
+		}
+	}
+
+	out := make([]int, 0, len(pieces))
+	for i := range pieces {
+		out = append(out, i)
+	}
+	slices.Sort(out)
+	return out
+}
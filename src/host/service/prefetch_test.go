@@ -0,0 +1,71 @@
+package service
+
+import (
+	"testing"
+
+	"git.kmsign.ru/royalcat/tstor/src/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefetchPieces(t *testing.T) {
+	const pieceLength = 1024
+
+	// 2KiB of head and 1KiB of tail of mkv files, 1KiB of head of any other file
+	rules := newPrefetchRules([]config.Prefetch{
+		{Extensions: []string{"MKV"}, Head: 2, Tail: 1},
+		{Head: 1},
+	})
+
+	tests := []struct {
+		name     string
+		files    []prefetchFile
+		excluded []string
+		want     []int
+	}{
+		{
+			name:  "head and tail",
+			files: []prefetchFile{{path: "a.mkv", offset: 0, length: 10 * pieceLength}},
+			want:  []int{0, 1, 9},
+		},
+		{
+			name:  "head ends at piece boundary",
+			files: []prefetchFile{{path: "a.txt", offset: pieceLength, length: 4 * pieceLength}},
+			want:  []int{1},
+		},
+		{
+			name:  "file not aligned to pieces",
+			files: []prefetchFile{{path: "a.mkv", offset: pieceLength - 1, length: 5 * pieceLength}},
+			want:  []int{0, 1, 2, 4, 5},
+		},
+		{
+			name:  "file smaller than head and tail",
+			files: []prefetchFile{{path: "a.mkv", offset: 3 * pieceLength, length: 100}},
+			want:  []int{3},
+		},
+		{
+			name: "zero length file",
+			files: []prefetchFile{
+				{path: "empty.mkv", offset: 2 * pieceLength, length: 0},
+				{path: "a.mkv", offset: 2 * pieceLength, length: 3 * pieceLength},
+			},
+			want: []int{2, 3, 4},
+		},
+		{
+			name: "excluded file",
+			files: []prefetchFile{
+				{path: "dir/a.mkv", offset: 0, length: 10 * pieceLength},
+				{path: "dir/b.txt", offset: 10 * pieceLength, length: 10 * pieceLength},
+			},
+			excluded: []string{"dir/a.mkv"},
+			want:     []int{10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, prefetchPieces(rules, tt.files, pieceLength, tt.excluded))
+		})
+	}
+
+	require.Empty(t, prefetchPieces(nil, []prefetchFile{{path: "a.mkv", length: pieceLength}}, pieceLength, nil))
+}
@@ -0,0 +1,310 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/types"
+)
+
+const queueInterval = 10 * time.Second
+
+// promoteInterval limits queue updates caused by reads of a torrent waiting in queue,
+// reads are reported on every ReadAt
+const promoteInterval = time.Second
+
+type QueueState string
+
+const (
+	QueueActive   QueueState = "active"
+	QueueQueued   QueueState = "queued"
+	QueuePaused   QueueState = "paused"
+	QueueComplete QueueState = "complete"
+)
+
+type QueueEntry struct {
+	Hash string `json:"hash"`
+	Name string `json:"name"`
+	// Position in the queue starting from 0, complete and paused torrents keep their positions
+	Position int        `json:"position"`
+	State    QueueState `json:"state"`
+}
+
+// downloadQueue limits number of torrents downloading at the same time,
+// torrents are started in order of their category priority and addition until they are read from.
+type downloadQueue struct {
+	// updateMu serializes selection of active torrents
+	updateMu sync.Mutex
+
+	mu sync.Mutex
+	// maxActive is a limit of downloading torrents, 0 means unlimited
+	maxActive int
+	order     []metainfo.Hash
+	active    map[metainfo.Hash]bool
+	// priority of torrent category, torrents with higher priority are placed before others
+	priority map[metainfo.Hash]int
+	// read are times torrents waiting in queue were last promoted by reads
+	read map[metainfo.Hash]time.Time
+}
+
+func newDownloadQueue(maxActive int) *downloadQueue {
+	return &downloadQueue{
+		maxActive: maxActive,
+		active:    map[metainfo.Hash]bool{},
+		priority:  map[metainfo.Hash]int{},
+		read:      map[metainfo.Hash]time.Time{},
+	}
+}
+
+// push adds torrent to the queue after torrents with the same or higher priority
+func (q *downloadQueue) push(hash metainfo.Hash, priority int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if slices.Contains(q.order, hash) {
+		return
+	}
+	q.insert(hash, priority)
+}
+
+// setPriority changes torrent priority and moves it to a position according to it
+func (q *downloadQueue) setPriority(hash metainfo.Hash, priority int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	i := slices.Index(q.order, hash)
+	if i < 0 || q.priority[hash] == priority {
+		return
+	}
+	q.order = slices.Delete(q.order, i, i+1)
+	q.insert(hash, priority)
+}
+
+// insert must be called with lock held
+func (q *downloadQueue) insert(hash metainfo.Hash, priority int) {
+	i := len(q.order)
+	for i > 0 && q.priority[q.order[i-1]] < priority {
+		i--
+	}
+	q.order = slices.Insert(q.order, i, hash)
+	q.priority[hash] = priority
+}
+
+func (q *downloadQueue) remove(hash metainfo.Hash) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.order = slices.DeleteFunc(q.order, func(h metainfo.Hash) bool { return h == hash })
+	delete(q.active, hash)
+	delete(q.priority, hash)
+	delete(q.read, hash)
+}
+
+// markRead records read of the torrent, it returns false if the torrent was read less than promoteInterval ago
+func (q *downloadQueue) markRead(hash metainfo.Hash, now time.Time) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if now.Sub(q.read[hash]) < promoteInterval {
+		return false
+	}
+	q.read[hash] = now
+	return true
+}
+
+// readRecently reports whether torrent was promoted by a read since the last queue check
+func (q *downloadQueue) readRecently(hash metainfo.Hash) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return time.Since(q.read[hash]) < queueInterval
+}
+
+// moveToFront returns false if torrent is already first or not in queue
+func (q *downloadQueue) moveToFront(hash metainfo.Hash) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	i := slices.Index(q.order, hash)
+	if i <= 0 {
+		return false
+	}
+	copy(q.order[1:i+1], q.order[:i])
+	q.order[0] = hash
+	return true
+}
+
+func (q *downloadQueue) isActive(hash metainfo.Hash) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.maxActive <= 0 {
+		return true
+	}
+	return q.active[hash]
+}
+
+func (q *downloadQueue) snapshot() []metainfo.Hash {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return slices.Clone(q.order)
+}
+
+// Queue returns download queue in its order
+func (s *Service) Queue() ([]QueueEntry, error) {
+	order := s.queue.snapshot()
+	out := make([]QueueEntry, 0, len(order))
+	for i, hash := range order {
+		t, ok := s.c.Torrent(hash)
+		if !ok {
+			continue
+		}
+		state, err := s.queueState(t)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, QueueEntry{
+			Hash:     hash.HexString(),
+			Name:     t.Name(),
+			Position: i,
+			State:    state,
+		})
+	}
+
+	return out, nil
+}
+
+func (s *Service) queueState(t *torrent.Torrent) (QueueState, error) {
+	state, err := s.rep.SeedingState(t.InfoHash())
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case state.Paused:
+		return QueuePaused, nil
+	case t.Info() != nil && t.BytesMissing() == 0:
+		return QueueComplete, nil
+	case s.queue.isActive(t.InfoHash()):
+		return QueueActive, nil
+	default:
+		return QueueQueued, nil
+	}
+}
+
+// promote moves torrent being read to the front of the queue, so it starts downloading
+// even if download limit is reached
+func (s *Service) promote(hash metainfo.Hash) {
+	if s.queue.maxActive <= 0 || s.queue.isActive(hash) {
+		return
+	}
+	if !s.queue.markRead(hash, time.Now()) {
+		return
+	}
+
+	if s.queue.moveToFront(hash) {
+		s.log.Debug("torrent is read, moving it to the front of the queue", "hash", hash.HexString())
+	}
+	s.updateQueue()
+}
+
+// wantsDownload reports whether incomplete torrent has pieces to download, e.g. of open readers
+// or prefetched files. Torrent read recently wants download too, read is reported before
+// torrent reader prioritizes its pieces.
+func (s *Service) wantsDownload(t *torrent.Torrent) bool {
+	if t.Info() == nil || t.BytesMissing() == 0 {
+		return false
+	}
+	if s.queue.readRecently(t.InfoHash()) {
+		return true
+	}
+	for _, r := range t.PieceStateRuns() {
+		if r.Priority != types.PiecePriorityNone {
+			return true
+		}
+	}
+	// pieces queued for hash check have no priority, wanted files still need them
+	for _, f := range t.Files() {
+		if f.Priority() != types.PiecePriorityNone && f.BytesCompleted() < f.Length() {
+			return true
+		}
+	}
+	return false
+}
+
+// updateQueue selects torrents allowed to download and applies their state,
+// only torrents which want to download take download slots
+func (s *Service) updateQueue() {
+	if s.queue.maxActive <= 0 {
+		return
+	}
+
+	s.queue.updateMu.Lock()
+	defer s.queue.updateMu.Unlock()
+
+	active := map[metainfo.Hash]bool{}
+	for _, hash := range s.queue.snapshot() {
+		if len(active) >= s.queue.maxActive {
+			break
+		}
+		t, ok := s.c.Torrent(hash)
+		if !ok || !s.wantsDownload(t) {
+			continue
+		}
+		state, err := s.rep.SeedingState(hash)
+		if err != nil {
+			s.log.Error("error reading torrent state", "hash", hash.HexString(), "error", err)
+			continue
+		}
+		if state.Paused {
+			continue
+		}
+		active[hash] = true
+	}
+
+	s.queue.mu.Lock()
+	changed := []metainfo.Hash{}
+	for hash := range active {
+		if !s.queue.active[hash] {
+			changed = append(changed, hash)
+		}
+	}
+	for hash := range s.queue.active {
+		if !active[hash] {
+			changed = append(changed, hash)
+		}
+	}
+	s.queue.active = active
+	s.queue.mu.Unlock()
+
+	for _, hash := range changed {
+		t, ok := s.c.Torrent(hash)
+		if !ok {
+			continue
+		}
+		if err := s.applySeedingState(t); err != nil {
+			s.log.Error("error applying torrent state", "hash", hash.HexString(), "error", err)
+		}
+	}
+}
+
+// RunQueue starts queued torrents when downloads complete until ctx is canceled
+func (s *Service) RunQueue(ctx context.Context) {
+	ticker := time.NewTicker(queueInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		s.updateQueue()
+	}
+}
@@ -0,0 +1,243 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"git.kmsign.ru/royalcat/tstor/src/config"
+	"git.kmsign.ru/royalcat/tstor/src/host/storage"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadQueueOrder(t *testing.T) {
+	a, b, c, d := metainfo.Hash{1}, metainfo.Hash{2}, metainfo.Hash{3}, metainfo.Hash{4}
+
+	type push struct {
+		hash     metainfo.Hash
+		priority int
+	}
+	tests := []struct {
+		name   string
+		pushes []push
+		front  metainfo.Hash
+		moved  bool
+		want   []metainfo.Hash
+	}{
+		{
+			name:   "same priority in order of addition",
+			pushes: []push{{a, 0}, {b, 0}, {c, 0}},
+			want:   []metainfo.Hash{a, b, c},
+		},
+		{
+			name:   "higher priority before lower",
+			pushes: []push{{a, 0}, {b, 1}, {c, -1}, {d, 1}},
+			want:   []metainfo.Hash{b, d, a, c},
+		},
+		{
+			name:   "pushed twice keeps position",
+			pushes: []push{{a, 0}, {b, 0}, {a, 5}},
+			want:   []metainfo.Hash{a, b},
+		},
+		{
+			name:   "moved to front before higher priority",
+			pushes: []push{{a, 1}, {b, 1}, {c, 0}},
+			front:  c,
+			moved:  true,
+			want:   []metainfo.Hash{c, a, b},
+		},
+		{
+			name:   "first moved to front",
+			pushes: []push{{a, 0}, {b, 0}},
+			front:  a,
+			want:   []metainfo.Hash{a, b},
+		},
+		{
+			name:   "missing moved to front",
+			pushes: []push{{a, 0}, {b, 0}},
+			front:  d,
+			want:   []metainfo.Hash{a, b},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newDownloadQueue(1)
+			for _, p := range tt.pushes {
+				q.push(p.hash, p.priority)
+			}
+			if tt.front != (metainfo.Hash{}) {
+				assert.Equal(t, tt.moved, q.moveToFront(tt.front))
+			}
+			assert.Equal(t, tt.want, q.snapshot())
+		})
+	}
+
+	q := newDownloadQueue(1)
+	for _, h := range []metainfo.Hash{a, b, c} {
+		q.push(h, 0)
+	}
+	q.setPriority(c, 1)
+	require.Equal(t, []metainfo.Hash{c, a, b}, q.snapshot())
+	q.remove(a)
+	require.Equal(t, []metainfo.Hash{c, b}, q.snapshot())
+}
+
+// downloadAll marks all pieces of the torrent wanted and waits until their check is finished,
+// priority of pieces being checked isn't reported
+func downloadAll(t *testing.T, to *torrent.Torrent) {
+	to.DownloadAll()
+	require.Eventually(t, func() bool {
+		for _, r := range to.PieceStateRuns() {
+			if r.Hashing || r.QueuedForHash || r.Marking {
+				return false
+			}
+		}
+		return true
+	}, 10*time.Second, time.Millisecond)
+}
+
+func TestUpdateQueue(t *testing.T) {
+	require := require.New(t)
+
+	s := newTestService(t, config.TorrentClient{MaxActiveDownloads: 2})
+	complete := addTestTorrent(t, s, "complete", true)
+	unwanted := addTestTorrent(t, s, "unwanted", false)
+	first := addTestTorrent(t, s, "first", false)
+	paused := addTestTorrent(t, s, "paused", false)
+	second := addTestTorrent(t, s, "second", false)
+	third := addTestTorrent(t, s, "third", false)
+	all := []*torrent.Torrent{complete, unwanted, first, paused, second, third}
+	for _, to := range all {
+		if to != unwanted {
+			downloadAll(t, to)
+		}
+		s.queue.push(to.InfoHash(), 0)
+	}
+	require.NoError(s.rep.SetSeedingState(paused.InfoHash(), storage.SeedingState{Paused: true}))
+
+	active := func() []metainfo.Hash {
+		var out []metainfo.Hash
+		for _, to := range all {
+			if s.queue.isActive(to.InfoHash()) {
+				out = append(out, to.InfoHash())
+			}
+		}
+		return out
+	}
+
+	// complete, paused and torrents without wanted pieces don't take slots
+	s.updateQueue()
+	require.Equal([]metainfo.Hash{first.InfoHash(), second.InfoHash()}, active())
+
+	// read torrent is moved to front and started
+	require.True(s.queue.moveToFront(third.InfoHash()))
+	s.updateQueue()
+	require.Equal([]metainfo.Hash{first.InfoHash(), third.InfoHash()}, active())
+
+	// dropped torrent frees its slot
+	s.queue.remove(first.InfoHash())
+	s.updateQueue()
+	require.Equal([]metainfo.Hash{second.InfoHash(), third.InfoHash()}, active())
+}
+
+func TestPromoteDebounced(t *testing.T) {
+	require := require.New(t)
+
+	s := newTestService(t, config.TorrentClient{MaxActiveDownloads: 1})
+	first := addTestTorrent(t, s, "first", false)
+	read := addTestTorrent(t, s, "read", false)
+	downloadAll(t, first)
+	for _, to := range []*torrent.Torrent{first, read} {
+		s.queue.push(to.InfoHash(), 0)
+	}
+	s.updateQueue()
+	require.True(s.queue.isActive(first.InfoHash()))
+
+	// read torrent takes the slot before its reader prioritizes pieces
+	s.promote(read.InfoHash())
+	require.True(s.queue.isActive(read.InfoHash()))
+	require.False(s.queue.isActive(first.InfoHash()))
+
+	// reads shortly after the previous one don't update the queue
+	require.True(s.queue.moveToFront(first.InfoHash()))
+	s.updateQueue()
+	require.True(s.queue.isActive(first.InfoHash()))
+	s.promote(read.InfoHash())
+	require.False(s.queue.isActive(read.InfoHash()))
+}
+
+// newTestSeeder creates client seeding torrent of data added with addTestTorrent
+func newTestSeeder(t *testing.T, data string) *torrent.Client {
+	require := require.New(t)
+
+	dir := t.TempDir()
+	p := filepath.Join(dir, "data.bin")
+	require.NoError(os.WriteFile(p, []byte(data), 0644))
+	info := metainfo.Info{PieceLength: 16 * 1024}
+	require.NoError(info.BuildFromFilePath(p))
+	infoBytes, err := bencode.Marshal(info)
+	require.NoError(err)
+
+	cfg := torrent.NewDefaultClientConfig()
+	cfg.DataDir = dir
+	cfg.ListenPort = 0
+	cfg.NoDHT = true
+	cfg.DisableTrackers = true
+	cfg.Seed = true
+	c, err := torrent.NewClient(cfg)
+	require.NoError(err)
+	t.Cleanup(func() { c.Close() })
+
+	to, _, err := c.AddTorrentSpec(&torrent.TorrentSpec{
+		InfoHash:  metainfo.HashBytes(infoBytes),
+		InfoBytes: infoBytes,
+	})
+	require.NoError(err)
+	select {
+	case <-to.Complete.On():
+	case <-time.After(10 * time.Second):
+		t.Fatal("seeder data is not verified")
+	}
+	return c
+}
+
+func TestQueuedTorrentHasNoPeers(t *testing.T) {
+	require := require.New(t)
+
+	s := newTestService(t, config.TorrentClient{MaxActiveDownloads: 1})
+	active := addTestTorrent(t, s, "active", false)
+	queued := addTestTorrent(t, s, "queued", false)
+	for _, to := range []*torrent.Torrent{active, queued} {
+		// torrents connect to peers only when they need data
+		downloadAll(t, to)
+		s.queue.push(to.InfoHash(), 0)
+	}
+	s.updateQueue()
+	for _, to := range []*torrent.Torrent{active, queued} {
+		require.NoError(s.applySeedingState(to))
+	}
+
+	active.AddClientPeer(newTestSeeder(t, "active"))
+	queued.AddClientPeer(newTestSeeder(t, "queued"))
+
+	// active torrent connects to the seeder and downloads the data
+	require.Eventually(func() bool {
+		return active.BytesMissing() == 0
+	}, 10*time.Second, 10*time.Millisecond)
+	require.Empty(queued.PeerConns())
+	require.NotZero(queued.BytesMissing())
+
+	// started torrent connects to peers
+	s.queue.remove(active.InfoHash())
+	s.updateQueue()
+	queued.AddClientPeer(newTestSeeder(t, "queued"))
+	require.Eventually(func() bool {
+		return queued.BytesMissing() == 0
+	}, 10*time.Second, 10*time.Millisecond)
+}
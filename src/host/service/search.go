@@ -0,0 +1,59 @@
+package service
+
+import (
+	"path"
+	"strconv"
+	"strings"
+
+	"git.kmsign.ru/royalcat/tstor/src/config"
+	"git.kmsign.ru/royalcat/tstor/src/host/vfs"
+)
+
+// savedSearchLimit limits number of files listed in saved search directory
+const savedSearchLimit = 1000
+
+func (s *Service) Index() *vfs.Index {
+	return s.index
+}
+
+// Search finds files of loaded torrents and archives by name, see vfs.Index.Search for query syntax
+func (s *Service) Search(query string, limit int) ([]vfs.IndexEntry, error) {
+	return s.index.Search(query, limit)
+}
+
+// SearchViews returns views listing results of saved searches in search/<name>/ directories
+func (s *Service) SearchViews(searches []config.SavedSearch) vfs.ViewsFunc {
+	valid := make([]config.SavedSearch, 0, len(searches))
+	for _, search := range searches {
+		if !validDirName(search.Name) {
+			s.log.Error("invalid saved search name, search is disabled", "name", search.Name)
+			continue
+		}
+		valid = append(valid, search)
+	}
+
+	return func() (map[string]string, error) {
+		links := map[string]string{}
+		for _, search := range valid {
+			entries, err := s.index.Search(search.Query, savedSearchLimit)
+			if err != nil {
+				return nil, err
+			}
+
+			dir := path.Join("/search", search.Name)
+			for _, e := range entries {
+				link := path.Join(dir, e.Name)
+				ext := path.Ext(e.Name)
+				for i := 2; ; i++ {
+					if _, ok := links[link]; !ok {
+						break
+					}
+					link = path.Join(dir, strings.TrimSuffix(e.Name, ext)+" ("+strconv.Itoa(i)+")"+ext)
+				}
+				links[link] = e.Path
+			}
+		}
+
+		return links, nil
+	}
+}
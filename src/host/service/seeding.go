@@ -0,0 +1,232 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"git.kmsign.ru/royalcat/tstor/src/host/storage"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+const seedingInterval = time.Minute
+
+type SeedingStatus struct {
+	storage.SeedingState
+	// EffectivePolicy is a torrent policy, a policy of its category or a global one
+	// if neither torrent nor category override it
+	EffectivePolicy storage.SeedingPolicy `json:"effectivePolicy"`
+	Ratio           float64               `json:"ratio"`
+	// LimitReached is true when upload is stopped by seeding policy
+	LimitReached bool `json:"limitReached"`
+}
+
+func (s *Service) GlobalSeedingPolicy() storage.SeedingPolicy {
+	return s.seedingPolicy
+}
+
+// SeedingStatus returns seeding state of the torrent with progress of its policy
+func (s *Service) SeedingStatus(hash metainfo.Hash) (*SeedingStatus, error) {
+	t, ok := s.c.Torrent(hash)
+	if !ok {
+		return nil, ErrTorrentNotFound
+	}
+
+	state, err := s.rep.SeedingState(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.seedingStatus(t, state)
+}
+
+func (s *Service) seedingStatus(t *torrent.Torrent, state storage.SeedingState) (*SeedingStatus, error) {
+	downloaded, uploaded, err := s.stats.TransferTotals(t.InfoHash().HexString())
+	if err != nil {
+		return nil, err
+	}
+
+	labels, err := s.rep.Labels(t.InfoHash())
+	if err != nil {
+		return nil, err
+	}
+
+	status := &SeedingStatus{
+		SeedingState:    state,
+		EffectivePolicy: s.seedingPolicy,
+	}
+	if c, ok := s.categories[labels.Category]; ok && c.Seeding != nil {
+		status.EffectivePolicy = *c.Seeding
+	}
+	if state.Policy != nil {
+		status.EffectivePolicy = *state.Policy
+	}
+
+	// data can be downloaded in previous sessions or adopted, so ratio is counted at least from torrent size
+	if t.Info() != nil && t.Length() > downloaded {
+		downloaded = t.Length()
+	}
+	if downloaded > 0 {
+		status.Ratio = float64(uploaded) / float64(downloaded)
+	}
+
+	// policy limits only seeding, incomplete torrents upload while downloading
+	complete := t.Info() != nil && t.BytesMissing() == 0
+	p := status.EffectivePolicy
+	status.LimitReached = complete && ((p.Ratio > 0 && status.Ratio >= p.Ratio) ||
+		(p.SeedTime > 0 && state.SeedingTime >= int64(p.SeedTime)*60) ||
+		(p.PinnedOnly && !state.Pinned))
+
+	return status, nil
+}
+
+// SetSeeding changes torrent pin and seeding policy, nil policy resets it to global one
+func (s *Service) SetSeeding(hash metainfo.Hash, pinned bool, policy *storage.SeedingPolicy) error {
+	t, ok := s.c.Torrent(hash)
+	if !ok {
+		return ErrTorrentNotFound
+	}
+
+	state, err := s.rep.SeedingState(hash)
+	if err != nil {
+		return err
+	}
+	state.Pinned = pinned
+	state.Policy = policy
+	if err := s.rep.SetSeedingState(hash, state); err != nil {
+		return err
+	}
+
+	return s.applySeedingState(t)
+}
+
+// PauseTorrent stops all data transfers of the torrent
+func (s *Service) PauseTorrent(hash metainfo.Hash) error {
+	return s.setPaused(hash, true)
+}
+
+// ResumeTorrent allows data transfers of the torrent limited by its seeding policy
+func (s *Service) ResumeTorrent(hash metainfo.Hash) error {
+	return s.setPaused(hash, false)
+}
+
+func (s *Service) setPaused(hash metainfo.Hash, paused bool) error {
+	t, ok := s.c.Torrent(hash)
+	if !ok {
+		return ErrTorrentNotFound
+	}
+
+	state, err := s.rep.SeedingState(hash)
+	if err != nil {
+		return err
+	}
+	state.Paused = paused
+	if err := s.rep.SetSeedingState(hash, state); err != nil {
+		return err
+	}
+
+	return s.applySeedingState(t)
+}
+
+// applySeedingState allows or disallows torrent data transfers according to its stored state and download queue
+func (s *Service) applySeedingState(t *torrent.Torrent) error {
+	state, err := s.rep.SeedingState(t.InfoHash())
+	if err != nil {
+		return err
+	}
+
+	download, upload, err := s.allowedTransfers(t, state)
+	if err != nil {
+		return err
+	}
+
+	if download {
+		t.AllowDataDownload()
+	} else {
+		t.DisallowDataDownload()
+	}
+	if upload {
+		t.AllowDataUpload()
+	} else {
+		t.DisallowDataUpload()
+	}
+
+	// queued torrents don't connect to peers and don't announce until they are started
+	if s.isQueued(t, state) {
+		t.SetMaxEstablishedConns(0)
+	} else {
+		t.SetMaxEstablishedConns(s.connsPerTorrent)
+	}
+
+	return nil
+}
+
+// isQueued reports whether torrent which wants to download waits in download queue
+func (s *Service) isQueued(t *torrent.Torrent, state storage.SeedingState) bool {
+	if state.Paused || !s.wantsDownload(t) {
+		return false
+	}
+	return !s.queue.isActive(t.InfoHash())
+}
+
+// allowedTransfers reports whether torrent data can be downloaded and uploaded
+func (s *Service) allowedTransfers(t *torrent.Torrent, state storage.SeedingState) (download, upload bool, err error) {
+	if state.Paused {
+		return false, false, nil
+	}
+
+	status, err := s.seedingStatus(t, state)
+	if err != nil {
+		return false, false, err
+	}
+
+	return s.queue.isActive(t.InfoHash()), !status.LimitReached, nil
+}
+
+// RunSeeding counts seeding time of complete torrents and enforces seeding policies until ctx is canceled
+func (s *Service) RunSeeding(ctx context.Context) {
+	ticker := time.NewTicker(seedingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, t := range s.c.Torrents() {
+			if err := s.updateSeeding(t, seedingInterval); err != nil {
+				s.log.Error("error updating seeding state", "hash", t.InfoHash().HexString(), "error", err)
+			}
+		}
+	}
+}
+
+func (s *Service) updateSeeding(t *torrent.Torrent, elapsed time.Duration) error {
+	if t.Info() == nil {
+		return nil
+	}
+
+	state, err := s.rep.SeedingState(t.InfoHash())
+	if err != nil {
+		return err
+	}
+	if state.Paused {
+		return nil
+	}
+
+	status, err := s.seedingStatus(t, state)
+	if err != nil {
+		return err
+	}
+
+	if t.BytesMissing() == 0 && !status.LimitReached {
+		state.SeedingTime += int64(elapsed.Seconds())
+		if err := s.rep.SetSeedingState(t.InfoHash(), state); err != nil {
+			return err
+		}
+	}
+
+	return s.applySeedingState(t)
+}
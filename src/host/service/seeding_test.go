@@ -0,0 +1,150 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"git.kmsign.ru/royalcat/tstor/src/config"
+	"git.kmsign.ru/royalcat/tstor/src/host/storage"
+	"github.com/anacrolix/torrent"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeedingStatus(t *testing.T) {
+	require := require.New(t)
+
+	s := newTestService(t, config.TorrentClient{
+		Seeding: config.Seeding{Ratio: 2},
+		Categories: []config.Category{
+			{Name: "long", Seeding: &config.Seeding{SeedTime: 60}},
+		},
+	})
+	const size = 1000
+	tc := addTestTorrent(t, s, string(make([]byte, size)), true)
+	ti := addTestTorrent(t, s, "incomplete", false)
+
+	// data downloaded before is counted at least as torrent size
+	require.NoError(s.stats.history.Add(tc.InfoHash().HexString(), time.Now(), 0, 1500))
+
+	tests := []struct {
+		name     string
+		state    storage.SeedingState
+		category string
+		policy   storage.SeedingPolicy
+		ratio    float64
+		reached  bool
+	}{
+		{
+			name:   "global ratio not reached",
+			policy: storage.SeedingPolicy{Ratio: 2},
+			ratio:  1.5,
+		},
+		{
+			name:    "torrent ratio reached",
+			state:   storage.SeedingState{Policy: &storage.SeedingPolicy{Ratio: 1.5}},
+			policy:  storage.SeedingPolicy{Ratio: 1.5},
+			ratio:   1.5,
+			reached: true,
+		},
+		{
+			name:     "category seed time not reached",
+			state:    storage.SeedingState{SeedingTime: 59 * 60},
+			category: "long",
+			policy:   storage.SeedingPolicy{SeedTime: 60},
+			ratio:    1.5,
+		},
+		{
+			name:     "category seed time reached",
+			state:    storage.SeedingState{SeedingTime: 60 * 60},
+			category: "long",
+			policy:   storage.SeedingPolicy{SeedTime: 60},
+			ratio:    1.5,
+			reached:  true,
+		},
+		{
+			name:     "torrent policy overrides category",
+			state:    storage.SeedingState{SeedingTime: 60 * 60, Policy: &storage.SeedingPolicy{}},
+			category: "long",
+			ratio:    1.5,
+		},
+		{
+			name:    "not pinned",
+			state:   storage.SeedingState{Policy: &storage.SeedingPolicy{PinnedOnly: true}},
+			policy:  storage.SeedingPolicy{PinnedOnly: true},
+			ratio:   1.5,
+			reached: true,
+		},
+		{
+			name:   "pinned",
+			state:  storage.SeedingState{Pinned: true, Policy: &storage.SeedingPolicy{PinnedOnly: true}},
+			policy: storage.SeedingPolicy{PinnedOnly: true},
+			ratio:  1.5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !assert.NoError(t, s.rep.SetLabels(tc.InfoHash(), storage.Labels{Category: tt.category})) {
+				return
+			}
+
+			status, err := s.seedingStatus(tc, tt.state)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tt.policy, status.EffectivePolicy)
+			assert.InDelta(t, tt.ratio, status.Ratio, 0.001)
+			assert.Equal(t, tt.reached, status.LimitReached)
+		})
+	}
+
+	// incomplete torrent uploads while downloading
+	status, err := s.seedingStatus(ti, storage.SeedingState{Policy: &storage.SeedingPolicy{PinnedOnly: true}})
+	require.NoError(err)
+	require.False(status.LimitReached)
+}
+
+func TestAllowedTransfers(t *testing.T) {
+	s := newTestService(t, config.TorrentClient{MaxActiveDownloads: 1})
+	first := addTestTorrent(t, s, "first", false)
+	second := addTestTorrent(t, s, "second", false)
+	complete := addTestTorrent(t, s, "complete", true)
+	for _, to := range []*torrent.Torrent{first, second, complete} {
+		downloadAll(t, to)
+		s.queue.push(to.InfoHash(), 0)
+	}
+	s.updateQueue()
+
+	tests := []struct {
+		name     string
+		torrent  *torrent.Torrent
+		state    storage.SeedingState
+		download bool
+		upload   bool
+	}{
+		{name: "active", torrent: first, download: true, upload: true},
+		{name: "queued", torrent: second, download: false, upload: true},
+		{name: "paused", torrent: first, state: storage.SeedingState{Paused: true}},
+		{
+			name:    "seeding limit reached",
+			torrent: complete,
+			state:   storage.SeedingState{Policy: &storage.SeedingPolicy{PinnedOnly: true}},
+		},
+		{
+			name:    "pinned",
+			torrent: complete,
+			state:   storage.SeedingState{Pinned: true, Policy: &storage.SeedingPolicy{PinnedOnly: true}},
+			upload:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			download, upload, err := s.allowedTransfers(tt.torrent, tt.state)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.download, download, "download")
+			assert.Equal(t, tt.upload, upload, "upload")
+		})
+	}
+}
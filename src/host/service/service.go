@@ -1,47 +1,95 @@
 package service
 
 import (
-	"context"
-	"fmt"
 	"log/slog"
+	"sync"
 	"time"
 
+	"git.kmsign.ru/royalcat/tstor/src/config"
 	"git.kmsign.ru/royalcat/tstor/src/host/storage"
 	"git.kmsign.ru/royalcat/tstor/src/host/vfs"
 	"github.com/anacrolix/torrent"
 	"github.com/anacrolix/torrent/metainfo"
+	atstorage "github.com/anacrolix/torrent/storage"
 	"github.com/anacrolix/torrent/types"
 )
 
 type Service struct {
-	c   *torrent.Client
-	rep storage.TorrentsRepository
+	c        *torrent.Client
+	rep      storage.TorrentsRepository
+	ipFilter *storage.IPFilter
+	dhtItems *storage.FileItemStore
+	dhtKeys  *storage.DHTKeys
+	// storage features are nil if storage doesn't support them
+	dedup      storage.Deduplicator
+	importer   storage.Importer
+	diskPather storage.DiskPather
 
-	// stats *Stats
+	stats           *Stats
 	DefaultPriority types.PiecePriority
 
-	log                     *slog.Logger
-	addTimeout, readTimeout int
+	verify  *verifyJobs
+	scrapes *scrapeCache
+
+	seedingPolicy storage.SeedingPolicy
+	categories    map[string]config.Category
+	queue         *downloadQueue
+	// connsPerTorrent is a limit of peer connections restored when queued torrent is started
+	connsPerTorrent int
+	prefetchRules   []prefetchRule
+	exports         *exportJobs
+	watch           *watchEvents
+
+	fsMu      sync.Mutex
+	torrentFs map[metainfo.Hash]*vfs.TorrentFs
+	index     *vfs.Index
+
+	log        *slog.Logger
+	addTimeout int
+	timeouts   vfs.Timeouts
 }
 
-func NewService(c *torrent.Client, rep storage.TorrentsRepository, addTimeout, readTimeout int) *Service {
+func NewService(c *torrent.Client, rep storage.TorrentsRepository, history *storage.StatsHistory, ipFilter *storage.IPFilter, dhtItems *storage.FileItemStore, dhtKeys *storage.DHTKeys, exports *storage.ExportJobs, st atstorage.ClientImpl, cfg *config.TorrentClient) *Service {
 	l := slog.With("component", "torrent-service")
-	return &Service{
+	s := &Service{
 		log:             l,
 		c:               c,
 		DefaultPriority: types.PiecePriorityNone,
 		rep:             rep,
-		// stats:       newStats(), // TODO persistent
-		addTimeout:  addTimeout,
-		readTimeout: readTimeout,
+		ipFilter:        ipFilter,
+		dhtItems:        dhtItems,
+		dhtKeys:         dhtKeys,
+		stats:           NewStats(history),
+		verify:          newVerifyJobs(),
+		scrapes:         newScrapeCache(),
+		torrentFs:       map[metainfo.Hash]*vfs.TorrentFs{},
+		index:           vfs.NewIndex(),
+		seedingPolicy:   cfg.Seeding,
+		categories:      map[string]config.Category{},
+		queue:           newDownloadQueue(cfg.MaxActiveDownloads),
+		connsPerTorrent: cfg.Network.ConnsPerTorrent,
+		prefetchRules:   newPrefetchRules(cfg.Prefetch),
+		exports:         newExportJobs(exports),
+		watch:           newWatchEvents(),
+		addTimeout:      cfg.AddTimeout,
+		timeouts:        newTimeouts(cfg),
+	}
+	for _, c := range cfg.Categories {
+		s.categories[c.Name] = c
 	}
+	if s.connsPerTorrent <= 0 {
+		s.connsPerTorrent = torrent.NewDefaultClientConfig().EstablishedConnsPerTorrent
+	}
+	s.dedup, _ = st.(storage.Deduplicator)
+	s.importer, _ = st.(storage.Importer)
+	s.diskPather, _ = st.(storage.DiskPather)
+
+	return s
 }
 
 var _ vfs.FsFactory = (*Service)(nil).NewTorrentFs
 
 func (s *Service) NewTorrentFs(f vfs.File) (vfs.Filesystem, error) {
-	ctx, cancel := context.WithTimeout(context.TODO(), time.Second*time.Duration(s.addTimeout))
-	defer cancel()
 	defer f.Close()
 
 	mi, err := metainfo.Load(f)
@@ -49,26 +97,131 @@ func (s *Service) NewTorrentFs(f vfs.File) (vfs.Filesystem, error) {
 		return nil, err
 	}
 
-	t, ok := s.c.Torrent(mi.HashInfoBytes())
-	if !ok {
-		t, err = s.c.AddTorrent(mi)
-		if err != nil {
-			return nil, err
-		}
-		select {
-		case <-ctx.Done():
-			return nil, fmt.Errorf("creating torrent fs timed out")
-		case <-t.GotInfo():
-		}
-		for _, f := range t.Files() {
-			f.SetPriority(s.DefaultPriority)
+	// loaded torrent is checked and registered under fsMu, so it's not dropped
+	// as idle in between
+	s.fsMu.Lock()
+	if t, ok := s.c.Torrent(mi.HashInfoBytes()); ok {
+		defer s.fsMu.Unlock()
+		return s.registerTorrentFs(t), nil
+	}
+	s.fsMu.Unlock()
+
+	trackers, err := s.rep.TrackerOverrides(mi.HashInfoBytes())
+	if err != nil {
+		return nil, err
+	}
+	mi.AnnounceList = trackers.Apply(mi.UpvertedAnnounceList())
+
+	t, err := s.c.AddTorrent(mi)
+	if err != nil {
+		return nil, err
+	}
+	if err := vfs.WaitInfo(t, s.timeouts.Metadata); err != nil {
+		return nil, err
+	}
+	for _, f := range t.Files() {
+		f.SetPriority(s.DefaultPriority)
+	}
+	s.prefetch(t)
+	labels, err := s.rep.Labels(t.InfoHash())
+	if err != nil {
+		return nil, err
+	}
+	s.queue.push(t.InfoHash(), s.categories[labels.Category].Priority)
+	if err := s.applySeedingState(t); err != nil {
+		return nil, err
+	}
+	s.updateQueue()
+
+	s.fsMu.Lock()
+	defer s.fsMu.Unlock()
+	return s.registerTorrentFs(t), nil
+}
+
+// registerTorrentFs creates filesystem of loaded torrent, fsMu must be held
+func (s *Service) registerTorrentFs(t *torrent.Torrent) *vfs.TorrentFs {
+	s.stats.Add(t)
+
+	tfs := vfs.NewTorrentFs(t, s.rep, s.timeouts)
+	hash := t.InfoHash()
+	tfs.OnRead(func() { s.promote(hash) })
+	if s.diskPather != nil {
+		tfs.SetDiskPath(s.diskPather.DiskPath)
+	}
+
+	s.torrentFs[hash] = tfs
+	return tfs
+}
+
+// newTimeouts returns torrent operation timeouts, not set ones default to AddTimeout and ReadTimeout
+func newTimeouts(cfg *config.TorrentClient) vfs.Timeouts {
+	or := func(v, def int) time.Duration {
+		if v == 0 {
+			v = def
 		}
-		t.AllowDataDownload()
+		return time.Duration(v) * time.Second
+	}
+	return vfs.Timeouts{
+		Metadata:  or(cfg.MetadataTimeout, cfg.AddTimeout),
+		FirstByte: or(cfg.FirstByteTimeout, cfg.ReadTimeout),
+		Stall:     or(cfg.StallTimeout, cfg.ReadTimeout),
+	}
+}
+
+func (s *Service) invalidateTorrentFs(hash metainfo.Hash) {
+	s.fsMu.Lock()
+	defer s.fsMu.Unlock()
+
+	if tfs, ok := s.torrentFs[hash]; ok {
+		tfs.InvalidateCache()
+	}
+}
+
+func (s *Service) ExcludedFiles(hash metainfo.Hash) ([]string, error) {
+	return s.rep.ExcludedFiles(hash)
+}
+
+func (s *Service) ListExcluded() (map[metainfo.Hash][]string, error) {
+	return s.rep.ListExcluded()
+}
+
+// RestoreFile returns previously unlinked file back to torrent filesystem,
+// its data will be downloaded again on demand.
+func (s *Service) RestoreFile(hash metainfo.Hash, path string) error {
+	err := s.rep.RestoreFile(hash, path)
+	if err != nil {
+		return err
 	}
 
-	return vfs.NewTorrentFs(t, s.rep, s.readTimeout), nil
+	s.invalidateTorrentFs(hash)
+	return nil
+}
+
+func (s *Service) Stats() *Stats {
+	return s.stats
+}
+
+// DropTorrent removes torrent from the client and stops tracking it
+func (s *Service) DropTorrent(hash metainfo.Hash) error {
+	s.fsMu.Lock()
+	defer s.fsMu.Unlock()
+
+	return s.dropTorrent(hash)
 }
 
-func (s *Service) Stats() (*Stats, error) {
-	return &Stats{}, nil
+// dropTorrent drops torrent, fsMu must be held
+func (s *Service) dropTorrent(hash metainfo.Hash) error {
+	delete(s.torrentFs, hash)
+
+	t, ok := s.c.Torrent(hash)
+	if !ok {
+		return ErrTorrentNotFound
+	}
+
+	s.stats.Del(hash.HexString())
+	s.queue.remove(hash)
+	t.Drop()
+	s.updateQueue()
+
+	return nil
 }
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"git.kmsign.ru/royalcat/tstor/src/config"
+	"git.kmsign.ru/royalcat/tstor/src/host/storage"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	atstorage "github.com/anacrolix/torrent/storage"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestService creates service with local only torrent client and stores in temporary directories
+func newTestService(t *testing.T, cfg config.TorrentClient) *Service {
+	require := require.New(t)
+
+	ipFilter, err := storage.NewIPFilter(filepath.Join(t.TempDir(), "banned"), "")
+	require.NoError(err)
+
+	ccfg := torrent.NewDefaultClientConfig()
+	ccfg.DataDir = t.TempDir()
+	ccfg.ListenPort = 0
+	ccfg.NoDHT = true
+	ccfg.DisableTrackers = true
+	ccfg.DisableWebseeds = true
+	ccfg.IPBlocklist = ipFilter
+	c, err := torrent.NewClient(ccfg)
+	require.NoError(err)
+	t.Cleanup(func() { c.Close() })
+
+	rep, err := storage.NewTorrentMetaRepository(t.TempDir(), nil)
+	require.NoError(err)
+	history, err := storage.NewStatsHistory(t.TempDir())
+	require.NoError(err)
+	t.Cleanup(func() { history.Close() })
+
+	return NewService(c, rep, history, ipFilter, nil, nil, nil, nil, &cfg)
+}
+
+// addTestTorrent adds single file torrent of data, its data is stored only if complete is true
+func addTestTorrent(t *testing.T, s *Service, data string, complete bool) *torrent.Torrent {
+	require := require.New(t)
+
+	dir := t.TempDir()
+	p := filepath.Join(dir, "data.bin")
+	require.NoError(os.WriteFile(p, []byte(data), 0644))
+	info := metainfo.Info{PieceLength: 16 * 1024}
+	require.NoError(info.BuildFromFilePath(p))
+	if !complete {
+		require.NoError(os.Remove(p))
+	}
+	infoBytes, err := bencode.Marshal(info)
+	require.NoError(err)
+
+	st := atstorage.NewFileOpts(atstorage.NewFileClientOpts{
+		ClientBaseDir:   dir,
+		PieceCompletion: atstorage.NewMapPieceCompletion(),
+	})
+	to, _, err := s.c.AddTorrentSpec(&torrent.TorrentSpec{
+		InfoHash:  metainfo.HashBytes(infoBytes),
+		InfoBytes: infoBytes,
+		Storage:   st,
+	})
+	require.NoError(err)
+	t.Cleanup(func() {
+		to.Drop()
+		st.Close()
+	})
+
+	if complete {
+		select {
+		case <-to.Complete.On():
+		case <-time.After(10 * time.Second):
+			t.Fatal("torrent data is not verified")
+		}
+	}
+	s.stats.Add(to)
+	return to
+}
@@ -1,10 +1,14 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"log/slog"
+	"sort"
 	"sync"
 	"time"
 
+	"git.kmsign.ru/royalcat/tstor/src/host/storage"
 	"github.com/anacrolix/torrent"
 )
 
@@ -71,43 +75,65 @@ type stat struct {
 	time               time.Time
 }
 
+// historyCounters are raw torrent counters at last history record
+type historyCounters struct {
+	downloadBytes int64
+	uploadBytes   int64
+}
+
 type Stats struct {
 	mut           sync.Mutex
 	torrents      map[string]*torrent.Torrent
 	previousStats map[string]*stat
 
+	history         *storage.StatsHistory
+	historyCounters map[string]historyCounters
+
 	gTime time.Time
 }
 
-func NewStats() *Stats {
+// NewStats creates torrent stats registry, history can be nil to disable persistent statistics
+func NewStats(history *storage.StatsHistory) *Stats {
 	return &Stats{
-		gTime:    time.Now(),
-		torrents: make(map[string]*torrent.Torrent),
-		// torrentsByRoute: make(map[string]map[string]*torrent.Torrent),
-		// previousStats:   make(map[string]*stat),
+		gTime:           time.Now(),
+		torrents:        make(map[string]*torrent.Torrent),
+		previousStats:   make(map[string]*stat),
+		history:         history,
+		historyCounters: make(map[string]historyCounters),
 	}
 }
 
-func (s *Stats) Add(path string, t *torrent.Torrent) {
+func (s *Stats) Add(t *torrent.Torrent) {
 	s.mut.Lock()
 	defer s.mut.Unlock()
 
-	s.torrents[path] = t
-	s.previousStats[path] = &stat{}
+	hash := t.InfoHash().String()
+	if _, ok := s.torrents[hash]; ok {
+		return
+	}
+	s.torrents[hash] = t
+	s.previousStats[hash] = &stat{time: time.Now()}
 }
 
-func (s *Stats) Del(path string) {
+func (s *Stats) Del(hash string) {
 	s.mut.Lock()
 	defer s.mut.Unlock()
-	delete(s.torrents, path)
-	delete(s.previousStats, path)
+
+	if t, ok := s.torrents[hash]; ok {
+		// save transfers done since last record
+		s.recordHistory(time.Now(), map[string]*torrent.Torrent{hash: t})
+	}
+
+	delete(s.torrents, hash)
+	delete(s.previousStats, hash)
+	delete(s.historyCounters, hash)
 }
 
-func (s *Stats) Stats(path string) (*TorrentStats, error) {
+func (s *Stats) Stats(hash string) (*TorrentStats, error) {
 	s.mut.Lock()
 	defer s.mut.Unlock()
 
-	t, ok := s.torrents[path]
+	t, ok := s.torrents[hash]
 	if !(ok) {
 		return nil, ErrTorrentNotFound
 	}
@@ -117,6 +143,22 @@ func (s *Stats) Stats(path string) (*TorrentStats, error) {
 	return s.stats(now, t, true), nil
 }
 
+// TorrentsStats returns stats of all tracked torrents without piece chunks sorted by name
+func (s *Stats) TorrentsStats() []*TorrentStats {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	now := time.Now()
+
+	out := make([]*TorrentStats, 0, len(s.torrents))
+	for _, t := range s.torrents {
+		out = append(out, s.stats(now, t, false))
+	}
+	sort.Sort(byName(out))
+
+	return out
+}
+
 func (s *Stats) GlobalStats() *GlobalTorrentStats {
 	s.mut.Lock()
 	defer s.mut.Unlock()
@@ -211,6 +253,110 @@ func (s *Stats) stats(now time.Time, t *torrent.Torrent, chunks bool) *TorrentSt
 	return ts
 }
 
+// RunHistory records transfer counters of all torrents into persistent history until ctx is canceled
+func (s *Stats) RunHistory(ctx context.Context) {
+	if s.history == nil {
+		return
+	}
+
+	ticker := time.NewTicker(storage.HistoryResolution)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.mut.Lock()
+			s.recordHistory(now, s.torrents)
+			s.mut.Unlock()
+		}
+	}
+}
+
+// SaveHistory records transfers done since last history record, must be called before shutdown
+func (s *Stats) SaveHistory() {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	s.recordHistory(time.Now(), s.torrents)
+}
+
+// recordHistory must be called with lock held
+func (s *Stats) recordHistory(now time.Time, torrents map[string]*torrent.Torrent) {
+	if s.history == nil {
+		return
+	}
+
+	var globalDownload, globalUpload int64
+	for hash, t := range torrents {
+		st := t.Stats()
+		cur := historyCounters{
+			downloadBytes: st.BytesReadData.Int64(),
+			uploadBytes:   st.BytesWrittenData.Int64(),
+		}
+		prev := s.historyCounters[hash]
+		s.historyCounters[hash] = cur
+
+		download := cur.downloadBytes - prev.downloadBytes
+		upload := cur.uploadBytes - prev.uploadBytes
+		globalDownload += download
+		globalUpload += upload
+
+		// idle torrents aren't stored, history query handles gaps between points
+		if download == 0 && upload == 0 {
+			continue
+		}
+		if err := s.history.Add(hash, now, download, upload); err != nil {
+			slog.Error("error saving torrent stats history", "hash", hash, "error", err)
+		}
+	}
+
+	if globalDownload == 0 && globalUpload == 0 {
+		return
+	}
+	if err := s.history.Add(storage.GlobalHistoryKey, now, globalDownload, globalUpload); err != nil {
+		slog.Error("error saving global stats history", "error", err)
+	}
+}
+
+// TransferTotals returns bytes transferred for the torrent including previous sessions
+func (s *Stats) TransferTotals(hash string) (downloaded, uploaded int64, err error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	if s.history != nil {
+		downloaded, uploaded, err = s.history.Totals(hash)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if t, ok := s.torrents[hash]; ok {
+		// transfers not recorded to history yet
+		st := t.Stats()
+		prev := s.historyCounters[hash]
+		downloaded += st.BytesReadData.Int64() - prev.downloadBytes
+		uploaded += st.BytesWrittenData.Int64() - prev.uploadBytes
+	}
+
+	return downloaded, uploaded, nil
+}
+
+// History returns stored transfer history of the torrent,
+// empty hash returns history of all torrents
+func (s *Stats) History(hash string, from, to time.Time) ([]storage.HistoryPoint, error) {
+	if s.history == nil {
+		return []storage.HistoryPoint{}, nil
+	}
+
+	if hash == "" {
+		hash = storage.GlobalHistoryKey
+	}
+
+	return s.history.Query(hash, from, to)
+}
+
 const gap time.Duration = 2 * time.Second
 
 func (s *Stats) returnPreviousMeasurements(now time.Time) bool {
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"git.kmsign.ru/royalcat/tstor/src/config"
+	"git.kmsign.ru/royalcat/tstor/src/host/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordHistorySkipsIdle(t *testing.T) {
+	require := require.New(t)
+
+	s := newTestService(t, config.TorrentClient{})
+	idle := addTestTorrent(t, s, "idle", true)
+	active := addTestTorrent(t, s, "active", true)
+	start := time.Now().Truncate(storage.HistoryResolution)
+
+	// active torrent downloaded 10 bytes since last record
+	s.stats.mut.Lock()
+	s.stats.historyCounters[active.InfoHash().HexString()] = historyCounters{downloadBytes: -10}
+	s.stats.recordHistory(start, s.stats.torrents)
+	s.stats.mut.Unlock()
+
+	query := func(key string) []storage.HistoryPoint {
+		points, err := s.stats.history.Query(key, start, start.Add(2*storage.HistoryResolution))
+		require.NoError(err)
+		return points
+	}
+	require.Empty(query(idle.InfoHash().HexString()))
+	require.Len(query(active.InfoHash().HexString()), 1)
+	require.Len(query(storage.GlobalHistoryKey), 1)
+
+	// nothing is stored when no torrent transferred data
+	s.stats.mut.Lock()
+	s.stats.recordHistory(start.Add(storage.HistoryResolution), s.stats.torrents)
+	s.stats.mut.Unlock()
+	require.Len(query(active.InfoHash().HexString()), 1)
+	require.Len(query(storage.GlobalHistoryKey), 1)
+}
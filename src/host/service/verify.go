@@ -0,0 +1,242 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+type VerifyState string
+
+const (
+	VerifyRunning  VerifyState = "running"
+	VerifyDone     VerifyState = "done"
+	VerifyCanceled VerifyState = "canceled"
+)
+
+// VerifyReport describes progress and result of a torrent data check.
+type VerifyReport struct {
+	Hash            string      `json:"hash"`
+	Name            string      `json:"name"`
+	State           VerifyState `json:"state"`
+	TotalPieces     int         `json:"totalPieces"`
+	CheckedPieces   int         `json:"checkedPieces"`
+	CorruptedPieces []int       `json:"corruptedPieces"`
+	Started         time.Time   `json:"started"`
+	Finished        time.Time   `json:"finished,omitempty"`
+}
+
+type verifyJobs struct {
+	mu      sync.Mutex
+	reports map[metainfo.Hash]*VerifyReport
+	cancels map[metainfo.Hash]context.CancelFunc
+}
+
+func newVerifyJobs() *verifyJobs {
+	return &verifyJobs{
+		reports: map[metainfo.Hash]*VerifyReport{},
+		cancels: map[metainfo.Hash]context.CancelFunc{},
+	}
+}
+
+// VerifyTorrent starts rehashing all stored pieces of the torrent in background.
+// Progress and corrupted pieces are available with VerifyReport.
+func (s *Service) VerifyTorrent(hash metainfo.Hash) error {
+	t, ok := s.c.Torrent(hash)
+	if !ok {
+		return ErrTorrentNotFound
+	}
+
+	ctx, cancel, report, ok := s.startVerify(context.Background(), t)
+	if !ok {
+		return nil
+	}
+
+	go func() {
+		defer cancel()
+		s.verifyTorrent(ctx, t, report, 0)
+	}()
+
+	return nil
+}
+
+// startVerify registers a new data check of the torrent, so it's reported and can be canceled.
+// It returns false if the check of the torrent is already running.
+func (s *Service) startVerify(ctx context.Context, t *torrent.Torrent) (context.Context, context.CancelFunc, *VerifyReport, bool) {
+	hash := t.InfoHash()
+
+	s.verify.mu.Lock()
+	defer s.verify.mu.Unlock()
+
+	if r, ok := s.verify.reports[hash]; ok && r.State == VerifyRunning {
+		return nil, nil, nil, false
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	report := &VerifyReport{
+		Hash:    hash.HexString(),
+		Name:    t.Name(),
+		State:   VerifyRunning,
+		Started: time.Now(),
+	}
+	s.verify.reports[hash] = report
+	s.verify.cancels[hash] = cancel
+
+	return ctx, cancel, report, true
+}
+
+// VerifyAll starts data check for every torrent loaded into the client.
+func (s *Service) VerifyAll() error {
+	for _, t := range s.c.Torrents() {
+		if err := s.VerifyTorrent(t.InfoHash()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CancelVerify stops running data check of the torrent.
+func (s *Service) CancelVerify(hash metainfo.Hash) {
+	s.verify.mu.Lock()
+	defer s.verify.mu.Unlock()
+
+	if cancel, ok := s.verify.cancels[hash]; ok {
+		cancel()
+	}
+}
+
+// VerifyReport returns a snapshot of the last data check of the torrent.
+func (s *Service) VerifyReport(hash metainfo.Hash) (*VerifyReport, error) {
+	s.verify.mu.Lock()
+	defer s.verify.mu.Unlock()
+
+	r, ok := s.verify.reports[hash]
+	if !ok {
+		return nil, ErrTorrentNotFound
+	}
+
+	out := *r
+	out.CorruptedPieces = append([]int{}, r.CorruptedPieces...)
+	return &out, nil
+}
+
+// VerifyReports returns snapshots of all known data checks.
+func (s *Service) VerifyReports() []*VerifyReport {
+	s.verify.mu.Lock()
+	hashes := make([]metainfo.Hash, 0, len(s.verify.reports))
+	for h := range s.verify.reports {
+		hashes = append(hashes, h)
+	}
+	s.verify.mu.Unlock()
+
+	out := make([]*VerifyReport, 0, len(hashes))
+	for _, h := range hashes {
+		r, err := s.VerifyReport(h)
+		if err != nil {
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// verifyTorrent rehashes pieces marked as complete, bytesPerSecond limits read rate, 0 means unlimited.
+func (s *Service) verifyTorrent(ctx context.Context, t *torrent.Torrent, report *VerifyReport, bytesPerSecond int64) {
+	log := s.log.With("hash", t.InfoHash().HexString())
+
+	select {
+	case <-ctx.Done():
+		s.finishVerify(report, VerifyCanceled)
+		return
+	case <-t.GotInfo():
+	}
+
+	s.verify.mu.Lock()
+	report.TotalPieces = t.NumPieces()
+	s.verify.mu.Unlock()
+
+	log.Info("verifying torrent data", "pieces", t.NumPieces())
+
+	for i := 0; i < t.NumPieces(); i++ {
+		if ctx.Err() != nil {
+			s.finishVerify(report, VerifyCanceled)
+			return
+		}
+
+		corrupted := false
+		if t.PieceState(i).Complete {
+			start := time.Now()
+			t.Piece(i).VerifyData()
+			corrupted = !t.PieceState(i).Complete
+
+			if bytesPerSecond > 0 {
+				budget := time.Duration(t.Info().Piece(i).Length() * int64(time.Second) / bytesPerSecond)
+				if wait := budget - time.Since(start); wait > 0 {
+					select {
+					case <-ctx.Done():
+					case <-time.After(wait):
+					}
+				}
+			}
+		}
+
+		s.verify.mu.Lock()
+		report.CheckedPieces++
+		if corrupted {
+			report.CorruptedPieces = append(report.CorruptedPieces, i)
+		}
+		s.verify.mu.Unlock()
+
+		if corrupted {
+			log.Warn("corrupted piece found", "piece", i)
+		}
+	}
+
+	s.finishVerify(report, VerifyDone)
+	log.Info("torrent data verified", "corrupted", len(report.CorruptedPieces))
+}
+
+func (s *Service) finishVerify(report *VerifyReport, state VerifyState) {
+	s.verify.mu.Lock()
+	defer s.verify.mu.Unlock()
+
+	report.State = state
+	report.Finished = time.Now()
+}
+
+// RunScrub periodically verifies data of all torrents with limited read rate until ctx is canceled.
+// Scrub checks are reported and canceled as checks started with VerifyTorrent.
+// Non positive interval disables it.
+func (s *Service) RunScrub(ctx context.Context, interval time.Duration, bytesPerSecond int64) {
+	if interval <= 0 {
+		s.log.Error("scrub interval must be positive, scrub is disabled", "interval", interval)
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, t := range s.c.Torrents() {
+			jobCtx, cancel, report, ok := s.startVerify(ctx, t)
+			if !ok {
+				continue
+			}
+
+			s.verifyTorrent(jobCtx, t, report, bytesPerSecond)
+			cancel()
+			if ctx.Err() != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"git.kmsign.ru/royalcat/tstor/src/config"
+	"github.com/anacrolix/torrent"
+	"github.com/stretchr/testify/require"
+)
+
+// corruptPiece overwrites the beginning of stored piece data, its stored completion is kept
+func corruptPiece(t *testing.T, to *torrent.Torrent, piece int) {
+	_, err := to.Piece(piece).Storage().WriteAt([]byte("corrupted"), 0)
+	require.NoError(t, err)
+}
+
+// waitVerify polls report of the torrent until the check is finished
+func waitVerify(t *testing.T, s *Service, to *torrent.Torrent) *VerifyReport {
+	var report *VerifyReport
+	require.Eventually(t, func() bool {
+		r, err := s.VerifyReport(to.InfoHash())
+		if err != nil {
+			return false
+		}
+		report = r
+		return r.State != VerifyRunning
+	}, 10*time.Second, 10*time.Millisecond)
+	return report
+}
+
+func TestVerifyTorrentCorrupted(t *testing.T) {
+	require := require.New(t)
+
+	s := newTestService(t, config.TorrentClient{})
+	to := addTestTorrent(t, s, strings.Repeat("data", 3*16*1024/4), true)
+	require.Equal(3, to.NumPieces())
+
+	corruptPiece(t, to, 1)
+	require.True(to.PieceState(1).Complete)
+
+	require.NoError(s.VerifyTorrent(to.InfoHash()))
+	report := waitVerify(t, s, to)
+	require.Equal(VerifyDone, report.State)
+	require.Equal(3, report.TotalPieces)
+	require.Equal(3, report.CheckedPieces)
+	require.Equal([]int{1}, report.CorruptedPieces)
+
+	require.False(to.PieceState(1).Complete)
+	require.False(to.Piece(1).Storage().Completion().Complete)
+	require.True(to.PieceState(0).Complete)
+	require.True(to.PieceState(2).Complete)
+}
+
+func TestRunScrub(t *testing.T) {
+	require := require.New(t)
+
+	s := newTestService(t, config.TorrentClient{})
+	to := addTestTorrent(t, s, strings.Repeat("data", 2*16*1024/4), true)
+	corruptPiece(t, to, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.RunScrub(ctx, 10*time.Millisecond, 0)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	// next scrubs skip the piece marked incomplete and replace the report
+	require.Eventually(func() bool {
+		r, err := s.VerifyReport(to.InfoHash())
+		return err == nil && r.State == VerifyDone && len(r.CorruptedPieces) == 1 && r.CorruptedPieces[0] == 0
+	}, 10*time.Second, time.Millisecond)
+	require.False(to.PieceState(0).Complete)
+	require.True(to.PieceState(1).Complete)
+}
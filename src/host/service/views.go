@@ -0,0 +1,195 @@
+package service
+
+import (
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"git.kmsign.ru/royalcat/tstor/src/host/vfs"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+const (
+	// viewsCacheTTL is how long views are served without rescanning torrent files
+	viewsCacheTTL = 30 * time.Second
+	// recentViewAge is the age of torrent files listed in recent view
+	recentViewAge = 7 * 24 * time.Hour
+)
+
+type torrentIndexEntry struct {
+	modTime time.Time
+	size    int64
+	hash    metainfo.Hash
+	name    string
+}
+
+type viewsIndex struct {
+	mu      sync.Mutex
+	root    vfs.Filesystem
+	entries map[string]torrentIndexEntry
+	links   map[string]string
+	updated time.Time
+}
+
+// Views returns views of torrent files in root filesystem:
+// by-hash/<infohash>, by-tag/<tag>/<name>, by-category/<category>/<name> and recent/<name>
+func (s *Service) Views(root vfs.Filesystem) vfs.ViewsFunc {
+	idx := &viewsIndex{
+		root:    root,
+		entries: map[string]torrentIndexEntry{},
+	}
+
+	return func() (map[string]string, error) {
+		idx.mu.Lock()
+		defer idx.mu.Unlock()
+
+		if idx.links != nil && time.Since(idx.updated) < viewsCacheTTL {
+			return idx.links, nil
+		}
+
+		links, err := s.buildViews(idx)
+		if err != nil {
+			return nil, err
+		}
+		idx.links = links
+		idx.updated = time.Now()
+
+		return links, nil
+	}
+}
+
+func (s *Service) buildViews(idx *viewsIndex) (map[string]string, error) {
+	found := map[string]bool{}
+	err := idx.scan(vfs.Separator, found)
+	if err != nil {
+		return nil, err
+	}
+	for p := range idx.entries {
+		if !found[p] {
+			delete(idx.entries, p)
+		}
+	}
+
+	labels, err := s.rep.ListLabels()
+	if err != nil {
+		return nil, err
+	}
+
+	links := map[string]string{}
+	add := func(dir string, e torrentIndexEntry, p string) {
+		name := strings.ReplaceAll(e.name, vfs.Separator, "_")
+		if name == "" {
+			name = e.hash.HexString()
+		}
+		link := path.Join(dir, name)
+		if _, ok := links[link]; ok {
+			link = path.Join(dir, name+" ("+e.hash.HexString()[:8]+")")
+		}
+		links[link] = p
+	}
+
+	// entries are added in stable order, so colliding names get the same suffix on every rebuild
+	paths := make([]string, 0, len(idx.entries))
+	for p := range idx.entries {
+		paths = append(paths, p)
+	}
+	slices.SortFunc(paths, func(a, b string) int {
+		if c := strings.Compare(idx.entries[a].hash.HexString(), idx.entries[b].hash.HexString()); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+
+	for _, p := range paths {
+		e := idx.entries[p]
+		if _, ok := links["/by-hash/"+e.hash.HexString()]; !ok {
+			links["/by-hash/"+e.hash.HexString()] = p
+		}
+
+		if time.Since(e.modTime) < recentViewAge {
+			add("/recent", e, p)
+		}
+
+		l, ok := labels[e.hash]
+		if !ok {
+			continue
+		}
+		// labels stored before they were validated can't escape their views
+		for _, tag := range l.Tags {
+			if validDirName(tag) {
+				add(path.Join("/by-tag", tag), e, p)
+			}
+		}
+		if validDirName(l.Category) {
+			add(path.Join("/by-category", l.Category), e, p)
+		}
+	}
+
+	return links, nil
+}
+
+// scan indexes torrent files in dir recursively, metainfo is parsed only for new or changed files
+func (idx *viewsIndex) scan(dir string, found map[string]bool) error {
+	entries, err := idx.root.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		p := path.Join(dir, e.Name())
+		if e.IsDir() {
+			if err := idx.scan(p, found); err != nil {
+				return err
+			}
+			continue
+		}
+		if !strings.HasSuffix(e.Name(), ".torrent") {
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil {
+			return err
+		}
+		found[p] = true
+
+		if cached, ok := idx.entries[p]; ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+			continue
+		}
+
+		entry, err := idx.load(p)
+		if err != nil {
+			// broken torrent files are not listed in views
+			continue
+		}
+		entry.modTime = info.ModTime()
+		entry.size = info.Size()
+		idx.entries[p] = entry
+	}
+
+	return nil
+}
+
+func (idx *viewsIndex) load(p string) (torrentIndexEntry, error) {
+	f, err := idx.root.Open(p)
+	if err != nil {
+		return torrentIndexEntry{}, err
+	}
+	defer f.Close()
+
+	mi, err := metainfo.Load(f)
+	if err != nil {
+		return torrentIndexEntry{}, err
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return torrentIndexEntry{}, err
+	}
+
+	return torrentIndexEntry{
+		hash: mi.HashInfoBytes(),
+		name: info.BestName(),
+	}, nil
+}
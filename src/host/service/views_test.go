@@ -0,0 +1,96 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"git.kmsign.ru/royalcat/tstor/src/config"
+	"git.kmsign.ru/royalcat/tstor/src/host/storage"
+	"git.kmsign.ru/royalcat/tstor/src/host/vfs"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestViewsStablePaths(t *testing.T) {
+	require := require.New(t)
+
+	s := newTestService(t, config.TorrentClient{})
+
+	dir := t.TempDir()
+	// torrents with the same name collide in views
+	for i, name := range []string{"a.torrent", "b.torrent", "c.torrent"} {
+		info := metainfo.Info{
+			Name:        "show",
+			PieceLength: 16 * 1024,
+			Length:      int64(i + 1),
+			Pieces:      make([]byte, 20),
+		}
+		infoBytes, err := bencode.Marshal(info)
+		require.NoError(err)
+		mi := metainfo.MetaInfo{InfoBytes: infoBytes}
+		f, err := os.Create(filepath.Join(dir, name))
+		require.NoError(err)
+		require.NoError(mi.Write(f))
+		require.NoError(f.Close())
+		require.NoError(s.SetLabels(mi.HashInfoBytes(), storage.Labels{Tags: []string{"tv"}}))
+	}
+
+	var first map[string]string
+	for i := 0; i < 20; i++ {
+		idx := &viewsIndex{
+			root:    vfs.NewOsFs(dir),
+			entries: map[string]torrentIndexEntry{},
+		}
+		links, err := s.buildViews(idx)
+		require.NoError(err)
+		if first == nil {
+			first = links
+			continue
+		}
+		require.Equal(first, links)
+	}
+	// by-hash, by-tag and recent links of each torrent
+	require.Len(first, 9)
+	require.Equal("/a.torrent", first["/by-tag/tv/show"])
+}
+
+func TestViewsInvalidNames(t *testing.T) {
+	require := require.New(t)
+
+	s := newTestService(t, config.TorrentClient{})
+
+	dir := t.TempDir()
+	info := metainfo.Info{Name: "show", PieceLength: 16 * 1024, Length: 1, Pieces: make([]byte, 20)}
+	infoBytes, err := bencode.Marshal(info)
+	require.NoError(err)
+	mi := metainfo.MetaInfo{InfoBytes: infoBytes}
+	f, err := os.Create(filepath.Join(dir, "a.torrent"))
+	require.NoError(err)
+	require.NoError(mi.Write(f))
+	require.NoError(f.Close())
+	// labels stored before validation
+	require.NoError(s.rep.SetLabels(mi.HashInfoBytes(), storage.Labels{Tags: []string{"..", "tv"}, Category: "../.."}))
+
+	idx := &viewsIndex{
+		root:    vfs.NewOsFs(dir),
+		entries: map[string]torrentIndexEntry{},
+	}
+	links, err := s.buildViews(idx)
+	require.NoError(err)
+	require.Equal(map[string]string{
+		"/by-hash/" + mi.HashInfoBytes().HexString(): "/a.torrent",
+		"/by-tag/tv/show": "/a.torrent",
+		"/recent/show":    "/a.torrent",
+	}, links)
+
+	views := s.SearchViews([]config.SavedSearch{
+		{Name: "..", Query: "show"},
+		{Name: "a/b", Query: "show"},
+		{Name: "", Query: "show"},
+	})
+	links, err = views()
+	require.NoError(err)
+	require.Empty(links)
+}
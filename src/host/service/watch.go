@@ -0,0 +1,359 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"git.kmsign.ru/royalcat/tstor/src/host/vfs"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// watchDelay is how long torrent file must stay unchanged before it is loaded,
+	// so files still being written are not parsed
+	watchDelay = time.Second
+	// watchEventsBuffer is a number of events buffered for slow subscribers, newer events are dropped
+	watchEventsBuffer = 64
+)
+
+type WatchOp string
+
+const (
+	WatchAdded   WatchOp = "added"
+	WatchRemoved WatchOp = "removed"
+)
+
+// WatchEvent is published when torrent file appears in or disappears from data folder
+type WatchEvent struct {
+	Op WatchOp `json:"op"`
+	// Path is a path of torrent file in filesystem
+	Path     string    `json:"path"`
+	InfoHash string    `json:"infohash"`
+	Time     time.Time `json:"time"`
+}
+
+type watchEvents struct {
+	mu   sync.Mutex
+	subs map[chan WatchEvent]struct{}
+}
+
+func newWatchEvents() *watchEvents {
+	return &watchEvents{subs: map[chan WatchEvent]struct{}{}}
+}
+
+func (w *watchEvents) publish(e WatchEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for ch := range w.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// WatchEvents subscribes to torrent files changes in data folder,
+// returned func must be called to unsubscribe
+func (s *Service) WatchEvents() (<-chan WatchEvent, func()) {
+	ch := make(chan WatchEvent, watchEventsBuffer)
+
+	s.watch.mu.Lock()
+	s.watch.subs[ch] = struct{}{}
+	s.watch.mu.Unlock()
+
+	return ch, func() {
+		s.watch.mu.Lock()
+		delete(s.watch.subs, ch)
+		s.watch.mu.Unlock()
+	}
+}
+
+// RunWatch watches dataDir recursively and loads torrent files as soon as they appear,
+// removed and renamed torrent files are unloaded. Loaded torrents are pinned if pin is set.
+// Torrent files existing on start are loaded too.
+func (s *Service) RunWatch(ctx context.Context, rfs *vfs.ResolveFS, dataDir string, pin bool) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		s.log.Error("error creating data folder watcher", "error", err)
+		return
+	}
+	defer watcher.Close()
+
+	w := newDirWatcher(&watchLoader{s: s, rfs: rfs, pin: pin}, watcher, dataDir, s.log, s.watch.publish)
+	w.run(ctx)
+}
+
+// torrentLoader loads torrents of torrent files found in data folder
+type torrentLoader interface {
+	// load loads torrent file at name of filesystem, it can block until torrent info is received
+	load(name string, hash metainfo.Hash) error
+	// unload unloads torrent of torrent file at name replaced with other torrent
+	unload(name string, hash metainfo.Hash)
+	// dropMissing unloads torrents which torrent files were removed
+	dropMissing()
+}
+
+type watchLoader struct {
+	s   *Service
+	rfs *vfs.ResolveFS
+	pin bool
+}
+
+func (l *watchLoader) load(name string, hash metainfo.Hash) error {
+	// listing creates torrent filesystem, which adds torrent to client
+	if _, err := l.rfs.ReadDir(name); err != nil {
+		return err
+	}
+	if l.pin {
+		if err := l.s.pin(hash); err != nil {
+			return fmt.Errorf("pinning torrent: %w", err)
+		}
+	}
+	return nil
+}
+
+func (l *watchLoader) unload(name string, hash metainfo.Hash) {
+	for _, fs := range l.rfs.EvictPath(name) {
+		tfs, ok := fs.(*vfs.TorrentFs)
+		if !ok || tfs.InfoHash() != hash {
+			continue
+		}
+		err := l.s.dropEvicted(l.rfs, tfs)
+		if err != nil && err != errTorrentInUse && err != ErrTorrentNotFound {
+			l.s.log.Error("error dropping torrent", "hash", hash.HexString(), "error", err)
+		}
+	}
+}
+
+func (l *watchLoader) dropMissing() {
+	l.s.dropMissing(l.rfs)
+}
+
+// watchLoaders limits torrents loaded at once, loading waits for torrent info of magnet-only torrents
+const watchLoaders = 4
+
+type loadResult struct {
+	name string
+	hash metainfo.Hash
+	err  error
+}
+
+type dirWatcher struct {
+	loader  torrentLoader
+	watcher *fsnotify.Watcher
+	dataDir string
+	log     *slog.Logger
+	publish func(WatchEvent)
+	// delay is how long torrent file must stay unchanged before it is loaded
+	delay time.Duration
+
+	// pending are torrent files waiting to be loaded with time of last change
+	pending map[string]time.Time
+	// loading are torrent files being loaded
+	loading map[string]bool
+	results chan loadResult
+	sem     chan struct{}
+	// removed is set when files were removed or renamed and loaded torrents must be checked,
+	// check is deferred until pending torrent files are loaded, so renamed torrents stay loaded
+	removed bool
+	// known are loaded torrent files
+	known map[string]metainfo.Hash
+}
+
+func newDirWatcher(loader torrentLoader, watcher *fsnotify.Watcher, dataDir string, log *slog.Logger, publish func(WatchEvent)) *dirWatcher {
+	return &dirWatcher{
+		loader:  loader,
+		watcher: watcher,
+		dataDir: dataDir,
+		log:     log,
+		publish: publish,
+		delay:   watchDelay,
+		pending: map[string]time.Time{},
+		loading: map[string]bool{},
+		results: make(chan loadResult),
+		sem:     make(chan struct{}, watchLoaders),
+		known:   map[string]metainfo.Hash{},
+	}
+}
+
+func (w *dirWatcher) run(ctx context.Context) {
+	w.addDir(w.dataDir)
+
+	ticker := time.NewTicker(w.delay / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-w.watcher.Errors:
+			w.log.Error("data folder watcher error", "error", err)
+		case e := <-w.watcher.Events:
+			w.handle(e)
+		case r := <-w.results:
+			w.loaded(r)
+		case <-ticker.C:
+			w.flush(ctx)
+		}
+	}
+}
+
+// addDir watches dir and its subdirectories, torrent files found are scheduled for loading
+func (w *dirWatcher) addDir(dir string) {
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			w.log.Warn("error walking data folder", "path", p, "error", err)
+			return nil
+		}
+		if d.IsDir() {
+			if err := w.watcher.Add(p); err != nil {
+				w.log.Error("error watching directory", "path", p, "error", err)
+			}
+			return nil
+		}
+		if isTorrentFile(p) {
+			w.pending[p] = time.Now()
+		}
+		return nil
+	})
+	if err != nil {
+		w.log.Error("error walking data folder", "path", dir, "error", err)
+	}
+}
+
+func (w *dirWatcher) handle(e fsnotify.Event) {
+	switch {
+	case e.Has(fsnotify.Create):
+		if st, err := os.Stat(e.Name); err == nil && st.IsDir() {
+			// directory could be moved in with torrent files already inside
+			w.addDir(e.Name)
+			return
+		}
+		if isTorrentFile(e.Name) {
+			w.pending[e.Name] = time.Now()
+		}
+	case e.Has(fsnotify.Write):
+		if isTorrentFile(e.Name) {
+			w.pending[e.Name] = time.Now()
+		}
+	case e.Has(fsnotify.Remove), e.Has(fsnotify.Rename):
+		// rename is reported for old name, new name gets create event
+		delete(w.pending, e.Name)
+		w.removed = true
+	}
+}
+
+// flush starts loading of torrent files not changed for delay. Removed torrent files are checked
+// only when nothing is pending or loading, so torrent of renamed file is loaded under its new name
+// before the old name is found missing.
+func (w *dirWatcher) flush(ctx context.Context) {
+	for p, changed := range w.pending {
+		if time.Since(changed) < w.delay {
+			continue
+		}
+		name, err := w.name(p)
+		if err != nil || w.loading[name] {
+			// file changed while loading, it is loaded again after current load
+			continue
+		}
+		delete(w.pending, p)
+		w.load(ctx, p, name)
+	}
+
+	if !w.removed || len(w.pending) > 0 || len(w.loading) > 0 {
+		return
+	}
+	w.removed = false
+
+	for name, hash := range w.known {
+		if _, err := os.Stat(filepath.Join(w.dataDir, filepath.FromSlash(name))); !os.IsNotExist(err) {
+			continue
+		}
+		delete(w.known, name)
+		w.log.Info("torrent file removed", "path", name, "hash", hash.HexString())
+		w.publish(WatchEvent{Op: WatchRemoved, Path: name, InfoHash: hash.HexString(), Time: time.Now()})
+	}
+	w.loader.dropMissing()
+}
+
+// name returns filesystem path of torrent file
+func (w *dirWatcher) name(p string) (string, error) {
+	rel, err := filepath.Rel(w.dataDir, p)
+	if err != nil {
+		return "", err
+	}
+	return vfs.AbsPath(filepath.ToSlash(rel)), nil
+}
+
+// load starts loading of torrent file in background, result is handled by loaded
+func (w *dirWatcher) load(ctx context.Context, p, name string) {
+	mi, err := metainfo.LoadFromFile(p)
+	if err != nil {
+		w.log.Warn("error reading torrent file", "path", name, "error", err)
+		return
+	}
+	hash := mi.HashInfoBytes()
+	if known, ok := w.known[name]; ok {
+		if known == hash {
+			return
+		}
+		// torrent file is replaced with other torrent
+		delete(w.known, name)
+		w.loader.unload(name, known)
+		w.log.Info("torrent file replaced", "path", name, "hash", known.HexString())
+		w.publish(WatchEvent{Op: WatchRemoved, Path: name, InfoHash: known.HexString(), Time: time.Now()})
+	}
+
+	w.loading[name] = true
+	go func() {
+		select {
+		case w.sem <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		err := w.loader.load(name, hash)
+		<-w.sem
+
+		select {
+		case w.results <- loadResult{name: name, hash: hash, err: err}:
+		case <-ctx.Done():
+		}
+	}()
+}
+
+func (w *dirWatcher) loaded(r loadResult) {
+	delete(w.loading, r.name)
+	if r.err != nil {
+		w.log.Error("error loading torrent", "path", r.name, "error", r.err)
+		return
+	}
+
+	w.known[r.name] = r.hash
+	w.log.Info("torrent file loaded", "path", r.name, "hash", r.hash.HexString())
+	w.publish(WatchEvent{Op: WatchAdded, Path: r.name, InfoHash: r.hash.HexString(), Time: time.Now()})
+}
+
+// pin pins torrent keeping its seeding policy
+func (s *Service) pin(hash metainfo.Hash) error {
+	state, err := s.rep.SeedingState(hash)
+	if err != nil {
+		return err
+	}
+	if state.Pinned {
+		return nil
+	}
+	return s.SetSeeding(hash, true, state.Policy)
+}
+
+func isTorrentFile(p string) bool {
+	return strings.HasSuffix(p, ".torrent")
+}
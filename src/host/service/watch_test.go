@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"git.kmsign.ru/royalcat/tstor/src/config"
+	"git.kmsign.ru/royalcat/tstor/src/host/vfs"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/fsnotify/fsnotify"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeLoader struct {
+	mu  sync.Mutex
+	ops []string
+	// block holds loading of torrent files until closed
+	block map[string]chan struct{}
+}
+
+func (l *fakeLoader) record(op string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ops = append(l.ops, op)
+}
+
+func (l *fakeLoader) takeOps() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ops := l.ops
+	l.ops = nil
+	return ops
+}
+
+func (l *fakeLoader) load(name string, hash metainfo.Hash) error {
+	l.mu.Lock()
+	block := l.block[name]
+	l.mu.Unlock()
+	if block != nil {
+		<-block
+	}
+	l.record("load " + name)
+	return nil
+}
+
+func (l *fakeLoader) unload(name string, hash metainfo.Hash) {
+	l.record("unload " + name + " " + hash.HexString())
+}
+
+func (l *fakeLoader) dropMissing() {
+	l.record("dropMissing")
+}
+
+func writeTestTorrent(t *testing.T, p, content string) metainfo.Hash {
+	t.Helper()
+
+	src := filepath.Join(t.TempDir(), "data.bin")
+	require.NoError(t, os.WriteFile(src, []byte(content), 0o666))
+	info := metainfo.Info{PieceLength: 16 * 1024}
+	require.NoError(t, info.BuildFromFilePath(src))
+	mi := metainfo.MetaInfo{}
+	var err error
+	mi.InfoBytes, err = bencode.Marshal(info)
+	require.NoError(t, err)
+
+	// written next to target and moved, so watcher doesn't see partial file
+	tmp := p + ".tmp"
+	f, err := os.Create(tmp)
+	require.NoError(t, err)
+	require.NoError(t, mi.Write(f))
+	require.NoError(t, f.Close())
+	require.NoError(t, os.Rename(tmp, p))
+
+	return mi.HashInfoBytes()
+}
+
+func TestDirWatcher(t *testing.T) {
+	require := require.New(t)
+
+	dir := t.TempDir()
+	hashA := writeTestTorrent(t, filepath.Join(dir, "a.torrent"), "a")
+
+	watcher, err := fsnotify.NewWatcher()
+	require.NoError(err)
+	defer watcher.Close()
+
+	events := make(chan WatchEvent, 16)
+	loader := &fakeLoader{block: map[string]chan struct{}{}}
+	w := newDirWatcher(loader, watcher, dir, slog.Default(), func(e WatchEvent) { events <- e })
+	w.delay = 50 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.run(ctx)
+
+	next := func() string {
+		select {
+		case e := <-events:
+			return fmt.Sprintf("%s %s %s", e.Op, e.Path, e.InfoHash)
+		case <-time.After(5 * time.Second):
+			t.Fatal("no watch event")
+			return ""
+		}
+	}
+	// waitOps checks loader calls made since previous check
+	waitOps := func(want ...string) {
+		require.Eventually(func() bool {
+			loader.mu.Lock()
+			defer loader.mu.Unlock()
+			return len(loader.ops) >= len(want)
+		}, 5*time.Second, 10*time.Millisecond)
+		require.Equal(want, loader.takeOps())
+	}
+
+	// existing torrent files are loaded on start
+	require.Equal("added /a.torrent "+hashA.HexString(), next())
+	waitOps("load /a.torrent")
+
+	// renamed torrent is loaded under new name before old one is dropped
+	require.NoError(os.Rename(filepath.Join(dir, "a.torrent"), filepath.Join(dir, "b.torrent")))
+	require.Equal("added /b.torrent "+hashA.HexString(), next())
+	require.Equal("removed /a.torrent "+hashA.HexString(), next())
+	waitOps("load /b.torrent", "dropMissing")
+
+	// replaced torrent file unloads previous torrent
+	hashB := writeTestTorrent(t, filepath.Join(dir, "b.torrent"), "b")
+	require.Equal("removed /b.torrent "+hashA.HexString(), next())
+	require.Equal("added /b.torrent "+hashB.HexString(), next())
+	waitOps("unload /b.torrent "+hashA.HexString(), "load /b.torrent", "dropMissing")
+
+	// slow load doesn't hold other torrent files
+	block := make(chan struct{})
+	loader.mu.Lock()
+	loader.block["/slow.torrent"] = block
+	loader.mu.Unlock()
+	writeTestTorrent(t, filepath.Join(dir, "slow.torrent"), "slow")
+	time.Sleep(w.delay * 2)
+	hashC := writeTestTorrent(t, filepath.Join(dir, "c.torrent"), "c")
+	require.Equal("added /c.torrent "+hashC.HexString(), next())
+	close(block)
+	next()
+	waitOps("load /c.torrent", "load /slow.torrent", "dropMissing")
+
+	// removed torrent file is dropped
+	require.NoError(os.Remove(filepath.Join(dir, "b.torrent")))
+	require.Equal("removed /b.torrent "+hashB.HexString(), next())
+	waitOps("dropMissing")
+}
+
+func TestWatchLoaderUnloadSharedInfoHash(t *testing.T) {
+	require := require.New(t)
+
+	s := newTestService(t, config.TorrentClient{})
+
+	dir := t.TempDir()
+	hash := writeTestTorrent(t, filepath.Join(dir, "a.torrent"), "shared")
+	require.Equal(hash, writeTestTorrent(t, filepath.Join(dir, "b.torrent"), "shared"))
+
+	rfs := vfs.NewResolveFS(vfs.NewOsFs(dir), map[string]vfs.FsFactory{
+		".torrent": s.NewTorrentFs,
+	})
+	l := &watchLoader{s: s, rfs: rfs}
+	require.NoError(l.load("/a.torrent", hash))
+	require.NoError(l.load("/b.torrent", hash))
+
+	// torrent is kept while other torrent file is loaded
+	writeTestTorrent(t, filepath.Join(dir, "a.torrent"), "other")
+	l.unload("/a.torrent", hash)
+	_, ok := s.c.Torrent(hash)
+	require.True(ok)
+	_, err := rfs.ReadDir("/b.torrent")
+	require.NoError(err)
+	require.Len(loadedTorrentFs(rfs, hash), 1)
+
+	writeTestTorrent(t, filepath.Join(dir, "b.torrent"), "other")
+	l.unload("/b.torrent", hash)
+	_, ok = s.c.Torrent(hash)
+	require.False(ok)
+}
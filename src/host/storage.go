@@ -1,11 +1,12 @@
 package host
 
 import (
+	"git.kmsign.ru/royalcat/tstor/src/config"
 	"git.kmsign.ru/royalcat/tstor/src/host/service"
 	"git.kmsign.ru/royalcat/tstor/src/host/vfs"
 )
 
-func NewStorage(dataPath string, tsrv *service.Service) vfs.Filesystem {
+func NewStorage(dataPath string, searches []config.SavedSearch, tsrv *service.Service) *vfs.ResolveFS {
 	factories := map[string]vfs.FsFactory{
 		".torrent": tsrv.NewTorrentFs,
 	}
@@ -15,5 +16,10 @@ func NewStorage(dataPath string, tsrv *service.Service) vfs.Filesystem {
 		factories[k] = v
 	}
 
-	return vfs.NewResolveFS(vfs.NewOsFs(dataPath), factories)
+	root := vfs.NewOsFs(dataPath)
+	rfs := vfs.NewResolveFS(root, factories)
+	rfs.SetViews(vfs.MergeViews(tsrv.Views(root), tsrv.SearchViews(searches)))
+	rfs.SetIndex(tsrv.Index())
+
+	return rfs
 }
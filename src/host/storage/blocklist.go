@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"github.com/anacrolix/torrent/iplist"
+)
+
+// loadBlocklist reads blocklist from a file or from all files of a directory
+func loadBlocklist(path string) (*blocklist, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{path}
+	if st.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		files = files[:0]
+		for _, e := range entries {
+			if !e.IsDir() {
+				files = append(files, filepath.Join(path, e.Name()))
+			}
+		}
+	}
+
+	var ranges []addrRange
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		r, err := parseBlocklist(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error parsing blocklist %s: %w", name, err)
+		}
+		ranges = append(ranges, r...)
+	}
+
+	return newBlocklist(ranges), nil
+}
+
+// parseBlocklist parses lines of P2P format, CIDR prefixes or single addresses, comments start with #
+func parseBlocklist(r io.Reader) ([]addrRange, error) {
+	var out []addrRange
+
+	s := bufio.NewScanner(r)
+	lineNum := 0
+	for s.Scan() {
+		lineNum++
+		line := bytes.TrimSpace(s.Bytes())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		if prefix, err := netip.ParsePrefix(string(line)); err == nil {
+			out = append(out, prefixRange(prefix))
+			continue
+		}
+		if addr, err := netip.ParseAddr(string(line)); err == nil {
+			out = append(out, addrRange{first: addr, last: addr})
+			continue
+		}
+
+		rng, ok, err := iplist.ParseBlocklistP2PLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		if !ok {
+			continue
+		}
+		first, ok1 := netip.AddrFromSlice(rng.First)
+		last, ok2 := netip.AddrFromSlice(rng.Last)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("line %d: bad IP range", lineNum)
+		}
+		out = append(out, addrRange{first: first.Unmap(), last: last.Unmap(), desc: rng.Description})
+	}
+
+	return out, s.Err()
+}
+
+func prefixRange(p netip.Prefix) addrRange {
+	p = p.Masked()
+	last := p.Addr().AsSlice()
+	bits := p.Bits()
+	for i := range last {
+		for b := 0; b < 8; b++ {
+			if i*8+b >= bits {
+				last[i] |= 0x80 >> b
+			}
+		}
+	}
+	l, _ := netip.AddrFromSlice(last)
+	return addrRange{first: p.Addr(), last: l}
+}
+
+type addrRange struct {
+	first, last netip.Addr
+	desc        string
+}
+
+// blocklist is a set of disjoint address ranges sorted by first address
+type blocklist struct {
+	ranges []addrRange
+}
+
+func newBlocklist(ranges []addrRange) *blocklist {
+	slices.SortFunc(ranges, func(a, b addrRange) int {
+		return a.first.Compare(b.first)
+	})
+
+	// join overlapping ranges, so lookup has to check only one of them
+	out := ranges[:0]
+	for _, r := range ranges {
+		if len(out) > 0 {
+			prev := &out[len(out)-1]
+			if r.first.Compare(prev.last) <= 0 {
+				if r.last.Compare(prev.last) > 0 {
+					prev.last = r.last
+				}
+				continue
+			}
+		}
+		out = append(out, r)
+	}
+
+	return &blocklist{ranges: out}
+}
+
+func (b *blocklist) lookup(addr netip.Addr) (addrRange, bool) {
+	i := sort.Search(len(b.ranges), func(i int) bool {
+		return b.ranges[i].first.Compare(addr) > 0
+	})
+	if i == 0 {
+		return addrRange{}, false
+	}
+	r := b.ranges[i-1]
+	return r, addr.Compare(r.last) <= 0
+}
+
+func (b *blocklist) numRanges() int {
+	return len(b.ranges)
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIPFilterBlocklist(t *testing.T) {
+	require := require.New(t)
+
+	dir := t.TempDir()
+	lists := filepath.Join(dir, "lists")
+	require.NoError(os.Mkdir(lists, 0755))
+	require.NoError(os.WriteFile(filepath.Join(lists, "p2p.txt"), []byte(`
+# comment
+Some org:1.2.3.0-1.2.3.255
+Other:1.2.3.128-1.2.4.10
+`), 0644))
+	require.NoError(os.WriteFile(filepath.Join(lists, "cidr.txt"), []byte(`
+10.0.0.0/8
+2001:db8::/32
+192.168.1.1
+`), 0644))
+
+	f, err := NewIPFilter(filepath.Join(dir, "banned"), lists)
+	require.NoError(err)
+
+	for ip, blocked := range map[string]bool{
+		"1.2.3.4":           true,
+		"1.2.4.10":          true,
+		"1.2.4.11":          false,
+		"10.255.255.255":    true,
+		"11.0.0.0":          false,
+		"::ffff:10.1.1.1":   true,
+		"2001:db8:ffff::1":  true,
+		"2001:db9::1":       false,
+		"192.168.1.1":       true,
+		"192.168.1.2":       false,
+		"0.0.0.0":           false,
+		"ffff:ffff:ffff::1": false,
+	} {
+		_, ok := f.Lookup(net.ParseIP(ip))
+		require.Equal(blocked, ok, ip)
+	}
+
+	stats := f.Stats()
+	require.Equal(4, stats.Ranges)
+	require.Equal(6, stats.BlockedPeers)
+	require.Equal(int64(6), stats.BlockedConnections)
+
+	// DHT lookups aren't counted
+	_, ok := f.Uncounted().Lookup(net.ParseIP("1.2.3.4"))
+	require.True(ok)
+	_, ok = f.Uncounted().Lookup(net.ParseIP("1.2.4.11"))
+	require.False(ok)
+	require.Equal(int64(6), f.Stats().BlockedConnections)
+
+	require.NoError(os.Remove(filepath.Join(lists, "cidr.txt")))
+	require.NoError(f.ReloadBlocklist())
+	require.False(f.IsBlocked(net.ParseIP("10.1.1.1")))
+	require.True(f.IsBlocked(net.ParseIP("1.2.3.4")))
+
+	require.NoError(os.WriteFile(filepath.Join(lists, "bad.txt"), []byte("garbage\n"), 0644))
+	require.Error(f.ReloadBlocklist())
+	require.True(f.IsBlocked(net.ParseIP("1.2.3.4")))
+}
+
+func TestIPFilterBlockedLimit(t *testing.T) {
+	require := require.New(t)
+
+	dir := t.TempDir()
+	require.NoError(os.WriteFile(filepath.Join(dir, "list.txt"), []byte("10.0.0.0/8\n"), 0644))
+	f, err := NewIPFilter(filepath.Join(dir, "banned"), filepath.Join(dir, "list.txt"))
+	require.NoError(err)
+
+	for i := 0; i < maxBlockedPeers+100; i++ {
+		_, ok := f.Lookup(net.IPv4(10, byte(i>>16), byte(i>>8), byte(i)))
+		require.True(ok)
+	}
+
+	stats := f.Stats()
+	require.Equal(maxBlockedPeers, stats.BlockedPeers)
+	require.Equal(int64(maxBlockedPeers+100), stats.BlockedConnections)
+}
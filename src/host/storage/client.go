@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/anacrolix/dht/v2"
@@ -14,11 +15,16 @@ import (
 	dlog "git.kmsign.ru/royalcat/tstor/src/log"
 )
 
-func NewClient(st storage.ClientImpl, fis bep44.Store, cfg *config.TorrentClient, id [20]byte) (*torrent.Client, error) {
+func NewClient(st storage.ClientImpl, fis bep44.Store, ipFilter *IPFilter, cfg *config.TorrentClient, id [20]byte) (*torrent.Client, error) {
 	// TODO download and upload limits
 	torrentCfg := torrent.NewDefaultClientConfig()
 	torrentCfg.PeerID = string(id[:])
 	torrentCfg.DefaultStorage = st
+	torrentCfg.IPBlocklist = ipFilter
+
+	if err := applyNetworkConfig(cfg, torrentCfg); err != nil {
+		return nil, fmt.Errorf("invalid network config: %w", err)
+	}
 
 	l := log.Logger.With().Str("component", "torrent-client").Logger()
 
@@ -26,10 +32,16 @@ func NewClient(st storage.ClientImpl, fis bep44.Store, cfg *config.TorrentClient
 	tl.SetHandlers(&dlog.Torrent{L: l})
 	torrentCfg.Logger = tl
 
+	dhtItemsExpiry := cfg.DHTItemsExpiry
+	if dhtItemsExpiry <= 0 {
+		return nil, fmt.Errorf("invalid DHT items expiry: %d, must be positive", dhtItemsExpiry)
+	}
 	torrentCfg.ConfigureAnacrolixDhtServer = func(cfg *dht.ServerConfig) {
 		cfg.Store = fis
-		cfg.Exp = 2 * time.Hour
+		cfg.Exp = time.Duration(dhtItemsExpiry) * time.Minute
 		cfg.NoSecurity = false
+		// DHT nodes aren't peers, they aren't counted as blocked peers
+		cfg.IPBlocklist = ipFilter.Uncounted()
 	}
 
 	return torrent.NewClient(torrentCfg)
@@ -0,0 +1,372 @@
+package storage
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// Deduplicator is implemented by storages able to keep a single copy of files duplicated across torrents
+type Deduplicator interface {
+	Duplicates() ([]DuplicateGroup, error)
+	Deduplicate() ([]LinkedPieces, error)
+}
+
+type DuplicateFile struct {
+	InfoHash string `json:"infohash"`
+	// Path of the file in torrent
+	Path     string `json:"path"`
+	Complete bool   `json:"complete"`
+}
+
+type DuplicateGroup struct {
+	// Key is pieces:<hash> for files matched by piece hashes or content:<hash> for files matched by content
+	Key    string          `json:"key"`
+	Length int64           `json:"length"`
+	Files  []DuplicateFile `json:"files"`
+	// Linked is true if all complete files of the group are stored as a single copy
+	Linked bool `json:"linked"`
+}
+
+// LinkedPieces are pieces marked complete because their data was linked from a duplicate file
+type LinkedPieces struct {
+	InfoHash metainfo.Hash
+	Pieces   []int
+}
+
+type contentHash struct {
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+// fileRef is a file of opened torrent
+type fileRef struct {
+	t        *fileTorrentImpl
+	infoHash metainfo.Hash
+	info     *metainfo.Info
+	path     string
+	diskPath string
+	offset   int64
+	length   int64
+	// pieces covering the file, end is exclusive
+	beginPiece, endPiece int
+	complete             bool
+}
+
+func (r fileRef) duplicateFile() DuplicateFile {
+	return DuplicateFile{
+		InfoHash: r.infoHash.HexString(),
+		Path:     r.path,
+		Complete: r.complete,
+	}
+}
+
+// piecesKey identifies file by hashes of pieces containing only this file data.
+// It is possible only if file starts at piece boundary and ends at piece boundary or at the end of torrent.
+func (r fileRef) piecesKey() (string, bool) {
+	pl := r.info.PieceLength
+	if r.length == 0 || pl == 0 || r.offset%pl != 0 {
+		return "", false
+	}
+	if (r.offset+r.length)%pl != 0 && r.offset+r.length != r.info.TotalLength() {
+		return "", false
+	}
+
+	h := sha1.New()
+	_ = binary.Write(h, binary.BigEndian, r.length)
+	_ = binary.Write(h, binary.BigEndian, pl)
+	for i := r.beginPiece; i < r.endPiece; i++ {
+		h.Write(r.info.Piece(i).Hash().Bytes())
+	}
+	return "pieces:" + hex.EncodeToString(h.Sum(nil)), true
+}
+
+func (fs *FileStorage) fileRefs() []fileRef {
+	fs.mu.Lock()
+	torrents := make([]*fileTorrentImpl, 0, len(fs.torrents))
+	for _, t := range fs.torrents {
+		torrents = append(torrents, t)
+	}
+	fs.mu.Unlock()
+
+	slices.SortFunc(torrents, func(a, b *fileTorrentImpl) int {
+		return strings.Compare(a.infoHash.HexString(), b.infoHash.HexString())
+	})
+
+	var refs []fileRef
+	for _, t := range torrents {
+		pl := t.info.PieceLength
+		var offset int64
+		for i, fi := range t.info.UpvertedFiles() {
+			ref := fileRef{
+				t:        t,
+				infoHash: t.infoHash,
+				info:     t.info,
+				path:     strings.Join(fi.BestPath(), "/"),
+				diskPath: t.files[i].path,
+				offset:   offset,
+				length:   fi.Length,
+			}
+			offset += fi.Length
+			if ref.path == "" {
+				ref.path = t.info.BestName()
+			}
+			if ref.length == 0 || pl == 0 {
+				continue
+			}
+			ref.beginPiece = int(ref.offset / pl)
+			ref.endPiece = int((ref.offset + ref.length + pl - 1) / pl)
+			ref.complete = fs.piecesComplete(t.infoHash, ref.beginPiece, ref.endPiece) && fileHasLength(ref.diskPath, ref.length)
+			refs = append(refs, ref)
+		}
+	}
+
+	return refs
+}
+
+func (fs *FileStorage) piecesComplete(hash metainfo.Hash, begin, end int) bool {
+	for i := begin; i < end; i++ {
+		c, err := fs.pieceCompletion.Get(metainfo.PieceKey{InfoHash: hash, Index: i})
+		if err != nil || !c.Complete {
+			return false
+		}
+	}
+	return true
+}
+
+func fileHasLength(p string, length int64) bool {
+	st, err := os.Stat(p)
+	return err == nil && st.Size() >= length
+}
+
+func sameFile(a, b string) bool {
+	sa, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	sb, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(sa, sb)
+}
+
+// contentKey returns hash of complete file data, hashes are cached until file changes
+func (fs *FileStorage) contentKey(p string) (string, error) {
+	st, err := os.Stat(p)
+	if err != nil {
+		return "", err
+	}
+
+	fs.mu.Lock()
+	cached, ok := fs.contentHashes[p]
+	fs.mu.Unlock()
+	if ok && cached.size == st.Size() && cached.modTime.Equal(st.ModTime()) {
+		return cached.sum, nil
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	sum := "content:" + hex.EncodeToString(h.Sum(nil))
+
+	fs.mu.Lock()
+	fs.contentHashes[p] = contentHash{size: st.Size(), modTime: st.ModTime(), sum: sum}
+	fs.mu.Unlock()
+
+	return sum, nil
+}
+
+// groupDuplicates groups files by piece hashes, complete files not matched by pieces are grouped by content
+func (fs *FileStorage) groupDuplicates() (map[string][]fileRef, error) {
+	refs := fs.fileRefs()
+	groups := map[string][]fileRef{}
+	matched := map[int]bool{}
+
+	for _, r := range refs {
+		if key, ok := r.piecesKey(); ok {
+			groups[key] = append(groups[key], r)
+		}
+	}
+	for key, g := range groups {
+		if len(g) < 2 {
+			delete(groups, key)
+		}
+	}
+	for i, r := range refs {
+		if key, ok := r.piecesKey(); ok && len(groups[key]) > 1 {
+			matched[i] = true
+		}
+	}
+
+	// content is hashed only for complete files with equal length
+	byLength := map[int64][]fileRef{}
+	for i, r := range refs {
+		if !matched[i] && r.complete {
+			byLength[r.length] = append(byLength[r.length], r)
+		}
+	}
+	for _, candidates := range byLength {
+		if len(candidates) < 2 {
+			continue
+		}
+		byContent := map[string][]fileRef{}
+		for _, r := range candidates {
+			key, err := fs.contentKey(r.diskPath)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			byContent[key] = append(byContent[key], r)
+		}
+		for key, g := range byContent {
+			if len(g) > 1 {
+				groups[key] = g
+			}
+		}
+	}
+
+	return groups, nil
+}
+
+// Duplicates lists files duplicated across opened torrents
+func (fs *FileStorage) Duplicates() ([]DuplicateGroup, error) {
+	groups, err := fs.groupDuplicates()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]DuplicateGroup, 0, len(groups))
+	for key, refs := range groups {
+		g := DuplicateGroup{
+			Key:    key,
+			Length: refs[0].length,
+			Linked: true,
+		}
+		var source string
+		for _, r := range refs {
+			g.Files = append(g.Files, r.duplicateFile())
+			if !r.complete {
+				g.Linked = false
+				continue
+			}
+			if source == "" {
+				source = r.diskPath
+			} else if !sameFile(source, r.diskPath) {
+				g.Linked = false
+			}
+		}
+		out = append(out, g)
+	}
+	slices.SortFunc(out, func(a, b DuplicateGroup) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	return out, nil
+}
+
+// Deduplicate hard links duplicate files to a single complete copy. Pieces of incomplete files
+// matched by piece hashes are marked complete, they must be updated in torrent client.
+// Writes of these pieces are dropped from the moment they are linked, so chunks client
+// still downloads for them don't modify the shared copy.
+func (fs *FileStorage) Deduplicate() ([]LinkedPieces, error) {
+	groups, err := fs.groupDuplicates()
+	if err != nil {
+		return nil, err
+	}
+
+	var linked []LinkedPieces
+	for _, refs := range groups {
+		i := slices.IndexFunc(refs, func(r fileRef) bool { return r.complete })
+		if i < 0 {
+			continue
+		}
+		source := refs[i]
+
+		for _, r := range refs {
+			if r.diskPath == source.diskPath || sameFile(source.diskPath, r.diskPath) {
+				continue
+			}
+			if r.complete {
+				if err := fs.link(source.diskPath, r.diskPath); err != nil {
+					return linked, err
+				}
+				continue
+			}
+
+			lp, err := fs.linkIncomplete(source.diskPath, r)
+			if err != nil {
+				return linked, err
+			}
+			linked = append(linked, lp)
+		}
+	}
+
+	return linked, nil
+}
+
+func (fs *FileStorage) link(src, dst string) error {
+	if err := linkReplace(src, dst); err != nil {
+		return err
+	}
+	// open file is replaced by link
+	fs.files.invalidate(dst)
+	return nil
+}
+
+// linkIncomplete links incomplete file while its pieces writes are blocked. Only files matched
+// by piece hashes can be incomplete, their pieces contain only file data.
+func (fs *FileStorage) linkIncomplete(src string, r fileRef) (LinkedPieces, error) {
+	r.t.linkMu.Lock()
+	defer r.t.linkMu.Unlock()
+
+	lp := LinkedPieces{InfoHash: r.infoHash}
+	for p := r.beginPiece; p < r.endPiece; p++ {
+		lp.Pieces = append(lp.Pieces, p)
+	}
+	if err := fs.link(src, r.diskPath); err != nil {
+		return LinkedPieces{}, err
+	}
+	r.t.setLinked(lp.Pieces)
+
+	for _, p := range lp.Pieces {
+		if err := fs.pieceCompletion.Set(metainfo.PieceKey{InfoHash: r.infoHash, Index: p}, true); err != nil {
+			return lp, err
+		}
+	}
+	return lp, nil
+}
+
+// linkReplace atomically replaces dst with a hard link to src
+func linkReplace(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o777); err != nil {
+		return err
+	}
+
+	tmp := dst + ".tstor-link"
+	_ = os.Remove(tmp)
+	if err := os.Link(src, tmp); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
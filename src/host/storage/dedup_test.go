@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func buildTestInfo(t testing.TB, name, file string, data []byte) (*metainfo.Info, metainfo.Hash) {
+	t.Helper()
+
+	dir := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.MkdirAll(dir, 0o777))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, file), data, 0o666))
+
+	info := &metainfo.Info{PieceLength: 16 * 1024}
+	require.NoError(t, info.BuildFromFilePath(dir))
+	mi := metainfo.MetaInfo{}
+	var err error
+	mi.InfoBytes, err = bencode.Marshal(info)
+	require.NoError(t, err)
+
+	return info, mi.HashInfoBytes()
+}
+
+func TestDeduplicate(t *testing.T) {
+	require := require.New(t)
+
+	data := bytes.Repeat([]byte("tstor"), 10*1024)
+	infoA, hashA := buildTestInfo(t, "a", "video.mkv", data)
+	infoB, hashB := buildTestInfo(t, "b", "copy.mkv", data)
+
+	fs := NewFileStorage(t.TempDir(), FileLayoutNameHash, storage.NewMapPieceCompletion()).(*FileStorage)
+	ta, err := fs.OpenTorrent(infoA, hashA)
+	require.NoError(err)
+	tb, err := fs.OpenTorrent(infoB, hashB)
+	require.NoError(err)
+
+	for i := 0; i < infoA.NumPieces(); i++ {
+		p := ta.Piece(infoA.Piece(i))
+		_, err := p.WriteAt(data[infoA.Piece(i).Offset():infoA.Piece(i).Offset()+infoA.Piece(i).Length()], 0)
+		require.NoError(err)
+		require.NoError(p.MarkComplete())
+	}
+
+	groups, err := fs.Duplicates()
+	require.NoError(err)
+	require.Len(groups, 1)
+	require.Len(groups[0].Files, 2)
+	require.False(groups[0].Linked)
+
+	linked, err := fs.Deduplicate()
+	require.NoError(err)
+	require.Len(linked, 1)
+	require.Equal(hashB, linked[0].InfoHash)
+	require.Len(linked[0].Pieces, infoB.NumPieces())
+
+	require.True(sameFile(
+		fs.filePath(infoA, hashA, fs.layout, infoA.Files[0]),
+		fs.filePath(infoB, hashB, fs.layout, infoB.Files[0]),
+	))
+	require.True(fs.piecesComplete(hashB, 0, infoB.NumPieces()))
+
+	// chunks client still downloads for linked pieces don't modify shared copy
+	garbage := bytes.Repeat([]byte("x"), 1024)
+	n, err := tb.Piece(infoB.Piece(0)).WriteAt(garbage, 0)
+	require.NoError(err)
+	require.Equal(len(garbage), n)
+	stored, err := os.ReadFile(fs.filePath(infoA, hashA, fs.layout, infoA.Files[0]))
+	require.NoError(err)
+	require.Equal(data, stored)
+
+	groups, err = fs.Duplicates()
+	require.NoError(err)
+	require.Len(groups, 1)
+	require.True(groups[0].Linked)
+
+	// failed verification downloads piece again
+	require.NoError(tb.Piece(infoB.Piece(0)).MarkNotComplete())
+	require.False(fs.torrents[hashB].linked[0])
+}
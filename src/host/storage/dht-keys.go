@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+)
+
+var ErrKeyExists = errors.New("key already exists")
+
+// keyNameRe is a key file name, leading alphanumeric rejects "." and ".." and hidden files
+var keyNameRe = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+type DHTKey struct {
+	Name string `json:"name"`
+	// PublicKey is hex encoded ed25519 public key
+	PublicKey string `json:"publicKey"`
+}
+
+// DHTKeys stores ed25519 keys used to sign mutable BEP44 items.
+// Every key is stored in a separate file named as the key containing its private key seed.
+type DHTKeys struct {
+	dir string
+}
+
+func NewDHTKeys(dir string) (*DHTKeys, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &DHTKeys{dir: dir}, nil
+}
+
+func (k *DHTKeys) path(name string) (string, error) {
+	if !keyNameRe.MatchString(name) {
+		return "", fmt.Errorf("invalid key name: %s", name)
+	}
+	return filepath.Join(k.dir, name), nil
+}
+
+// Create generates a new key with the name
+func (k *DHTKeys) Create(name string) (DHTKey, error) {
+	p, err := k.path(name)
+	if err != nil {
+		return DHTKey{}, err
+	}
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return DHTKey{}, err
+	}
+
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, os.ErrExist) {
+		return DHTKey{}, ErrKeyExists
+	}
+	if err != nil {
+		return DHTKey{}, err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(priv.Seed()); err != nil {
+		return DHTKey{}, err
+	}
+
+	return DHTKey{
+		Name:      name,
+		PublicKey: hex.EncodeToString(pub),
+	}, nil
+}
+
+// Get returns private key with the name, ErrNotFound is returned if it doesn't exist
+func (k *DHTKeys) Get(name string) (ed25519.PrivateKey, error) {
+	p, err := k.path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	seed, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("key %s is corrupted", name)
+	}
+
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+func (k *DHTKeys) List() ([]DHTKey, error) {
+	entries, err := os.ReadDir(k.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	out := []DHTKey{}
+	for _, e := range entries {
+		// other files in keys folder, e.g. hidden ones, aren't keys
+		if e.IsDir() || !keyNameRe.MatchString(e.Name()) {
+			continue
+		}
+		priv, err := k.Get(e.Name())
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, DHTKey{
+			Name:      e.Name(),
+			PublicKey: hex.EncodeToString(priv.Public().(ed25519.PublicKey)),
+		})
+	}
+	slices.SortFunc(out, func(a, b DHTKey) int {
+		switch {
+		case a.Name < b.Name:
+			return -1
+		case a.Name > b.Name:
+			return 1
+		}
+		return 0
+	})
+
+	return out, nil
+}
+
+func (k *DHTKeys) Delete(name string) error {
+	p, err := k.path(name)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDHTKeys(t *testing.T) {
+	require := require.New(t)
+
+	keys, err := NewDHTKeys(t.TempDir())
+	require.NoError(err)
+
+	k, err := keys.Create("main")
+	require.NoError(err)
+
+	_, err = keys.Create("main")
+	require.ErrorIs(err, ErrKeyExists)
+
+	for _, name := range []string{"../escape", ".", "..", ".hidden", ""} {
+		_, err = keys.Create(name)
+		require.Error(err, name)
+		_, err = keys.Get(name)
+		require.Error(err, name)
+		require.Error(keys.Delete(name), name)
+	}
+
+	priv, err := keys.Get("main")
+	require.NoError(err)
+	require.Equal(k.PublicKey, hex.EncodeToString(priv.Public().(ed25519.PublicKey)))
+
+	list, err := keys.List()
+	require.NoError(err)
+	require.Equal([]DHTKey{k}, list)
+
+	require.NoError(keys.Delete("main"))
+	_, err = keys.Get("main")
+	require.ErrorIs(err, ErrNotFound)
+	require.ErrorIs(keys.Delete("main"), ErrNotFound)
+}
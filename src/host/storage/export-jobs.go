@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+type ExportMode string
+
+const (
+	ExportCopy ExportMode = "copy"
+	// ExportHardlink links files stored on local disk and copies others
+	ExportHardlink ExportMode = "hardlink"
+)
+
+func (m ExportMode) Valid() bool {
+	return m == ExportCopy || m == ExportHardlink
+}
+
+type ExportState string
+
+const (
+	ExportQueued   ExportState = "queued"
+	ExportRunning  ExportState = "running"
+	ExportDone     ExportState = "done"
+	ExportFailed   ExportState = "failed"
+	ExportCanceled ExportState = "canceled"
+)
+
+// ExportJob copies files out of filesystem into export directory
+type ExportJob struct {
+	ID string `json:"id"`
+	// Source is a path of file or directory in filesystem
+	Source string `json:"source"`
+	// Target is a path relative to export directory
+	Target string      `json:"target"`
+	Mode   ExportMode  `json:"mode"`
+	State  ExportState `json:"state"`
+	Error  string      `json:"error,omitempty"`
+
+	TotalFiles  int   `json:"totalFiles"`
+	DoneFiles   int   `json:"doneFiles"`
+	LinkedFiles int   `json:"linkedFiles"`
+	TotalBytes  int64 `json:"totalBytes"`
+	DoneBytes   int64 `json:"doneBytes"`
+	// CompletedFiles are source paths of exported files, they are skipped when job is resumed
+	CompletedFiles []string `json:"completedFiles,omitempty"`
+
+	Created time.Time `json:"created"`
+	Updated time.Time `json:"updated"`
+}
+
+var exportJobPrefix = []byte("job/")
+
+// ExportJobs persists export jobs, so they are resumed after restart
+type ExportJobs struct {
+	db *badger.DB
+}
+
+func NewExportJobs(dir string) (*ExportJobs, error) {
+	opts := badger.
+		DefaultOptions(dir).
+		WithLogger(badgerSlog{slog: slog.With("component", "export-jobs")})
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ExportJobs{db: db}, nil
+}
+
+func (s *ExportJobs) Save(job ExportJob) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(append(slices.Clone(exportJobPrefix), job.ID...), data)
+	})
+}
+
+func (s *ExportJobs) Get(id string) (ExportJob, error) {
+	var job ExportJob
+	err := s.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(append(slices.Clone(exportJobPrefix), id...))
+		if err != nil {
+			return err
+		}
+		return item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &job)
+		})
+	})
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return job, ErrNotFound
+	}
+	return job, err
+}
+
+func (s *ExportJobs) Delete(id string) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		return txn.Delete(append(slices.Clone(exportJobPrefix), id...))
+	})
+}
+
+// List returns jobs in order of creation
+func (s *ExportJobs) List() ([]ExportJob, error) {
+	jobs := []ExportJob{}
+	err := s.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: exportJobPrefix, PrefetchValues: true})
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			var job ExportJob
+			err := it.Item().Value(func(val []byte) error {
+				return json.Unmarshal(val, &job)
+			})
+			if err != nil {
+				return err
+			}
+			jobs = append(jobs, job)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(jobs, func(a, b ExportJob) int {
+		return a.Created.Compare(b.Created)
+	})
+	return jobs, nil
+}
+
+func (s *ExportJobs) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportJobs(t *testing.T) {
+	require := require.New(t)
+
+	s, err := NewExportJobs(t.TempDir())
+	require.NoError(err)
+	defer s.Close()
+
+	now := time.Now()
+	second := ExportJob{ID: "b", Source: "/b", State: ExportQueued, Created: now.Add(time.Second)}
+	first := ExportJob{ID: "a", Source: "/a", State: ExportRunning, Created: now}
+	require.NoError(s.Save(second))
+	require.NoError(s.Save(first))
+
+	jobs, err := s.List()
+	require.NoError(err)
+	require.Len(jobs, 2)
+	require.Equal("a", jobs[0].ID)
+	require.Equal("b", jobs[1].ID)
+
+	first.DoneFiles = 1
+	require.NoError(s.Save(first))
+	job, err := s.Get("a")
+	require.NoError(err)
+	require.Equal(1, job.DoneFiles)
+
+	require.NoError(s.Delete("a"))
+	_, err = s.Get("a")
+	require.ErrorIs(err, ErrNotFound)
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"slices"
+	"time"
+)
+
+// FeedItem is a feed item added to data folder
+type FeedItem struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	// TorrentFile is a path the torrent file was saved to
+	TorrentFile string    `json:"torrentFile"`
+	Added       time.Time `json:"added"`
+}
+
+// feedItemKey separates feed name with zero byte, so names and ids can contain any printable characters
+func feedItemKey(feed, id string) string {
+	return "feed/" + feed + "\x00" + id
+}
+
+// feedIndexKey stores ids of items added from the feed
+func feedIndexKey(feed string) string {
+	return "feed-index/" + feed
+}
+
+// FeedItemAdded reports whether the item was added from the feed
+func (r *torrentRepositoryImpl) FeedItemAdded(feed, id string) (bool, error) {
+	var item FeedItem
+	return r.meta.Get(feedItemKey(feed, id), &item)
+}
+
+// AddFeedItem remembers the item added from the feed, so it's not added twice
+func (r *torrentRepositoryImpl) AddFeedItem(feed string, item FeedItem) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	var index []string
+	_, err := r.meta.Get(feedIndexKey(feed), &index)
+	if err != nil {
+		return err
+	}
+
+	err = r.meta.Set(feedItemKey(feed, item.ID), item)
+	if err != nil {
+		return err
+	}
+
+	return r.meta.Set(feedIndexKey(feed), unique(append(index, item.ID)))
+}
+
+// FeedItems returns items added from the feed, newest first
+func (r *torrentRepositoryImpl) FeedItems(feed string) ([]FeedItem, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	var index []string
+	_, err := r.meta.Get(feedIndexKey(feed), &index)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]FeedItem, 0, len(index))
+	for _, id := range index {
+		var item FeedItem
+		found, err := r.meta.Get(feedItemKey(feed, id), &item)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			items = append(items, item)
+		}
+	}
+
+	slices.SortFunc(items, func(a, b FeedItem) int {
+		return b.Added.Compare(a.Added)
+	})
+	return items, nil
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeedHistory(t *testing.T) {
+	require := require.New(t)
+
+	h, err := NewTorrentMetaRepository(t.TempDir(), nil)
+	require.NoError(err)
+
+	seen, err := h.FeedItemAdded("shows", "1")
+	require.NoError(err)
+	require.False(seen)
+
+	now := time.Now()
+	require.NoError(h.AddFeedItem("shows", FeedItem{ID: "1", Title: "first", Added: now}))
+	require.NoError(h.AddFeedItem("shows", FeedItem{ID: "2", Title: "second", Added: now.Add(time.Second)}))
+	// feed name is a prefix of other feed name
+	require.NoError(h.AddFeedItem("show", FeedItem{ID: "3", Added: now}))
+
+	seen, err = h.FeedItemAdded("shows", "1")
+	require.NoError(err)
+	require.True(seen)
+
+	seen, err = h.FeedItemAdded("show", "1")
+	require.NoError(err)
+	require.False(seen)
+
+	items, err := h.FeedItems("shows")
+	require.NoError(err)
+	require.Len(items, 2)
+	require.Equal("second", items[0].Title)
+	require.Equal("first", items[1].Title)
+
+	// item added again isn't listed twice
+	require.NoError(h.AddFeedItem("shows", FeedItem{ID: "1", Title: "first", Added: now}))
+	items, err = h.FeedItems("shows")
+	require.NoError(err)
+	require.Len(items, 2)
+}
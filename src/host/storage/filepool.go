@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"container/list"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// defaultFileHandles is a number of open files kept by FileStorage
+const defaultFileHandles = 128
+
+// filePool keeps a bounded number of recently used open files, files in use are never closed,
+// so pool can temporarily hold more files than its size
+type filePool struct {
+	mu   sync.Mutex
+	size int
+	// lru of *pooledFile, most recently used at front
+	lru     *list.List
+	handles map[string]*list.Element
+}
+
+type pooledFile struct {
+	*os.File
+	path     string
+	writable bool
+	refs     int
+	// removed from pool, file is closed when released
+	invalid bool
+}
+
+// newFilePool creates pool with size open files, files are closed after every use if size is 0
+func newFilePool(size int) *filePool {
+	return &filePool{
+		size:    size,
+		lru:     list.New(),
+		handles: map[string]*list.Element{},
+	}
+}
+
+// get returns open file, it must be released after use. File is created if write is true.
+func (p *filePool) get(name string, write bool) (*pooledFile, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if e, ok := p.handles[name]; ok {
+		f := e.Value.(*pooledFile)
+		if f.writable || !write {
+			f.refs++
+			p.lru.MoveToFront(e)
+			return f, nil
+		}
+		// read only file is reopened for writing
+		p.removeLocked(e)
+	}
+
+	var (
+		osf *os.File
+		err error
+	)
+	if write {
+		if err = os.MkdirAll(filepath.Dir(name), 0o777); err != nil {
+			return nil, err
+		}
+		osf, err = os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0o666)
+	} else {
+		osf, err = os.Open(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	f := &pooledFile{File: osf, path: name, writable: write, refs: 1}
+	if p.size <= 0 {
+		f.invalid = true
+		return f, nil
+	}
+	p.handles[name] = p.lru.PushFront(f)
+	p.evictLocked()
+
+	return f, nil
+}
+
+func (p *filePool) release(f *pooledFile) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	f.refs--
+	if f.invalid && f.refs == 0 {
+		return f.Close()
+	}
+	p.evictLocked()
+	return nil
+}
+
+// invalidate closes file after it is released, next get opens it again
+func (p *filePool) invalidate(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if e, ok := p.handles[name]; ok {
+		p.removeLocked(e)
+	}
+}
+
+func (p *filePool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, e := range p.handles {
+		p.removeLocked(e)
+	}
+}
+
+func (p *filePool) removeLocked(e *list.Element) {
+	f := e.Value.(*pooledFile)
+	p.lru.Remove(e)
+	delete(p.handles, f.path)
+	f.invalid = true
+	if f.refs == 0 {
+		f.Close()
+	}
+}
+
+// evictLocked closes least recently used files not in use while pool is over its size
+func (p *filePool) evictLocked() {
+	for e := p.lru.Back(); e != nil && p.lru.Len() > p.size; {
+		prev := e.Prev()
+		if e.Value.(*pooledFile).refs == 0 {
+			p.removeLocked(e)
+		}
+		e = prev
+	}
+}
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilePool(t *testing.T) {
+	require := require.New(t)
+
+	dir := t.TempDir()
+	p := newFilePool(2)
+	name := func(n string) string { return filepath.Join(dir, n) }
+
+	a, err := p.get(name("a"), true)
+	require.NoError(err)
+	_, err = a.WriteAt([]byte("a"), 0)
+	require.NoError(err)
+	require.NoError(p.release(a))
+
+	// handle is reused
+	a2, err := p.get(name("a"), false)
+	require.NoError(err)
+	require.Same(a, a2)
+	require.NoError(p.release(a2))
+
+	_, err = p.get(name("missing"), false)
+	require.ErrorIs(err, os.ErrNotExist)
+
+	for _, n := range []string{"b", "c"} {
+		f, err := p.get(name(n), true)
+		require.NoError(err)
+		require.NoError(p.release(f))
+	}
+	// least recently used file is closed
+	require.Equal(2, p.lru.Len())
+	require.NotContains(p.handles, name("a"))
+	require.True(a.invalid)
+
+	// file in use is closed after release
+	b, err := p.get(name("b"), false)
+	require.NoError(err)
+	p.invalidate(name("b"))
+	_, err = b.ReadAt(make([]byte, 1), 0)
+	require.ErrorContains(err, "EOF")
+	require.NoError(p.release(b))
+	_, err = b.ReadAt(make([]byte, 1), 0)
+	require.ErrorIs(err, os.ErrClosed)
+
+	p.close()
+	require.Zero(p.lru.Len())
+}
@@ -0,0 +1,309 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/anacrolix/torrent/common"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/segments"
+)
+
+// ImportMode defines how imported data is placed into storage
+type ImportMode string
+
+const (
+	ImportCopy ImportMode = "copy"
+	// ImportHardlink links files with all pieces verified, other files are not imported
+	// because downloading missing pieces would modify the source files. Files sharing
+	// a boundary piece with a file which was not imported are copied instead of linked.
+	ImportHardlink ImportMode = "hardlink"
+	// ImportReflink clones files with copy on write, it is supported only by some filesystems, e.g. btrfs and xfs
+	ImportReflink ImportMode = "reflink"
+)
+
+func (m ImportMode) Valid() bool {
+	switch m {
+	case ImportCopy, ImportHardlink, ImportReflink:
+		return true
+	}
+	return false
+}
+
+// Importer is implemented by storages able to adopt data downloaded by other clients
+type Importer interface {
+	// Import verifies torrent data in dir and places it into storage, verified pieces are marked complete
+	Import(ctx context.Context, info *metainfo.Info, infoHash metainfo.Hash, dir string, mode ImportMode) (*ImportReport, error)
+}
+
+type ImportReport struct {
+	Pieces   int `json:"pieces"`
+	Verified int `json:"verified"`
+	Files    int `json:"files"`
+	Imported int `json:"imported"`
+	// Skipped are paths of files in torrent which were not imported
+	Skipped []string `json:"skipped"`
+}
+
+var _ Importer = (*FileStorage)(nil)
+
+// importSourcePath returns path of torrent file in dir, dir can be a directory with torrent files or
+// a directory containing directory named as torrent. Single file torrent dir can be the file itself.
+func importSourcePath(dir string, info *metainfo.Info, fi metainfo.FileInfo) string {
+	if len(info.Files) == 0 {
+		if st, err := os.Stat(dir); err == nil && st.Mode().IsRegular() {
+			return dir
+		}
+		return filepath.Join(dir, info.Name)
+	}
+
+	if st, err := os.Stat(filepath.Join(dir, info.Name)); err == nil && st.IsDir() {
+		dir = filepath.Join(dir, info.Name)
+	}
+	return filepath.Join(dir, filepath.Join(fi.Path...))
+}
+
+func (fs *FileStorage) Import(ctx context.Context, info *metainfo.Info, infoHash metainfo.Hash, dir string, mode ImportMode) (*ImportReport, error) {
+	if !mode.Valid() {
+		return nil, fmt.Errorf("unknown import mode: %s", mode)
+	}
+	if err := fs.checkPaths(info, infoHash); err != nil {
+		return nil, err
+	}
+
+	upvertedFiles := info.UpvertedFiles()
+	src := &importSource{
+		files:          make([]file, len(upvertedFiles)),
+		segmentLocater: segments.NewIndex(common.LengthIterFromUpvertedFiles(upvertedFiles)),
+	}
+	for i, fi := range upvertedFiles {
+		src.files[i] = file{
+			path:   importSourcePath(dir, info, fi),
+			length: fi.Length,
+		}
+	}
+	defer src.Close()
+
+	report := &ImportReport{
+		Pieces:  info.NumPieces(),
+		Files:   len(upvertedFiles),
+		Skipped: []string{},
+	}
+
+	verified := make([]bool, info.NumPieces())
+	for i := range verified {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		p := info.Piece(i)
+		h := sha1.New()
+		_, err := io.Copy(h, io.NewSectionReader(src, p.Offset(), p.Length()))
+		verified[i] = err == nil && bytes.Equal(h.Sum(nil), p.Hash().Bytes())
+		if verified[i] {
+			report.Verified++
+		}
+	}
+
+	imported := make([]bool, len(upvertedFiles))
+	var offset int64
+	for i, fi := range upvertedFiles {
+		beginPiece, endPiece := filePieces(info, offset, fi.Length)
+		offset += fi.Length
+
+		all, some := true, false
+		for p := beginPiece; p < endPiece; p++ {
+			all = all && verified[p]
+			some = some || verified[p]
+		}
+		if fi.Length == 0 {
+			// zero length files are created when torrent is opened
+			imported[i] = true
+			continue
+		}
+		if !some || (!all && mode == ImportHardlink) {
+			report.Skipped = append(report.Skipped, importName(info, fi))
+			continue
+		}
+		imported[i] = true
+	}
+
+	// piece is complete only if all files it spans were imported
+	offset = 0
+	for i, fi := range upvertedFiles {
+		if !imported[i] {
+			beginPiece, endPiece := filePieces(info, offset, fi.Length)
+			for p := beginPiece; p < endPiece; p++ {
+				verified[p] = false
+			}
+		}
+		offset += fi.Length
+	}
+
+	offset = 0
+	for i, fi := range upvertedFiles {
+		beginPiece, endPiece := filePieces(info, offset, fi.Length)
+		offset += fi.Length
+		if !imported[i] || fi.Length == 0 {
+			continue
+		}
+
+		fileMode := mode
+		if mode == ImportHardlink {
+			// boundary piece shared with a skipped file will be downloaded again,
+			// so the file is copied to keep downloaded data out of the source file
+			for p := beginPiece; p < endPiece; p++ {
+				if !verified[p] {
+					fileMode = ImportCopy
+					break
+				}
+			}
+		}
+
+		name := importName(info, fi)
+		dst := fs.filePath(info, infoHash, fs.layout, fi)
+		if err := placeFile(src.files[i].path, dst, fileMode); err != nil {
+			return report, fmt.Errorf("importing %s: %w", name, err)
+		}
+		fs.files.invalidate(dst)
+		report.Imported++
+
+		// data of pieces stored before is replaced, so unverified ones aren't complete anymore
+		for p := beginPiece; p < endPiece; p++ {
+			if verified[p] {
+				continue
+			}
+			if err := fs.pieceCompletion.Set(metainfo.PieceKey{InfoHash: infoHash, Index: p}, false); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	for p, ok := range verified {
+		if !ok {
+			continue
+		}
+		if err := fs.pieceCompletion.Set(metainfo.PieceKey{InfoHash: infoHash, Index: p}, true); err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// filePieces returns range of pieces spanned by file at offset
+func filePieces(info *metainfo.Info, offset, length int64) (begin, end int) {
+	if length == 0 {
+		return 0, 0
+	}
+	return int(offset / info.PieceLength), int((offset + length + info.PieceLength - 1) / info.PieceLength)
+}
+
+func importName(info *metainfo.Info, fi metainfo.FileInfo) string {
+	name := strings.Join(fi.BestPath(), "/")
+	if name == "" {
+		name = info.BestName()
+	}
+	return name
+}
+
+// placeFile atomically replaces dst with data of src
+func placeFile(src, dst string, mode ImportMode) error {
+	if mode == ImportHardlink {
+		return linkReplace(src, dst)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0o777); err != nil {
+		return err
+	}
+	tmp := dst + ".tstor-import"
+	_ = os.Remove(tmp)
+
+	var err error
+	if mode == ImportReflink {
+		err = reflinkFile(src, tmp)
+	} else {
+		err = copyFile(src, tmp)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o666)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// importSource exposes files of imported data as one big ReaderAt
+type importSource struct {
+	files          []file
+	segmentLocater segments.Index
+	opened         map[int]*os.File
+}
+
+func (s *importSource) open(i int) (*os.File, error) {
+	if s.opened == nil {
+		s.opened = map[int]*os.File{}
+	}
+	if f, ok := s.opened[i]; ok {
+		return f, nil
+	}
+	f, err := os.Open(s.files[i].path)
+	if err != nil {
+		return nil, err
+	}
+	s.opened[i] = f
+	return f, nil
+}
+
+// ReadAt returns error if any file is missing or short
+func (s *importSource) ReadAt(b []byte, off int64) (n int, err error) {
+	s.segmentLocater.Locate(
+		segments.Extent{Start: off, Length: int64(len(b))},
+		func(i int, e segments.Extent) bool {
+			var f *os.File
+			f, err = s.open(i)
+			if err != nil {
+				return false
+			}
+			var n1 int
+			n1, err = f.ReadAt(b[:e.Length], e.Start)
+			n += n1
+			b = b[n1:]
+			return err == nil
+		},
+	)
+	if len(b) != 0 && err == nil {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (s *importSource) Close() error {
+	for _, f := range s.opened {
+		f.Close()
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImport(t *testing.T) {
+	r := require.New(t)
+
+	src := filepath.Join(t.TempDir(), "show")
+	r.NoError(os.MkdirAll(src, 0o777))
+	r.NoError(os.WriteFile(filepath.Join(src, "a.bin"), bytes.Repeat([]byte("a"), 32*1024), 0o666))
+	r.NoError(os.WriteFile(filepath.Join(src, "b.bin"), bytes.Repeat([]byte("b"), 20*1024), 0o666))
+
+	info := &metainfo.Info{PieceLength: 16 * 1024}
+	r.NoError(info.BuildFromFilePath(src))
+	infoBytes, err := bencode.Marshal(info)
+	r.NoError(err)
+	hash := metainfo.HashBytes(infoBytes)
+
+	// corrupt the last piece
+	f, err := os.OpenFile(filepath.Join(src, "b.bin"), os.O_WRONLY, 0)
+	r.NoError(err)
+	_, err = f.WriteAt([]byte("x"), 20*1024-1)
+	r.NoError(err)
+	r.NoError(f.Close())
+
+	for _, mode := range []ImportMode{ImportCopy, ImportHardlink} {
+		t.Run(string(mode), func(t *testing.T) {
+			require := require.New(t)
+
+			pc := storage.NewMapPieceCompletion()
+			fs := NewFileStorage(t.TempDir(), FileLayoutNameHash, pc).(*FileStorage)
+
+			// parent directory of torrent directory is accepted too
+			report, err := fs.Import(context.Background(), info, hash, filepath.Dir(src), mode)
+			require.NoError(err)
+			require.Equal(4, report.Pieces)
+			require.Equal(3, report.Verified)
+
+			a := fs.filePath(info, hash, fs.layout, info.Files[0])
+			require.FileExists(a)
+			require.Equal(mode == ImportHardlink, sameFile(a, filepath.Join(src, "a.bin")))
+
+			complete := []bool{true, true, true, false}
+			if mode == ImportHardlink {
+				// partially verified file is not linked
+				require.Equal([]string{"b.bin"}, report.Skipped)
+				require.NoFileExists(fs.filePath(info, hash, fs.layout, info.Files[1]))
+				complete = []bool{true, true, false, false}
+			} else {
+				require.Empty(report.Skipped)
+				require.Equal(2, report.Imported)
+			}
+
+			for i, c := range complete {
+				comp, err := pc.Get(metainfo.PieceKey{InfoHash: hash, Index: i})
+				require.NoError(err)
+				require.Equal(c, comp.Complete, "piece %d", i)
+			}
+		})
+	}
+}
+
+func TestImportTraversal(t *testing.T) {
+	require := require.New(t)
+
+	data := bytes.Repeat([]byte("x"), 1024)
+	info, hash := buildTestInfo(t, "evil", "data.bin", data)
+	// source data matches, so only the path check prevents the import
+	src := filepath.Join(t.TempDir(), "evil")
+	require.NoError(os.MkdirAll(filepath.Join(src, "..", "Other [abcd1234]"), 0o777))
+	require.NoError(os.WriteFile(filepath.Join(src, "..", "Other [abcd1234]", "x"), data, 0o666))
+	info.Files[0].Path = []string{"..", "Other [abcd1234]", "x"}
+
+	baseDir := t.TempDir()
+	fs := NewFileStorage(baseDir, FileLayoutNameHash, storage.NewMapPieceCompletion()).(*FileStorage)
+	_, err := fs.Import(context.Background(), info, hash, src, ImportCopy)
+	require.Error(err)
+	require.NoDirExists(filepath.Join(baseDir, "Other [abcd1234]"))
+}
+
+func TestImportHardlinkBoundaryPiece(t *testing.T) {
+	require := require.New(t)
+
+	src := filepath.Join(t.TempDir(), "show")
+	require.NoError(os.MkdirAll(src, 0o777))
+	// piece 1 spans the end of a.bin and the beginning of b.bin
+	require.NoError(os.WriteFile(filepath.Join(src, "a.bin"), bytes.Repeat([]byte("a"), 20*1024), 0o666))
+	require.NoError(os.WriteFile(filepath.Join(src, "b.bin"), bytes.Repeat([]byte("b"), 28*1024), 0o666))
+
+	info := &metainfo.Info{PieceLength: 16 * 1024}
+	require.NoError(info.BuildFromFilePath(src))
+	infoBytes, err := bencode.Marshal(info)
+	require.NoError(err)
+	hash := metainfo.HashBytes(infoBytes)
+
+	// corrupt the last piece, so b.bin is skipped
+	f, err := os.OpenFile(filepath.Join(src, "b.bin"), os.O_WRONLY, 0)
+	require.NoError(err)
+	_, err = f.WriteAt([]byte("x"), 28*1024-1)
+	require.NoError(err)
+	require.NoError(f.Close())
+
+	pc := storage.NewMapPieceCompletion()
+	fs := NewFileStorage(t.TempDir(), FileLayoutNameHash, pc).(*FileStorage)
+	report, err := fs.Import(context.Background(), info, hash, src, ImportHardlink)
+	require.NoError(err)
+	require.Equal(2, report.Verified)
+	require.Equal([]string{"b.bin"}, report.Skipped)
+	require.Equal(1, report.Imported)
+
+	// a.bin is copied because piece 1 will be downloaded again
+	a := fs.filePath(info, hash, fs.layout, info.Files[0])
+	require.FileExists(a)
+	require.False(sameFile(a, filepath.Join(src, "a.bin")))
+
+	for i, c := range []bool{true, false, false} {
+		comp, err := pc.Get(metainfo.PieceKey{InfoHash: hash, Index: i})
+		require.NoError(err)
+		require.Equal(c, comp.Complete, "piece %d", i)
+	}
+
+	// writing the downloaded piece doesn't modify the source file
+	ts, err := fs.OpenTorrent(info, hash)
+	require.NoError(err)
+	_, err = ts.Piece(info.Piece(1)).WriteAt(bytes.Repeat([]byte("z"), 16*1024), 0)
+	require.NoError(err)
+	data, err := os.ReadFile(filepath.Join(src, "a.bin"))
+	require.NoError(err)
+	require.Equal(bytes.Repeat([]byte("a"), 20*1024), data)
+}
+
+func TestImportOverComplete(t *testing.T) {
+	require := require.New(t)
+
+	data := bytes.Repeat([]byte("a"), 40*1024)
+	info, hash := buildTestInfo(t, "show", "a.bin", data)
+
+	pc := storage.NewMapPieceCompletion()
+	fs := NewFileStorage(t.TempDir(), FileLayoutNameHash, pc).(*FileStorage)
+
+	// torrent data is already complete
+	ts, err := fs.OpenTorrent(info, hash)
+	require.NoError(err)
+	for i := 0; i < info.NumPieces(); i++ {
+		p := info.Piece(i)
+		_, err := ts.Piece(p).WriteAt(data[p.Offset():p.Offset()+p.Length()], 0)
+		require.NoError(err)
+		require.NoError(ts.Piece(p).MarkComplete())
+	}
+	require.NoError(ts.Close())
+
+	// source with corrupted second piece replaces stored data
+	src := filepath.Join(t.TempDir(), "show")
+	require.NoError(os.MkdirAll(src, 0o777))
+	corrupted := bytes.Clone(data)
+	corrupted[20*1024] = 'x'
+	require.NoError(os.WriteFile(filepath.Join(src, "a.bin"), corrupted, 0o666))
+
+	report, err := fs.Import(context.Background(), info, hash, src, ImportCopy)
+	require.NoError(err)
+	require.Equal(2, report.Verified)
+
+	for i, c := range []bool{true, false, true} {
+		comp, err := pc.Get(metainfo.PieceKey{InfoHash: hash, Index: i})
+		require.NoError(err)
+		require.Equal(c, comp.Complete, "piece %d", i)
+	}
+}
@@ -0,0 +1,264 @@
+package storage
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/torrent/iplist"
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+// maxBlockedPeers limits number of remembered blocked addresses, the least recently blocked ones are forgotten
+const maxBlockedPeers = 10000
+
+// IPFilter is a torrent client blocklist which can be changed at runtime.
+// Banned addresses are persisted to a file, one address per line.
+// Addresses from blocklist files are blocked too, blocklist can be reloaded without restart.
+type IPFilter struct {
+	mu     sync.RWMutex
+	path   string
+	banned map[netip.Addr]struct{}
+
+	blocklistPath   string
+	blocklist       *blocklist
+	blocklistLoaded time.Time
+
+	blockedMu sync.Mutex
+	blocked   *lru.Cache[netip.Addr, struct{}]
+	// blockedCount is a number of blocked connection attempts
+	blockedCount int64
+}
+
+var _ iplist.Ranger = (*IPFilter)(nil)
+
+type BlocklistStats struct {
+	Path   string    `json:"path"`
+	Ranges int       `json:"ranges"`
+	Loaded time.Time `json:"loaded,omitempty"`
+	Banned int       `json:"banned"`
+	// BlockedPeers is a number of unique recently blocked addresses, at most maxBlockedPeers
+	BlockedPeers int `json:"blockedPeers"`
+	// BlockedConnections is a number of blocked connection attempts since start
+	BlockedConnections int64 `json:"blockedConnections"`
+}
+
+// NewIPFilter loads banned addresses from path and blocklist from a file or a directory
+// at blocklistPath, empty blocklistPath disables blocklist
+func NewIPFilter(path, blocklistPath string) (*IPFilter, error) {
+	blocked, err := lru.New[netip.Addr, struct{}](maxBlockedPeers)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &IPFilter{
+		path:          path,
+		banned:        map[netip.Addr]struct{}{},
+		blocklistPath: blocklistPath,
+		blocklist:     newBlocklist(nil),
+		blocked:       blocked,
+	}
+
+	if err := f.ReloadBlocklist(); err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	s := bufio.NewScanner(file)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+		addr, err := netip.ParseAddr(line)
+		if err != nil {
+			return nil, err
+		}
+		f.banned[addr] = struct{}{}
+	}
+
+	return f, s.Err()
+}
+
+// Lookup implements iplist.Ranger, it is called by torrent client for every peer connection,
+// so found addresses are counted as blocked. DHT must use Uncounted.
+func (f *IPFilter) Lookup(ip net.IP) (iplist.Range, bool) {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return iplist.Range{}, false
+	}
+	addr = addr.Unmap()
+
+	r, ok := f.lookup(addr)
+	if ok {
+		f.recordBlocked(addr)
+	}
+	return r, ok
+}
+
+// IsBlocked reports whether address is banned or blocked by blocklist without counting it as blocked
+func (f *IPFilter) IsBlocked(ip net.IP) bool {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+
+	_, ok = f.lookup(addr.Unmap())
+	return ok
+}
+
+// Uncounted returns the filter which doesn't count found addresses as blocked,
+// it is used by DHT which looks up every node of its routing table and queries.
+func (f *IPFilter) Uncounted() iplist.Ranger {
+	return uncountedFilter{f}
+}
+
+type uncountedFilter struct {
+	f *IPFilter
+}
+
+var _ iplist.Ranger = uncountedFilter{}
+
+func (u uncountedFilter) Lookup(ip net.IP) (iplist.Range, bool) {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return iplist.Range{}, false
+	}
+	return u.f.lookup(addr.Unmap())
+}
+
+func (u uncountedFilter) NumRanges() int {
+	return u.f.NumRanges()
+}
+
+func (f *IPFilter) lookup(addr netip.Addr) (iplist.Range, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if _, ok := f.banned[addr]; ok {
+		return iplist.Range{
+			First:       net.IP(addr.AsSlice()),
+			Last:        net.IP(addr.AsSlice()),
+			Description: "banned",
+		}, true
+	}
+
+	if r, ok := f.blocklist.lookup(addr); ok {
+		return iplist.Range{
+			First:       net.IP(r.first.AsSlice()),
+			Last:        net.IP(r.last.AsSlice()),
+			Description: r.desc,
+		}, true
+	}
+
+	return iplist.Range{}, false
+}
+
+func (f *IPFilter) recordBlocked(addr netip.Addr) {
+	f.blockedMu.Lock()
+	defer f.blockedMu.Unlock()
+
+	f.blocked.Add(addr, struct{}{})
+	f.blockedCount++
+}
+
+// NumRanges implements iplist.Ranger.
+func (f *IPFilter) NumRanges() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return len(f.banned) + f.blocklist.numRanges()
+}
+
+// ReloadBlocklist reads blocklist files again, current blocklist is kept if they can't be read
+func (f *IPFilter) ReloadBlocklist() error {
+	if f.blocklistPath == "" {
+		return nil
+	}
+
+	bl, err := loadBlocklist(f.blocklistPath)
+	if err != nil {
+		return fmt.Errorf("error loading blocklist: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.blocklist = bl
+	f.blocklistLoaded = time.Now()
+	return nil
+}
+
+func (f *IPFilter) Stats() BlocklistStats {
+	f.mu.RLock()
+	stats := BlocklistStats{
+		Path:   f.blocklistPath,
+		Ranges: f.blocklist.numRanges(),
+		Loaded: f.blocklistLoaded,
+		Banned: len(f.banned),
+	}
+	f.mu.RUnlock()
+
+	f.blockedMu.Lock()
+	stats.BlockedPeers = f.blocked.Len()
+	stats.BlockedConnections = f.blockedCount
+	f.blockedMu.Unlock()
+
+	return stats
+}
+
+// Ban blocks new connections with the address.
+func (f *IPFilter) Ban(addr netip.Addr) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.banned[addr.Unmap()] = struct{}{}
+	return f.save()
+}
+
+func (f *IPFilter) Unban(addr netip.Addr) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.banned, addr.Unmap())
+	return f.save()
+}
+
+func (f *IPFilter) Banned() []netip.Addr {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	out := make([]netip.Addr, 0, len(f.banned))
+	for addr := range f.banned {
+		out = append(out, addr)
+	}
+	slices.SortFunc(out, func(a, b netip.Addr) int {
+		return a.Compare(b)
+	})
+	return out
+}
+
+// save must be called with lock held
+func (f *IPFilter) save() error {
+	var b strings.Builder
+	for addr := range f.banned {
+		b.WriteString(addr.String())
+		b.WriteByte('\n')
+	}
+	return os.WriteFile(f.path, []byte(b.String()), 0644)
+}
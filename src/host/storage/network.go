@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/mse"
+
+	"git.kmsign.ru/royalcat/tstor/src/config"
+)
+
+const (
+	EncryptionPrefer  = "prefer"
+	EncryptionRequire = "require"
+	EncryptionAllow   = "allow"
+	EncryptionDisable = "disable"
+)
+
+// applyNetworkConfig validates networking options and sets them to torrent client config
+func applyNetworkConfig(cfg *config.TorrentClient, torrentCfg *torrent.ClientConfig) error {
+	n := cfg.Network
+
+	if n.ListenHost != "" && net.ParseIP(n.ListenHost) == nil {
+		return fmt.Errorf("invalid listen host: %s", n.ListenHost)
+	}
+	if n.ListenPort < 0 || n.ListenPort > 65535 {
+		return fmt.Errorf("invalid listen port: %d", n.ListenPort)
+	}
+	host := n.ListenHost
+	torrentCfg.ListenHost = func(string) string { return host }
+	torrentCfg.ListenPort = n.ListenPort
+
+	if n.Proxy != "" {
+		u, err := url.Parse(n.Proxy)
+		if err != nil {
+			return fmt.Errorf("invalid proxy url: %w", err)
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return fmt.Errorf("unsupported proxy scheme: %s", u.Scheme)
+		}
+		if u.Host == "" {
+			return fmt.Errorf("proxy host is empty: %s", n.Proxy)
+		}
+		// HTTPProxy is used only by HTTP and websocket tracker and web seed clients
+		torrentCfg.HTTPProxy = http.ProxyURL(u)
+	}
+
+	switch n.Encryption {
+	case EncryptionPrefer, "":
+		torrentCfg.HeaderObfuscationPolicy = torrent.HeaderObfuscationPolicy{Preferred: true}
+		torrentCfg.CryptoProvides = mse.AllSupportedCrypto
+	case EncryptionRequire:
+		torrentCfg.HeaderObfuscationPolicy = torrent.HeaderObfuscationPolicy{Preferred: true, RequirePreferred: true}
+		torrentCfg.CryptoProvides = mse.CryptoMethodRC4
+		torrentCfg.CryptoSelector = func(provided mse.CryptoMethod) mse.CryptoMethod {
+			return mse.CryptoMethodRC4
+		}
+	case EncryptionAllow:
+		torrentCfg.HeaderObfuscationPolicy = torrent.HeaderObfuscationPolicy{Preferred: false}
+		torrentCfg.CryptoProvides = mse.AllSupportedCrypto
+	case EncryptionDisable:
+		torrentCfg.HeaderObfuscationPolicy = torrent.HeaderObfuscationPolicy{Preferred: false, RequirePreferred: true}
+	default:
+		return fmt.Errorf("unknown encryption policy: %s", n.Encryption)
+	}
+
+	if n.DisableTCP && n.DisableUTP {
+		return fmt.Errorf("both tcp and utp are disabled, peers can't connect")
+	}
+	torrentCfg.DisableTCP = n.DisableTCP
+	torrentCfg.DisableUTP = n.DisableUTP
+	torrentCfg.DisableIPv6 = cfg.DisableIPv6
+
+	if n.ConnsPerTorrent < 0 {
+		return fmt.Errorf("invalid conns per torrent: %d", n.ConnsPerTorrent)
+	}
+	if n.ConnsPerTorrent > 0 {
+		torrentCfg.EstablishedConnsPerTorrent = n.ConnsPerTorrent
+	}
+
+	return nil
+}
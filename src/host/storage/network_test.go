@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/mse"
+	"github.com/stretchr/testify/require"
+
+	"git.kmsign.ru/royalcat/tstor/src/config"
+)
+
+func TestApplyNetworkConfig(t *testing.T) {
+	require := require.New(t)
+
+	cfg := &config.TorrentClient{
+		DisableIPv6: true,
+		Network: config.Network{
+			ListenHost:      "127.0.0.1",
+			ListenPort:      6881,
+			Proxy:           "socks5://127.0.0.1:1080",
+			Encryption:      EncryptionRequire,
+			DisableUTP:      true,
+			ConnsPerTorrent: 10,
+		},
+	}
+	tc := torrent.NewDefaultClientConfig()
+	require.NoError(applyNetworkConfig(cfg, tc))
+	require.Equal("127.0.0.1", tc.ListenHost("tcp"))
+	require.Equal(6881, tc.ListenPort)
+	require.NotNil(tc.HTTPProxy)
+	require.True(tc.HeaderObfuscationPolicy.RequirePreferred)
+	require.Equal(mse.CryptoMethodRC4, tc.CryptoProvides)
+	require.True(tc.DisableUTP)
+	require.True(tc.DisableIPv6)
+	require.Equal(10, tc.EstablishedConnsPerTorrent)
+
+	for _, n := range []config.Network{
+		{ListenHost: "localhost"},
+		{ListenPort: 70000},
+		{Proxy: "ftp://127.0.0.1"},
+		{Encryption: "sometimes"},
+		{DisableTCP: true, DisableUTP: true},
+		{ConnsPerTorrent: -1},
+	} {
+		require.Error(applyNetworkConfig(&config.TorrentClient{Network: n}, torrent.NewDefaultClientConfig()), "%+v", n)
+	}
+}
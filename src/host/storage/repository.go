@@ -3,8 +3,10 @@ package storage
 import (
 	"errors"
 	"path/filepath"
+	"slices"
 	"sync"
 
+	"git.kmsign.ru/royalcat/tstor/src/config"
 	"github.com/anacrolix/torrent"
 	"github.com/anacrolix/torrent/metainfo"
 	atstorage "github.com/anacrolix/torrent/storage"
@@ -16,6 +18,76 @@ import (
 type TorrentsRepository interface {
 	ExcludeFile(file *torrent.File) error
 	ExcludedFiles(hash metainfo.Hash) ([]string, error)
+	ListExcluded() (map[metainfo.Hash][]string, error)
+	RestoreFile(hash metainfo.Hash, path string) error
+
+	TrackerOverrides(hash metainfo.Hash) (TrackerOverrides, error)
+	SetTrackerOverrides(hash metainfo.Hash, o TrackerOverrides) error
+
+	SeedingState(hash metainfo.Hash) (SeedingState, error)
+	SetSeedingState(hash metainfo.Hash, s SeedingState) error
+
+	Labels(hash metainfo.Hash) (Labels, error)
+	SetLabels(hash metainfo.Hash, l Labels) error
+	ListLabels() (map[metainfo.Hash]Labels, error)
+
+	FeedItemAdded(feed, id string) (bool, error)
+	AddFeedItem(feed string, item FeedItem) error
+	FeedItems(feed string) ([]FeedItem, error)
+}
+
+// Labels are user defined metadata used to organize torrents
+type Labels struct {
+	Tags     []string `json:"tags"`
+	Category string   `json:"category"`
+	Note     string   `json:"note"`
+}
+
+func (l Labels) IsEmpty() bool {
+	return len(l.Tags) == 0 && l.Category == "" && l.Note == ""
+}
+
+// SeedingPolicy is stored with torrent seeding state to override configured policy
+type SeedingPolicy = config.Seeding
+
+type SeedingState struct {
+	Paused bool `json:"paused"`
+	Pinned bool `json:"pinned"`
+	// Policy overrides global seeding policy if not nil
+	Policy *SeedingPolicy `json:"policy,omitempty"`
+	// SeedingTime in seconds spent seeding complete torrent
+	SeedingTime int64 `json:"seedingTime"`
+}
+
+// TrackerOverrides are user changes of torrent announce list
+type TrackerOverrides struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+// Apply returns announce list with user changes
+func (o TrackerOverrides) Apply(al metainfo.AnnounceList) metainfo.AnnounceList {
+	out := make(metainfo.AnnounceList, 0, len(al)+1)
+	for _, tier := range al {
+		tier = slices.DeleteFunc(slices.Clone(tier), func(url string) bool {
+			return slices.Contains(o.Removed, url)
+		})
+		if len(tier) > 0 {
+			out = append(out, tier)
+		}
+	}
+
+	var added []string
+	for _, url := range o.Added {
+		if !slices.Contains(out.DistinctValues(), url) {
+			added = append(added, url)
+		}
+	}
+	if len(added) > 0 {
+		out = append(out, added)
+	}
+
+	return out
 }
 
 func NewTorrentMetaRepository(metaDir string, storage atstorage.ClientImplCloser) (TorrentsRepository, error) {
@@ -28,8 +100,17 @@ func NewTorrentMetaRepository(metaDir string, storage atstorage.ClientImplCloser
 		return nil, err
 	}
 
+	metaStore, err := badgerdb.NewStore(badgerdb.Options{
+		Dir:   filepath.Join(metaDir, "torrents-meta"),
+		Codec: encoding.JSON,
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	r := &torrentRepositoryImpl{
 		excludedFiles: excludedFilesStore,
+		meta:          metaStore,
 		storage:       storage,
 	}
 
@@ -39,11 +120,22 @@ func NewTorrentMetaRepository(metaDir string, storage atstorage.ClientImplCloser
 type torrentRepositoryImpl struct {
 	m             sync.RWMutex
 	excludedFiles gokv.Store
-	storage       atstorage.ClientImplCloser
+	// per torrent metadata, keys are prefixed with kind of data
+	meta    gokv.Store
+	storage atstorage.ClientImplCloser
+}
+
+func metaKey(kind string, hash metainfo.Hash) string {
+	return kind + "/" + hash.HexString()
 }
 
 var ErrNotFound = errors.New("not found")
 
+// excludedIndexKey stores list of torrents with excluded files, it can't collide with 20 bytes infohash keys.
+// gokv doesn't support iteration, so torrents with files excluded before the index existed
+// are added to it when their excluded files are read on torrent load.
+const excludedIndexKey = "index"
+
 func (r *torrentRepositoryImpl) ExcludeFile(file *torrent.File) error {
 	r.m.Lock()
 	defer r.m.Unlock()
@@ -66,9 +158,90 @@ func (r *torrentRepositoryImpl) ExcludeFile(file *torrent.File) error {
 		}
 	}
 
+	err = r.excludedFiles.Set(hash.AsString(), excludedFiles)
+	if err != nil {
+		return err
+	}
+
+	return r.updateExcludedIndex(hash, true)
+}
+
+func (r *torrentRepositoryImpl) RestoreFile(hash metainfo.Hash, path string) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	var excludedFiles []string
+	found, err := r.excludedFiles.Get(hash.AsString(), &excludedFiles)
+	if err != nil {
+		return err
+	}
+	if !found || !slices.Contains(excludedFiles, path) {
+		return ErrNotFound
+	}
+
+	excludedFiles = slices.DeleteFunc(excludedFiles, func(p string) bool {
+		return p == path
+	})
+	if len(excludedFiles) == 0 {
+		err = r.excludedFiles.Delete(hash.AsString())
+		if err != nil {
+			return err
+		}
+		return r.updateExcludedIndex(hash, false)
+	}
+
 	return r.excludedFiles.Set(hash.AsString(), excludedFiles)
 }
 
+func (r *torrentRepositoryImpl) ListExcluded() (map[metainfo.Hash][]string, error) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	var index []string
+	_, err := r.excludedFiles.Get(excludedIndexKey, &index)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[metainfo.Hash][]string, len(index))
+	for _, hex := range index {
+		var hash metainfo.Hash
+		if err := hash.FromHexString(hex); err != nil {
+			return nil, err
+		}
+
+		var excludedFiles []string
+		found, err := r.excludedFiles.Get(hash.AsString(), &excludedFiles)
+		if err != nil {
+			return nil, err
+		}
+		if found && len(excludedFiles) > 0 {
+			out[hash] = excludedFiles
+		}
+	}
+
+	return out, nil
+}
+
+// updateExcludedIndex must be called with lock held
+func (r *torrentRepositoryImpl) updateExcludedIndex(hash metainfo.Hash, add bool) error {
+	var index []string
+	_, err := r.excludedFiles.Get(excludedIndexKey, &index)
+	if err != nil {
+		return err
+	}
+
+	if add {
+		index = unique(append(index, hash.HexString()))
+	} else {
+		index = slices.DeleteFunc(index, func(h string) bool {
+			return h == hash.HexString()
+		})
+	}
+
+	return r.excludedFiles.Set(excludedIndexKey, index)
+}
+
 func (r *torrentRepositoryImpl) ExcludedFiles(hash metainfo.Hash) ([]string, error) {
 	r.m.Lock()
 	defer r.m.Unlock()
@@ -82,9 +255,116 @@ func (r *torrentRepositoryImpl) ExcludedFiles(hash metainfo.Hash) ([]string, err
 		return nil, nil
 	}
 
+	if len(excludedFiles) > 0 {
+		if err := r.ensureExcludedIndexed(hash); err != nil {
+			return nil, err
+		}
+	}
+
 	return excludedFiles, nil
 }
 
+// ensureExcludedIndexed adds torrent with files excluded before the index existed to the index,
+// must be called with lock held
+func (r *torrentRepositoryImpl) ensureExcludedIndexed(hash metainfo.Hash) error {
+	var index []string
+	_, err := r.excludedFiles.Get(excludedIndexKey, &index)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(index, hash.HexString()) {
+		return nil
+	}
+
+	return r.excludedFiles.Set(excludedIndexKey, append(index, hash.HexString()))
+}
+
+func (r *torrentRepositoryImpl) TrackerOverrides(hash metainfo.Hash) (TrackerOverrides, error) {
+	var o TrackerOverrides
+	_, err := r.meta.Get(metaKey("trackers", hash), &o)
+	return o, err
+}
+
+func (r *torrentRepositoryImpl) SetTrackerOverrides(hash metainfo.Hash, o TrackerOverrides) error {
+	return r.meta.Set(metaKey("trackers", hash), o)
+}
+
+func (r *torrentRepositoryImpl) SeedingState(hash metainfo.Hash) (SeedingState, error) {
+	var s SeedingState
+	_, err := r.meta.Get(metaKey("seeding", hash), &s)
+	return s, err
+}
+
+func (r *torrentRepositoryImpl) SetSeedingState(hash metainfo.Hash, s SeedingState) error {
+	return r.meta.Set(metaKey("seeding", hash), s)
+}
+
+// labelsIndexKey stores list of torrents with labels
+const labelsIndexKey = "labels-index"
+
+func (r *torrentRepositoryImpl) Labels(hash metainfo.Hash) (Labels, error) {
+	var l Labels
+	_, err := r.meta.Get(metaKey("labels", hash), &l)
+	return l, err
+}
+
+// SetLabels stores torrent labels, empty labels are deleted
+func (r *torrentRepositoryImpl) SetLabels(hash metainfo.Hash, l Labels) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	var index []string
+	_, err := r.meta.Get(labelsIndexKey, &index)
+	if err != nil {
+		return err
+	}
+
+	if l.IsEmpty() {
+		err = r.meta.Delete(metaKey("labels", hash))
+		if err != nil {
+			return err
+		}
+		index = slices.DeleteFunc(index, func(h string) bool {
+			return h == hash.HexString()
+		})
+	} else {
+		err = r.meta.Set(metaKey("labels", hash), l)
+		if err != nil {
+			return err
+		}
+		index = unique(append(index, hash.HexString()))
+	}
+
+	return r.meta.Set(labelsIndexKey, index)
+}
+
+func (r *torrentRepositoryImpl) ListLabels() (map[metainfo.Hash]Labels, error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	var index []string
+	_, err := r.meta.Get(labelsIndexKey, &index)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[metainfo.Hash]Labels, len(index))
+	for _, hex := range index {
+		var hash metainfo.Hash
+		if err := hash.FromHexString(hex); err != nil {
+			return nil, err
+		}
+
+		l, err := r.Labels(hash)
+		if err != nil {
+			return nil, err
+		}
+		out[hash] = l
+	}
+
+	return out, nil
+}
+
 func unique[C comparable](intSlice []C) []C {
 	keys := make(map[C]bool)
 	list := []C{}
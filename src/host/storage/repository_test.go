@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/philippgille/gokv/badgerdb"
+	"github.com/philippgille/gokv/encoding"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrackerOverridesApply(t *testing.T) {
+	require := require.New(t)
+
+	al := metainfo.AnnounceList{
+		{"udp://a", "udp://b"},
+		{"udp://c"},
+	}
+
+	o := TrackerOverrides{
+		Added:   []string{"udp://a", "http://d"},
+		Removed: []string{"udp://b", "udp://c"},
+	}
+
+	require.Equal(metainfo.AnnounceList{
+		{"udp://a"},
+		{"http://d"},
+	}, o.Apply(al))
+
+	require.Equal(al, TrackerOverrides{}.Apply(al))
+}
+
+func TestLabels(t *testing.T) {
+	require := require.New(t)
+
+	rep, err := NewTorrentMetaRepository(t.TempDir(), nil)
+	require.NoError(err)
+
+	a := metainfo.Hash{1}
+	b := metainfo.Hash{2}
+	la := Labels{Tags: []string{"music"}, Category: "audio", Note: "flac"}
+
+	require.NoError(rep.SetLabels(a, la))
+	require.NoError(rep.SetLabels(b, Labels{Tags: []string{"video"}}))
+
+	l, err := rep.Labels(a)
+	require.NoError(err)
+	require.Equal(la, l)
+
+	all, err := rep.ListLabels()
+	require.NoError(err)
+	require.Len(all, 2)
+	require.Equal(la, all[a])
+
+	require.NoError(rep.SetLabels(b, Labels{}))
+	all, err = rep.ListLabels()
+	require.NoError(err)
+	require.Equal(map[metainfo.Hash]Labels{a: la}, all)
+}
+
+func TestExcludedFiles(t *testing.T) {
+	require := require.New(t)
+
+	cfg := torrent.NewDefaultClientConfig()
+	cfg.DataDir = t.TempDir()
+	cfg.ListenPort = 0
+	cfg.NoDHT = true
+	cfg.DisableTrackers = true
+	c, err := torrent.NewClient(cfg)
+	require.NoError(err)
+	defer c.Close()
+
+	dir := filepath.Join(t.TempDir(), "t")
+	require.NoError(os.MkdirAll(dir, 0o777))
+	require.NoError(os.WriteFile(filepath.Join(dir, "a"), []byte("data a"), 0o666))
+	require.NoError(os.WriteFile(filepath.Join(dir, "b"), []byte("data b"), 0o666))
+	info := metainfo.Info{PieceLength: 16 * 1024}
+	require.NoError(info.BuildFromFilePath(dir))
+	infoBytes, err := bencode.Marshal(info)
+	require.NoError(err)
+	to, _, err := c.AddTorrentSpec(&torrent.TorrentSpec{
+		InfoHash:  metainfo.HashBytes(infoBytes),
+		InfoBytes: infoBytes,
+	})
+	require.NoError(err)
+	hash := to.InfoHash()
+	a, b := to.Files()[0], to.Files()[1]
+
+	rep, err := NewTorrentMetaRepository(t.TempDir(), nil)
+	require.NoError(err)
+
+	require.NoError(rep.ExcludeFile(a))
+	require.NoError(rep.ExcludeFile(b))
+	// excluding file twice doesn't duplicate it
+	require.NoError(rep.ExcludeFile(a))
+
+	files, err := rep.ExcludedFiles(hash)
+	require.NoError(err)
+	require.ElementsMatch([]string{a.Path(), b.Path()}, files)
+	all, err := rep.ListExcluded()
+	require.NoError(err)
+	require.Len(all, 1)
+	require.ElementsMatch([]string{a.Path(), b.Path()}, all[hash])
+
+	require.NoError(rep.RestoreFile(hash, a.Path()))
+	require.ErrorIs(rep.RestoreFile(hash, a.Path()), ErrNotFound)
+	require.ErrorIs(rep.RestoreFile(metainfo.Hash{1}, a.Path()), ErrNotFound)
+	all, err = rep.ListExcluded()
+	require.NoError(err)
+	require.Equal(map[metainfo.Hash][]string{hash: {b.Path()}}, all)
+
+	// torrent without excluded files is removed from the list
+	require.NoError(rep.RestoreFile(hash, b.Path()))
+	files, err = rep.ExcludedFiles(hash)
+	require.NoError(err)
+	require.Empty(files)
+	all, err = rep.ListExcluded()
+	require.NoError(err)
+	require.Empty(all)
+
+	require.NoError(rep.ExcludeFile(b))
+	all, err = rep.ListExcluded()
+	require.NoError(err)
+	require.Equal(map[metainfo.Hash][]string{hash: {b.Path()}}, all)
+}
+
+func TestExcludedFilesWithoutIndex(t *testing.T) {
+	require := require.New(t)
+
+	metaDir := t.TempDir()
+	hash := metainfo.Hash{1}
+
+	// files excluded before the index existed
+	store, err := badgerdb.NewStore(badgerdb.Options{
+		Dir:   filepath.Join(metaDir, "excluded-files"),
+		Codec: encoding.JSON,
+	})
+	require.NoError(err)
+	require.NoError(store.Set(hash.AsString(), []string{"a", "b"}))
+	require.NoError(store.Close())
+
+	rep, err := NewTorrentMetaRepository(metaDir, nil)
+	require.NoError(err)
+
+	// torrent is indexed when its excluded files are read on load
+	all, err := rep.ListExcluded()
+	require.NoError(err)
+	require.Empty(all)
+	files, err := rep.ExcludedFiles(hash)
+	require.NoError(err)
+	require.Equal([]string{"a", "b"}, files)
+	all, err = rep.ListExcluded()
+	require.NoError(err)
+	require.Equal(map[metainfo.Hash][]string{hash: {"a", "b"}}, all)
+
+	require.NoError(rep.RestoreFile(hash, "a"))
+	all, err = rep.ListExcluded()
+	require.NoError(err)
+	require.Equal(map[metainfo.Hash][]string{hash: {"b"}}, all)
+}
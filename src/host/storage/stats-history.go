@@ -0,0 +1,233 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// HistoryResolution is a time span of a single stored statistics point
+const HistoryResolution = 5 * time.Minute
+
+// GlobalHistoryKey stores counters summed over all torrents
+const GlobalHistoryKey = "global"
+
+type HistoryPoint struct {
+	Time time.Time `json:"time"`
+	// bytes transferred during point time span
+	DownloadedBytes int64 `json:"downloadedBytes"`
+	UploadedBytes   int64 `json:"uploadedBytes"`
+	// bytes transferred since torrent was added
+	TotalDownloadedBytes int64   `json:"totalDownloadedBytes"`
+	TotalUploadedBytes   int64   `json:"totalUploadedBytes"`
+	Ratio                float64 `json:"ratio"`
+}
+
+type historyTotals struct {
+	Downloaded int64 `json:"d"`
+	Uploaded   int64 `json:"u"`
+}
+
+// StatsHistory persists cumulative transfer counters with HistoryResolution
+type StatsHistory struct {
+	mu     sync.Mutex
+	db     *badger.DB
+	totals map[string]*historyTotals
+}
+
+func NewStatsHistory(dir string) (*StatsHistory, error) {
+	opts := badger.
+		DefaultOptions(dir).
+		WithLogger(badgerSlog{slog: slog.With("component", "stats-history")})
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StatsHistory{
+		db:     db,
+		totals: map[string]*historyTotals{},
+	}, nil
+}
+
+func historyKey(key string, t time.Time) []byte {
+	return historyKeyAt(key, t.Truncate(HistoryResolution).Unix())
+}
+
+// historyKeyAt returns key of a point at unix time without truncation
+func historyKeyAt(key string, unix int64) []byte {
+	out := make([]byte, 0, len(key)+1+8)
+	out = append(out, key...)
+	out = append(out, '/')
+	return binary.BigEndian.AppendUint64(out, uint64(unix))
+}
+
+// readTotals decodes stored point of the iterator
+func readTotals(item *badger.Item) (*historyTotals, error) {
+	t := &historyTotals{}
+	err := item.Value(func(val []byte) error {
+		return json.Unmarshal(val, t)
+	})
+	return t, err
+}
+
+func historyPrefix(key string) []byte {
+	return append([]byte(key), '/')
+}
+
+// lastTotals must be called with lock held
+func (h *StatsHistory) lastTotals(key string) (*historyTotals, error) {
+	if t, ok := h.totals[key]; ok {
+		return t, nil
+	}
+
+	t := &historyTotals{}
+	err := h.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Reverse = true
+		opts.Prefix = historyPrefix(key)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		// reverse iteration seeks to the largest key less or equal than given
+		it.Seek(append(historyPrefix(key), 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff))
+		if !it.Valid() {
+			return nil
+		}
+
+		last, err := readTotals(it.Item())
+		if err != nil {
+			return err
+		}
+		t = last
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	h.totals[key] = t
+	return t, nil
+}
+
+// Add appends transferred bytes to stored counters of the key
+func (h *StatsHistory) Add(key string, now time.Time, downloaded, uploaded int64) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	t, err := h.lastTotals(key)
+	if err != nil {
+		return err
+	}
+
+	t.Downloaded += downloaded
+	t.Uploaded += uploaded
+
+	val, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	return h.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(historyKey(key, now), val)
+	})
+}
+
+// Totals returns cumulative counters of the key
+func (h *StatsHistory) Totals(key string) (downloaded, uploaded int64, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	t, err := h.lastTotals(key)
+	if err != nil {
+		return 0, 0, err
+	}
+	return t.Downloaded, t.Uploaded, nil
+}
+
+// Query returns stored points of the key in time range [from, to]
+func (h *StatsHistory) Query(key string, from, to time.Time) ([]HistoryPoint, error) {
+	// first unix second in range, points are stored with second precision
+	first := from.Unix()
+	if from.Nanosecond() > 0 {
+		first++
+	}
+
+	out := []HistoryPoint{}
+	err := h.db.View(func(txn *badger.Txn) error {
+		// first point delta is calculated from the last point before range,
+		// there may be no points for a long time, e.g. while tstor was stopped
+		prev, err := h.pointBefore(txn, key, first)
+		if err != nil {
+			return err
+		}
+
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = historyPrefix(key)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(historyKeyAt(key, first)); it.Valid(); it.Next() {
+			item := it.Item()
+			k := item.Key()
+			ts := time.Unix(int64(binary.BigEndian.Uint64(k[len(k)-8:])), 0)
+			if ts.After(to) {
+				break
+			}
+
+			t, err := readTotals(item)
+			if err != nil {
+				return err
+			}
+
+			p := HistoryPoint{
+				Time:                 ts,
+				DownloadedBytes:      t.Downloaded,
+				UploadedBytes:        t.Uploaded,
+				TotalDownloadedBytes: t.Downloaded,
+				TotalUploadedBytes:   t.Uploaded,
+			}
+			if prev != nil {
+				p.DownloadedBytes -= prev.Downloaded
+				p.UploadedBytes -= prev.Uploaded
+			}
+			if t.Downloaded > 0 {
+				p.Ratio = float64(t.Uploaded) / float64(t.Downloaded)
+			}
+			out = append(out, p)
+
+			prev = t
+		}
+		return nil
+	})
+
+	return out, err
+}
+
+// pointBefore returns the last stored point of the key before unix time, nil if there is none
+func (h *StatsHistory) pointBefore(txn *badger.Txn, key string, unix int64) (*historyTotals, error) {
+	if unix <= 0 {
+		return nil, nil
+	}
+
+	opts := badger.DefaultIteratorOptions
+	opts.Reverse = true
+	opts.Prefix = historyPrefix(key)
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	// reverse iteration seeks to the largest key less or equal than given
+	it.Seek(historyKeyAt(key, unix-1))
+	if !it.Valid() {
+		return nil, nil
+	}
+	return readTotals(it.Item())
+}
+
+func (h *StatsHistory) Close() error {
+	return h.db.Close()
+}
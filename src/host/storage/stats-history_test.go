@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsHistoryPersistence(t *testing.T) {
+	require := require.New(t)
+
+	dir := t.TempDir()
+	start := time.Now().Truncate(HistoryResolution)
+
+	h, err := NewStatsHistory(dir)
+	require.NoError(err)
+
+	require.NoError(h.Add("a", start, 100, 10))
+	require.NoError(h.Add("a", start.Add(HistoryResolution), 50, 40))
+	require.NoError(h.Close())
+
+	h, err = NewStatsHistory(dir)
+	require.NoError(err)
+	defer h.Close()
+
+	d, u, err := h.Totals("a")
+	require.NoError(err)
+	require.Equal(int64(150), d)
+	require.Equal(int64(50), u)
+
+	require.NoError(h.Add("a", start.Add(2*HistoryResolution), 50, 50))
+
+	points, err := h.Query("a", start.Add(HistoryResolution), start.Add(2*HistoryResolution))
+	require.NoError(err)
+	require.Len(points, 2)
+	require.Equal(int64(50), points[0].DownloadedBytes)
+	require.Equal(int64(40), points[0].UploadedBytes)
+	require.Equal(int64(200), points[1].TotalDownloadedBytes)
+	require.Equal(int64(100), points[1].TotalUploadedBytes)
+	require.Equal(0.5, points[1].Ratio)
+
+	points, err = h.Query("b", start, start.Add(2*HistoryResolution))
+	require.NoError(err)
+	require.Empty(points)
+}
+
+func TestStatsHistoryGap(t *testing.T) {
+	require := require.New(t)
+
+	start := time.Now().Truncate(HistoryResolution)
+
+	h, err := NewStatsHistory(t.TempDir())
+	require.NoError(err)
+	defer h.Close()
+
+	// no points were stored for a day, e.g. while tstor was stopped
+	require.NoError(h.Add("a", start.Add(-24*time.Hour), 1000, 100))
+	require.NoError(h.Add("a", start, 10, 5))
+	require.NoError(h.Add("a", start.Add(HistoryResolution), 20, 0))
+
+	points, err := h.Query("a", start, start.Add(HistoryResolution))
+	require.NoError(err)
+	require.Len(points, 2)
+	require.Equal(int64(10), points[0].DownloadedBytes)
+	require.Equal(int64(5), points[0].UploadedBytes)
+	require.Equal(int64(1010), points[0].TotalDownloadedBytes)
+	require.Equal(int64(20), points[1].DownloadedBytes)
+
+	// range starting inside of a point time span doesn't include it
+	points, err = h.Query("a", start.Add(time.Second), start.Add(HistoryResolution))
+	require.NoError(err)
+	require.Len(points, 1)
+	require.Equal(int64(20), points[0].DownloadedBytes)
+}
@@ -39,19 +39,30 @@ func SetupStorage(cfg config.TorrentClient) (storage.ClientImplCloser, storage.P
 	// rp := storage.NewResourcePieces(fc.AsResourceProvider())
 	// st := &stc{rp}
 
-	// filesDir := filepath.Join(cfg.DataFolder, "files")
-	// if err := os.MkdirAll(filesDir, 0744); err != nil {
-	// 	return nil, nil, fmt.Errorf("error creating piece completion folder: %w", err)
-	// }
-
-	//st := NewFileStorage(filesDir, pc)
+	switch cfg.Storage {
+	case "", "mmap":
+		piecesDir := filepath.Join(cfg.DataFolder, "pieces")
+		if err := os.MkdirAll(piecesDir, 0744); err != nil {
+			return nil, nil, fmt.Errorf("error creating piece completion folder: %w", err)
+		}
 
-	piecesDir := filepath.Join(cfg.DataFolder, "pieces")
-	if err := os.MkdirAll(piecesDir, 0744); err != nil {
-		return nil, nil, fmt.Errorf("error creating piece completion folder: %w", err)
-	}
+		return storage.NewMMapWithCompletion(piecesDir, pc), pc, nil
+	case "files":
+		layout := FileLayout(cfg.FilesLayout)
+		if layout == "" {
+			layout = FileLayoutNameHash
+		}
+		if !layout.Valid() {
+			return nil, nil, fmt.Errorf("unknown files layout: %s", cfg.FilesLayout)
+		}
 
-	st := storage.NewMMapWithCompletion(piecesDir, pc)
+		filesDir := filepath.Join(cfg.DataFolder, "files")
+		if err := os.MkdirAll(filesDir, 0744); err != nil {
+			return nil, nil, fmt.Errorf("error creating files folder: %w", err)
+		}
 
-	return st, pc, nil
+		return NewFileStorage(filesDir, layout, pc), pc, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown storage: %s", cfg.Storage)
+	}
 }
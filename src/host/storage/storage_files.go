@@ -5,9 +5,9 @@ import (
 	"io"
 	"log"
 	"os"
-	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/anacrolix/missinggo"
 	"github.com/anacrolix/torrent"
@@ -22,35 +22,115 @@ type FileStorageDeleter interface {
 	DeleteFile(file *torrent.File) error
 }
 
+// FileLayout defines directories torrents are stored in
+type FileLayout string
+
+const (
+	// FileLayoutName stores torrent in a directory named after torrent, torrents with the same name share it
+	FileLayoutName FileLayout = "name"
+	// FileLayoutInfoHash stores torrent in a directory named by infohash
+	FileLayoutInfoHash FileLayout = "infohash"
+	// FileLayoutNameHash stores torrent in a directory named after torrent with a short infohash suffix
+	FileLayoutNameHash FileLayout = "name-hash"
+)
+
+func (l FileLayout) Valid() bool {
+	switch l {
+	case FileLayoutName, FileLayoutInfoHash, FileLayoutNameHash:
+		return true
+	}
+	return false
+}
+
+// verifyMarker is created in torrent directory when its data was moved from another layout,
+// torrent pieces are verified again while it exists
+const verifyMarker = ".tstor-verify"
+
 // NewFileStorage creates a new ClientImplCloser that stores files using the OS native filesystem.
-func NewFileStorage(baseDir string, pc storage.PieceCompletion) FileStorageDeleter {
-	return &FileStorage{baseDir: baseDir, pieceCompletion: pc}
+// Data of torrents stored with FileLayoutName is moved to directories of other layouts when torrent is opened.
+func NewFileStorage(baseDir string, layout FileLayout, pc storage.PieceCompletion) FileStorageDeleter {
+	return &FileStorage{
+		baseDir:         baseDir,
+		layout:          layout,
+		pieceCompletion: pc,
+		torrents:        map[metainfo.Hash]*fileTorrentImpl{},
+		contentHashes:   map[string]contentHash{},
+		files:           newFilePool(defaultFileHandles),
+	}
 }
 
 // File-based storage for torrents, that isn't yet bound to a particular torrent.
 type FileStorage struct {
 	baseDir         string
+	layout          FileLayout
 	pieceCompletion storage.PieceCompletion
+
+	mu sync.Mutex
+	// opened torrents, used to find files duplicated across torrents
+	torrents      map[metainfo.Hash]*fileTorrentImpl
+	contentHashes map[string]contentHash
+
+	// files opened for torrents data I/O
+	files *filePool
 }
 
+var _ Deduplicator = (*FileStorage)(nil)
+
 func (me *FileStorage) Close() error {
+	me.files.close()
 	return me.pieceCompletion.Close()
 }
 
-func (me *FileStorage) torrentDir(info *metainfo.Info, infoHash metainfo.Hash) string {
-	return filepath.Join(me.baseDir, info.Name)
+func (me *FileStorage) torrentDir(info *metainfo.Info, infoHash metainfo.Hash, layout FileLayout) string {
+	switch layout {
+	case FileLayoutInfoHash:
+		return filepath.Join(me.baseDir, infoHash.HexString())
+	case FileLayoutNameHash:
+		return filepath.Join(me.baseDir, info.Name+" ["+infoHash.HexString()[:8]+"]")
+	default:
+		return filepath.Join(me.baseDir, info.Name)
+	}
+}
+
+// filePath returns OS path of torrent file, single file torrents are stored
+// in torrent directory in all layouts except FileLayoutName
+func (me *FileStorage) filePath(info *metainfo.Info, infoHash metainfo.Hash, layout FileLayout, file metainfo.FileInfo) string {
+	dir := me.torrentDir(info, infoHash, layout)
+	if len(file.Path) == 0 && layout != FileLayoutName {
+		return filepath.Join(dir, info.Name)
+	}
+	return filepath.Join(dir, filepath.Join(file.Path...))
+}
+
+// DiskPather is implemented by storages keeping torrent files on disk as is
+type DiskPather interface {
+	// DiskPath returns path of complete torrent file on disk
+	DiskPath(file *torrent.File) (string, bool)
 }
 
-func (me *FileStorage) filePath(file metainfo.FileInfo) string {
-	return filepath.Join(file.Path...)
+var _ DiskPather = (*FileStorage)(nil)
+
+func (fs *FileStorage) DiskPath(file *torrent.File) (string, bool) {
+	info := file.Torrent().Info()
+	infoHash := file.Torrent().InfoHash()
+	if info == nil || file.Length() == 0 {
+		return "", false
+	}
+	if !fs.piecesComplete(infoHash, file.BeginPieceIndex(), file.EndPieceIndex()) {
+		return "", false
+	}
+
+	p := fs.filePath(info, infoHash, fs.layout, file.FileInfo())
+	if !fileHasLength(p, file.Length()) {
+		return "", false
+	}
+	return p, true
 }
 
 func (fs *FileStorage) DeleteFile(file *torrent.File) error {
 	info := file.Torrent().Info()
 	infoHash := file.Torrent().InfoHash()
-	torrentDir := fs.torrentDir(info, infoHash)
-	relFilePath := fs.filePath(file.FileInfo())
-	filePath := path.Join(torrentDir, relFilePath)
+	filePath := fs.filePath(info, infoHash, fs.layout, file.FileInfo())
 	for i := file.BeginPieceIndex(); i < file.EndPieceIndex(); i++ {
 		pk := metainfo.PieceKey{InfoHash: infoHash, Index: i}
 		err := fs.pieceCompletion.Set(pk, false)
@@ -58,43 +138,130 @@ func (fs *FileStorage) DeleteFile(file *torrent.File) error {
 			return err
 		}
 	}
+	fs.files.invalidate(filePath)
 	return os.Remove(filePath)
 }
 
-func (fs FileStorage) OpenTorrent(info *metainfo.Info, infoHash metainfo.Hash) (storage.TorrentImpl, error) {
-	dir := fs.torrentDir(info, infoHash)
+func (fs *FileStorage) OpenTorrent(info *metainfo.Info, infoHash metainfo.Hash) (storage.TorrentImpl, error) {
+	if err := fs.checkPaths(info, infoHash); err != nil {
+		return storage.TorrentImpl{}, err
+	}
+	dir := fs.torrentDir(info, infoHash, fs.layout)
 	upvertedFiles := info.UpvertedFiles()
 	files := make([]file, 0, len(upvertedFiles))
-	for i, fileInfo := range upvertedFiles {
-		filePath := filepath.Join(dir, fs.filePath(fileInfo))
-		if !isSubFilepath(dir, filePath) {
-			return storage.TorrentImpl{}, fmt.Errorf("file %v: path %q is not sub path of %q", i, filePath, fs.baseDir)
-		}
-
-		f := file{
-			path:   filePath,
+	for _, fileInfo := range upvertedFiles {
+		files = append(files, file{
+			path:   fs.filePath(info, infoHash, fs.layout, fileInfo),
 			length: fileInfo.Length,
+		})
+	}
+
+	if fs.layout != FileLayoutName {
+		if err := fs.migrate(info, infoHash, files); err != nil {
+			return storage.TorrentImpl{}, fmt.Errorf("migrating torrent data: %w", err)
 		}
+	}
+
+	for _, f := range files {
 		if f.length == 0 {
 			err := CreateNativeZeroLengthFile(f.path)
 			if err != nil {
 				return storage.TorrentImpl{}, fmt.Errorf("creating zero length file: %w", err)
 			}
 		}
-		files = append(files, f)
 	}
+
 	t := &fileTorrentImpl{
+		storage:        fs,
+		info:           info,
+		dir:            dir,
 		files:          files,
 		segmentLocater: segments.NewIndex(common.LengthIterFromUpvertedFiles(upvertedFiles)),
 		infoHash:       infoHash,
 		completion:     fs.pieceCompletion,
 	}
+	if _, err := os.Stat(filepath.Join(dir, verifyMarker)); err == nil {
+		t.unverified = make(map[int]bool, info.NumPieces())
+		for i := 0; i < info.NumPieces(); i++ {
+			t.unverified[i] = true
+		}
+	}
+
+	fs.mu.Lock()
+	fs.torrents[infoHash] = t
+	fs.mu.Unlock()
+
 	return storage.TorrentImpl{
 		Piece: t.Piece,
 		Close: t.Close,
 	}, nil
 }
 
+// migrate moves files of torrent stored with FileLayoutName into its directory. Directory of
+// FileLayoutName can be shared by torrents with the same name, so moved data is verified again.
+func (fs *FileStorage) migrate(info *metainfo.Info, infoHash metainfo.Hash, files []file) error {
+	legacyDir := fs.torrentDir(info, infoHash, FileLayoutName)
+	dir := fs.torrentDir(info, infoHash, fs.layout)
+	if legacyDir == dir || !isSubFilepath(fs.baseDir, legacyDir) || legacyDir == fs.baseDir {
+		return nil
+	}
+
+	markerCreated := false
+	for i, fi := range info.UpvertedFiles() {
+		legacyPath := fs.filePath(info, infoHash, FileLayoutName, fi)
+		if !isSubFilepath(legacyDir, legacyPath) {
+			continue
+		}
+		st, err := os.Lstat(legacyPath)
+		if err != nil || !st.Mode().IsRegular() {
+			continue
+		}
+		if _, err := os.Lstat(files[i].path); err == nil {
+			continue
+		}
+
+		if !markerCreated {
+			// marker is created before moving data, so interrupted migration is verified too
+			if err := os.MkdirAll(dir, 0o777); err != nil {
+				return err
+			}
+			if err := os.WriteFile(filepath.Join(dir, verifyMarker), nil, 0o666); err != nil {
+				return err
+			}
+			markerCreated = true
+		}
+
+		if err := os.MkdirAll(filepath.Dir(files[i].path), 0o777); err != nil {
+			return err
+		}
+		if err := os.Rename(legacyPath, files[i].path); err != nil {
+			return err
+		}
+		log.Printf("moved %q to %q", legacyPath, files[i].path)
+	}
+
+	if markerCreated {
+		removeEmptyDirs(legacyDir)
+	}
+
+	return nil
+}
+
+// removeEmptyDirs removes dir and its subdirectories if they contain no files
+func removeEmptyDirs(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			removeEmptyDirs(filepath.Join(dir, e.Name()))
+		}
+	}
+	// fails if directory is not empty
+	_ = os.Remove(dir)
+}
+
 type file struct {
 	// The safe, OS-local file path.
 	path   string
@@ -102,10 +269,59 @@ type file struct {
 }
 
 type fileTorrentImpl struct {
+	storage        *FileStorage
+	info           *metainfo.Info
+	dir            string
 	files          []file
 	segmentLocater segments.Index
 	infoHash       metainfo.Hash
 	completion     storage.PieceCompletion
+
+	unverifiedMu sync.Mutex
+	// pieces of data moved from another layout which must be verified by client,
+	// nil if all pieces are verified
+	unverified map[int]bool
+
+	// linkMu is held for writing while files are replaced with links to their duplicates,
+	// so no piece write is in progress
+	linkMu sync.RWMutex
+	// linked are pieces which data was linked from a complete duplicate file, their writes are dropped,
+	// so chunks still arriving for them don't modify the shared copy
+	linked map[int]bool
+}
+
+// setLinked marks pieces data linked from a duplicate, linkMu must be held
+func (fts *fileTorrentImpl) setLinked(pieces []int) {
+	if fts.linked == nil {
+		fts.linked = map[int]bool{}
+	}
+	for _, p := range pieces {
+		fts.linked[p] = true
+	}
+}
+
+func (fts *fileTorrentImpl) isUnverified(piece int) bool {
+	fts.unverifiedMu.Lock()
+	defer fts.unverifiedMu.Unlock()
+
+	return fts.unverified[piece]
+}
+
+// setVerified removes verify marker when all pieces are verified
+func (fts *fileTorrentImpl) setVerified(piece int) {
+	fts.unverifiedMu.Lock()
+	defer fts.unverifiedMu.Unlock()
+
+	if fts.unverified == nil {
+		return
+	}
+	delete(fts.unverified, piece)
+	if len(fts.unverified) == 0 {
+		fts.unverified = nil
+		if err := os.Remove(filepath.Join(fts.dir, verifyMarker)); err != nil && !os.IsNotExist(err) {
+			log.Printf("error removing verify marker: %s", err)
+		}
+	}
 }
 
 func (fts *fileTorrentImpl) Piece(p metainfo.Piece) storage.PieceImpl {
@@ -115,12 +331,43 @@ func (fts *fileTorrentImpl) Piece(p metainfo.Piece) storage.PieceImpl {
 	return &filePieceImpl{
 		fileTorrentImpl: fts,
 		p:               p,
-		WriterAt:        missinggo.NewSectionWriter(_io, p.Offset(), p.Length()),
-		ReaderAt:        io.NewSectionReader(_io, p.Offset(), p.Length()),
+		WriterAt: &pieceWriter{
+			fts:   fts,
+			index: p.Index(),
+			w:     missinggo.NewSectionWriter(_io, p.Offset(), p.Length()),
+		},
+		ReaderAt: io.NewSectionReader(_io, p.Offset(), p.Length()),
+	}
+}
+
+// pieceWriter drops writes of pieces linked from duplicate files
+type pieceWriter struct {
+	fts   *fileTorrentImpl
+	index int
+	w     io.WriterAt
+}
+
+func (pw *pieceWriter) WriteAt(p []byte, off int64) (int, error) {
+	pw.fts.linkMu.RLock()
+	defer pw.fts.linkMu.RUnlock()
+
+	if pw.fts.linked[pw.index] {
+		// data is already verified
+		return len(p), nil
 	}
+	return pw.w.WriteAt(p, off)
 }
 
 func (fs *fileTorrentImpl) Close() error {
+	fs.storage.mu.Lock()
+	defer fs.storage.mu.Unlock()
+
+	if fs.storage.torrents[fs.infoHash] == fs {
+		delete(fs.storage.torrents, fs.infoHash)
+	}
+	for _, f := range fs.files {
+		fs.storage.files.invalidate(f.path)
+	}
 	return nil
 }
 
@@ -146,7 +393,7 @@ type fileTorrentImplIO struct {
 
 // Returns EOF on short or missing file.
 func (fst *fileTorrentImplIO) readFileAt(file file, b []byte, off int64) (n int, err error) {
-	f, err := os.Open(file.path)
+	f, err := fst.fts.storage.files.get(file.path, false)
 	if os.IsNotExist(err) {
 		// File missing is treated the same as a short file.
 		err = io.EOF
@@ -155,7 +402,7 @@ func (fst *fileTorrentImplIO) readFileAt(file file, b []byte, off int64) (n int,
 	if err != nil {
 		return
 	}
-	defer f.Close()
+	defer fst.fts.storage.files.release(f)
 	// Limit the read to within the expected bounds of this file.
 	if int64(len(b)) > file.length-off {
 		b = b[:file.length-off]
@@ -196,20 +443,16 @@ func (fst fileTorrentImplIO) WriteAt(p []byte, off int64) (n int, err error) {
 	fst.fts.segmentLocater.Locate(
 		segments.Extent{Start: off, Length: int64(len(p))},
 		func(i int, e segments.Extent) bool {
-			name := fst.fts.files[i].path
-			err = os.MkdirAll(filepath.Dir(name), 0o777)
-			if err != nil {
-				return false
-			}
-			var f *os.File
-			f, err = os.OpenFile(name, os.O_WRONLY|os.O_CREATE, 0o666)
+			pool := fst.fts.storage.files
+			var f *pooledFile
+			f, err = pool.get(fst.fts.files[i].path, true)
 			if err != nil {
 				return false
 			}
 			var n1 int
 			n1, err = f.WriteAt(p[:e.Length], e.Start)
 			// log.Printf("%v %v wrote %v: %v", i, e, n1, err)
-			closeErr := f.Close()
+			closeErr := pool.release(f)
 			n += n1
 			p = p[n1:]
 			if err == nil {
@@ -238,6 +481,11 @@ func (me *filePieceImpl) pieceKey() metainfo.PieceKey {
 }
 
 func (fs *filePieceImpl) Completion() storage.Completion {
+	if fs.isUnverified(fs.p.Index()) {
+		// unknown completion makes client verify the piece
+		return storage.Completion{Ok: false}
+	}
+
 	c, err := fs.completion.Get(fs.pieceKey())
 	if err != nil {
 		log.Printf("error getting piece completion: %s", err)
@@ -267,11 +515,24 @@ func (fs *filePieceImpl) Completion() storage.Completion {
 }
 
 func (fs *filePieceImpl) MarkComplete() error {
-	return fs.completion.Set(fs.pieceKey(), true)
+	if err := fs.completion.Set(fs.pieceKey(), true); err != nil {
+		return err
+	}
+	fs.setVerified(fs.p.Index())
+	return nil
 }
 
 func (fs *filePieceImpl) MarkNotComplete() error {
-	return fs.completion.Set(fs.pieceKey(), false)
+	if err := fs.completion.Set(fs.pieceKey(), false); err != nil {
+		return err
+	}
+	fs.setVerified(fs.p.Index())
+
+	// failed verification of linked data downloads it again
+	fs.linkMu.Lock()
+	delete(fs.linked, fs.p.Index())
+	fs.linkMu.Unlock()
+	return nil
 }
 
 type requiredLength struct {
@@ -279,6 +540,29 @@ type requiredLength struct {
 	length    int64
 }
 
+// checkPaths checks torrent files are inside torrent directory, so crafted file paths can't overwrite
+// data of other torrents. Single file torrents stored with FileLayoutName are the torrent directory path itself.
+func (fs *FileStorage) checkPaths(info *metainfo.Info, infoHash metainfo.Hash) error {
+	dir := fs.torrentDir(info, infoHash, fs.layout)
+	if !isSubFilepath(fs.baseDir, dir) || dir == fs.baseDir {
+		return fmt.Errorf("torrent directory %q is not sub path of %q", dir, fs.baseDir)
+	}
+
+	for i, fi := range info.UpvertedFiles() {
+		p := fs.filePath(info, infoHash, fs.layout, fi)
+		if len(fi.Path) == 0 && fs.layout == FileLayoutName {
+			if p != dir {
+				return fmt.Errorf("file %v: path %q is not torrent path %q", i, p, dir)
+			}
+			continue
+		}
+		if !isSubFilepath(dir, p) || p == dir {
+			return fmt.Errorf("file %v: path %q is not sub path of %q", i, p, dir)
+		}
+	}
+	return nil
+}
+
 func isSubFilepath(base, sub string) bool {
 	rel, err := filepath.Rel(base, sub)
 	if err != nil {
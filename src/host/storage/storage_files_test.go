@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anacrolix/torrent/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStorageMigrate(t *testing.T) {
+	require := require.New(t)
+
+	dataA := bytes.Repeat([]byte("a"), 40*1024)
+	dataB := bytes.Repeat([]byte("b"), 40*1024)
+	infoA, hashA := buildTestInfo(t, "same", "data.bin", dataA)
+	infoB, hashB := buildTestInfo(t, "same", "data.bin", dataB)
+
+	baseDir := t.TempDir()
+	pc := storage.NewMapPieceCompletion()
+
+	legacy := NewFileStorage(baseDir, FileLayoutName, pc)
+	ta, err := legacy.OpenTorrent(infoA, hashA)
+	require.NoError(err)
+	for i := 0; i < infoA.NumPieces(); i++ {
+		p := infoA.Piece(i)
+		_, err := ta.Piece(p).WriteAt(dataA[p.Offset():p.Offset()+p.Length()], 0)
+		require.NoError(err)
+		require.NoError(ta.Piece(p).MarkComplete())
+	}
+	require.FileExists(filepath.Join(baseDir, "same", "data.bin"))
+
+	fs := NewFileStorage(baseDir, FileLayoutInfoHash, pc).(*FileStorage)
+	ta, err = fs.OpenTorrent(infoA, hashA)
+	require.NoError(err)
+
+	dir := filepath.Join(baseDir, hashA.HexString())
+	require.FileExists(filepath.Join(dir, "data.bin"))
+	require.FileExists(filepath.Join(dir, verifyMarker))
+	require.NoDirExists(filepath.Join(baseDir, "same"))
+
+	// moved data is verified by client again
+	for i := 0; i < infoA.NumPieces(); i++ {
+		p := ta.Piece(infoA.Piece(i))
+		require.False(p.Completion().Ok)
+		require.NoError(p.MarkComplete())
+		require.True(p.Completion().Complete)
+	}
+	require.NoFileExists(filepath.Join(dir, verifyMarker))
+
+	// torrent with the same name is stored separately
+	tb, err := fs.OpenTorrent(infoB, hashB)
+	require.NoError(err)
+	p := infoB.Piece(0)
+	_, err = tb.Piece(p).WriteAt(dataB[:p.Length()], 0)
+	require.NoError(err)
+
+	b, err := os.ReadFile(filepath.Join(dir, "data.bin"))
+	require.NoError(err)
+	require.Equal(dataA, b)
+	require.FileExists(filepath.Join(baseDir, hashB.HexString(), "data.bin"))
+}
+
+func TestFileStorageTraversal(t *testing.T) {
+	require := require.New(t)
+
+	data := bytes.Repeat([]byte("x"), 1024)
+	single, singleHash := buildTestInfo(t, "single.bin", "single.bin", data)
+	single.Files = nil
+	single.Name = "single.bin"
+	single.Length = int64(len(data))
+
+	for _, layout := range []FileLayout{FileLayoutName, FileLayoutInfoHash, FileLayoutNameHash} {
+		fs := NewFileStorage(t.TempDir(), layout, storage.NewMapPieceCompletion()).(*FileStorage)
+
+		info, hash := buildTestInfo(t, "evil", "data.bin", data)
+		info.Files[0].Path = []string{"..", "Other [abcd1234]", "x"}
+		_, err := fs.OpenTorrent(info, hash)
+		require.Error(err, layout)
+
+		info, hash = buildTestInfo(t, "evil", "data.bin", data)
+		info.Files[0].Path = []string{"sub", "..", "..", "x"}
+		_, err = fs.OpenTorrent(info, hash)
+		require.Error(err, layout)
+
+		info, hash = buildTestInfo(t, "evil", "data.bin", data)
+		info.Name = ".."
+		_, err = fs.OpenTorrent(info, hash)
+		// other layouts add infohash to directory name
+		if layout == FileLayoutName {
+			require.Error(err, layout)
+		}
+
+		// single file torrents are stored at torrent directory path in name layout
+		_, err = fs.OpenTorrent(single, singleHash)
+		require.NoError(err, layout)
+	}
+}
+
+func benchmarkFileStorageRead(b *testing.B, handles int) {
+	data := bytes.Repeat([]byte("tstor"), 1024*1024)
+	info, hash := buildTestInfo(b, "bench", "data.bin", data)
+
+	fs := NewFileStorage(b.TempDir(), FileLayoutInfoHash, storage.NewMapPieceCompletion()).(*FileStorage)
+	fs.files = newFilePool(handles)
+	defer fs.Close()
+
+	ts, err := fs.OpenTorrent(info, hash)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < info.NumPieces(); i++ {
+		p := info.Piece(i)
+		if _, err := ts.Piece(p).WriteAt(data[p.Offset():p.Offset()+p.Length()], 0); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	buf := make([]byte, info.PieceLength)
+	b.SetBytes(info.PieceLength)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p := info.Piece(i % info.NumPieces())
+		if _, err := ts.Piece(p).ReadAt(buf[:p.Length()], 0); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFileStorageRead(b *testing.B) {
+	b.Run("pooled", func(b *testing.B) { benchmarkFileStorageRead(b, defaultFileHandles) })
+	b.Run("unpooled", func(b *testing.B) { benchmarkFileStorageRead(b, 0) })
+}
@@ -3,6 +3,7 @@ package storage
 import (
 	"bytes"
 	"encoding/gob"
+	"fmt"
 	"time"
 
 	dlog "git.kmsign.ru/royalcat/tstor/src/log"
@@ -19,6 +20,11 @@ type FileItemStore struct {
 }
 
 func NewFileItemStore(path string, itemsTTL time.Duration) (*FileItemStore, error) {
+	// badger expires entries with non positive ttl immediately
+	if itemsTTL <= 0 {
+		return nil, fmt.Errorf("invalid DHT items expiry: %s, must be positive", itemsTTL)
+	}
+
 	l := log.Logger.With().Str("component", "item-store").Logger()
 
 	opts := badger.DefaultOptions(path).
@@ -88,8 +94,9 @@ func (fis *FileItemStore) Get(t bep44.Target) (*bep44.Item, error) {
 }
 
 func (fis *FileItemStore) Del(t bep44.Target) error {
-	// ignore this
-	return nil
+	return fis.db.Update(func(tx *badger.Txn) error {
+		return tx.Delete(t[:])
+	})
 }
 
 func (fis *FileItemStore) Close() error {
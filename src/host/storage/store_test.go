@@ -0,0 +1,29 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/anacrolix/dht/v2/bep44"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileItemStoreExpiry(t *testing.T) {
+	require := require.New(t)
+
+	_, err := NewFileItemStore(t.TempDir(), 0)
+	require.Error(err)
+	_, err = NewFileItemStore(t.TempDir(), -time.Minute)
+	require.Error(err)
+
+	fis, err := NewFileItemStore(t.TempDir(), time.Hour)
+	require.NoError(err)
+	defer fis.Close()
+
+	i, err := bep44.NewItem("value", nil, 0, 0, nil)
+	require.NoError(err)
+	require.NoError(fis.Put(i))
+	got, err := fis.Get(i.Target())
+	require.NoError(err)
+	require.Equal(i.V, got.V)
+}
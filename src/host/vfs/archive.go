@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"git.kmsign.ru/royalcat/tstor/src/iio"
 	"github.com/bodgit/sevenzip"
@@ -37,16 +38,36 @@ type archive struct {
 	size int64
 
 	files func() (map[string]*archiveFile, error)
+
+	index atomic.Pointer[indexTarget]
 }
 
 func NewArchive(r iio.Reader, size int64, loader ArchiveLoader) *archive {
-	return &archive{
+	a := &archive{
 		r:    r,
 		size: size,
-		files: sync.OnceValues(func() (map[string]*archiveFile, error) {
-			return loader(r, size)
-		}),
 	}
+	a.files = sync.OnceValues(func() (map[string]*archiveFile, error) {
+		files, err := loader(r, size)
+		if err != nil {
+			return nil, err
+		}
+
+		if t := a.index.Load(); t != nil {
+			indexed := make(map[string]int64, len(files))
+			for p, f := range files {
+				indexed[p] = f.Size()
+			}
+			t.add(indexed)
+		}
+
+		return files, nil
+	})
+	return a
+}
+
+func (a *archive) setIndex(t *indexTarget) {
+	a.index.Store(t)
 }
 
 // Unlink implements Filesystem.
@@ -17,6 +17,12 @@ type File interface {
 	iio.Reader
 }
 
+// DiskFile is implemented by files stored on local disk as is, their data can be linked instead of copying
+type DiskFile interface {
+	// DiskPath returns path of the file on local disk, false if file data isn't stored as a complete file
+	DiskPath() (string, bool)
+}
+
 var ErrNotImplemented = errors.New("not implemented")
 
 type Filesystem interface {
@@ -0,0 +1,133 @@
+package vfs
+
+import (
+	"path"
+	"slices"
+	"strings"
+	"sync"
+)
+
+type IndexEntry struct {
+	// Path of the file in ResolveFS
+	Path string `json:"path"`
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	// InfoHash of torrent containing the file, empty for files outside torrents
+	InfoHash string `json:"infohash,omitempty"`
+}
+
+// Index is a filename search index of nested filesystems,
+// it is fed with file lists when torrents and archives are loaded.
+type Index struct {
+	mu sync.RWMutex
+	// entries by path of nested filesystem
+	sources map[string][]IndexEntry
+}
+
+func NewIndex() *Index {
+	return &Index{
+		sources: map[string][]IndexEntry{},
+	}
+}
+
+// set replaces indexed files of nested filesystem at source path
+func (idx *Index) set(source string, entries []IndexEntry) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.sources[source] = entries
+}
+
+// remove drops indexed files of the source and filesystems nested into it
+func (idx *Index) remove(source string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for p := range idx.sources {
+		if p == source || strings.HasPrefix(p, source+Separator) {
+			delete(idx.sources, p)
+		}
+	}
+}
+
+// Search finds files which names match the query. Query with glob metacharacters *?[ is matched
+// as glob pattern with the whole file name, other queries are matched as a substring of the name.
+// Matching is case insensitive, 0 limit means unlimited.
+func (idx *Index) Search(query string, limit int) ([]IndexEntry, error) {
+	query = strings.ToLower(query)
+	glob := strings.ContainsAny(query, "*?[")
+	if glob {
+		if _, err := path.Match(query, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	out := []IndexEntry{}
+	for _, entries := range idx.sources {
+		for _, e := range entries {
+			name := strings.ToLower(e.Name)
+			var ok bool
+			if glob {
+				ok, _ = path.Match(query, name)
+			} else {
+				ok = strings.Contains(name, query)
+			}
+			if ok {
+				out = append(out, e)
+			}
+		}
+	}
+
+	slices.SortFunc(out, func(a, b IndexEntry) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+
+	return out, nil
+}
+
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	n := 0
+	for _, entries := range idx.sources {
+		n += len(entries)
+	}
+	return n
+}
+
+// indexTarget is a place of nested filesystem in the index
+type indexTarget struct {
+	idx *Index
+	// source is a path of nested filesystem in ResolveFS
+	source   string
+	infoHash string
+}
+
+func (t *indexTarget) add(files map[string]int64) {
+	if t == nil || t.idx == nil {
+		return
+	}
+
+	entries := make([]IndexEntry, 0, len(files))
+	for p, size := range files {
+		entries = append(entries, IndexEntry{
+			Path:     path.Join(t.source, p),
+			Name:     path.Base(p),
+			Size:     size,
+			InfoHash: t.infoHash,
+		})
+	}
+	t.idx.set(t.source, entries)
+}
+
+// indexedFs is implemented by nested filesystems feeding the index
+type indexedFs interface {
+	setIndex(t *indexTarget)
+}
@@ -0,0 +1,52 @@
+package vfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndexArchive(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	zReader, size := createTestZip(require)
+	data := make([]byte, size)
+	_, err := zReader.ReadAt(data, 0)
+	require.NoError(err)
+
+	files := map[string]*MemoryFile{
+		"/dir/a.zip": NewMemoryFile("a.zip", data),
+	}
+	rfs := NewResolveFS(NewMemoryFS(files), ArchiveFactories)
+	idx := NewIndex()
+	rfs.SetIndex(idx)
+
+	_, err = rfs.ReadDir("/dir/a.zip/path/to/test/file")
+	require.NoError(err)
+
+	expected := []IndexEntry{{
+		Path: "/dir/a.zip/path/to/test/file/1.txt",
+		Name: "1.txt",
+		Size: int64(len(fileContent)),
+	}}
+
+	res, err := idx.Search("1.T", 0)
+	require.NoError(err)
+	require.Equal(expected, res)
+
+	res, err = idx.Search("*.txt", 0)
+	require.NoError(err)
+	require.Equal(expected, res)
+
+	res, err = idx.Search("*.zip", 0)
+	require.NoError(err)
+	require.Empty(res)
+
+	_, err = idx.Search("[", 0)
+	require.Error(err)
+
+	delete(files, "/dir/a.zip")
+	rfs.EvictMissing()
+	require.Equal(0, idx.Len())
+}
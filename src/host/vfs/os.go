@@ -61,6 +61,12 @@ func NewOsFile(f *os.File) *OsFile {
 }
 
 var _ File = &OsFile{}
+var _ DiskFile = &OsFile{}
+
+// DiskPath implements DiskFile.
+func (f *OsFile) DiskPath() (string, bool) {
+	return f.f.Name(), true
+}
 
 // Info implements File.
 func (f *OsFile) Info() (fs.FileInfo, error) {
@@ -135,6 +141,13 @@ func (f *LazyOsFile) open() error {
 	return nil
 }
 
+var _ DiskFile = &LazyOsFile{}
+
+// DiskPath implements DiskFile.
+func (f *LazyOsFile) DiskPath() (string, bool) {
+	return f.path, true
+}
+
 // Close implements File.
 func (f *LazyOsFile) Close() error {
 	if f.file == nil {
@@ -0,0 +1,148 @@
+package vfs
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"github.com/anacrolix/torrent"
+)
+
+// maxFileReaders limits torrent readers of one file, every reader keeps its own readahead
+const maxFileReaders = 4
+
+// readerPool serves concurrent reads of torrent file with a few readers. Every read takes
+// an idle reader positioned closest to its offset, so sequential reads keep their readahead.
+type readerPool struct {
+	file     *torrent.File
+	timeouts Timeouts
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	idle []*pooledReader
+	// total is a number of idle and busy readers
+	total  int
+	closed bool
+}
+
+type pooledReader struct {
+	r   torrent.Reader
+	pos int64
+}
+
+func newReaderPool(file *torrent.File, timeouts Timeouts) *readerPool {
+	p := &readerPool{
+		file:     file,
+		timeouts: timeouts,
+	}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// get takes idle reader closest to off, new reader is created if all are busy and limit isn't reached
+func (p *readerPool) get(off int64) (*pooledReader, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for {
+		if p.closed {
+			return nil, os.ErrClosed
+		}
+
+		if len(p.idle) > 0 {
+			best := 0
+			for i, r := range p.idle {
+				if distance(r.pos, off) < distance(p.idle[best].pos, off) {
+					best = i
+				}
+			}
+			r := p.idle[best]
+			p.idle[best] = p.idle[len(p.idle)-1]
+			p.idle = p.idle[:len(p.idle)-1]
+			return r, nil
+		}
+
+		if p.total < maxFileReaders {
+			p.total++
+			r := p.file.NewReader()
+			r.SetResponsive()
+			return &pooledReader{r: r}, nil
+		}
+
+		p.cond.Wait()
+	}
+}
+
+func (p *readerPool) put(r *pooledReader) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		p.total--
+		r.r.Close()
+		return
+	}
+	p.idle = append(p.idle, r)
+	p.cond.Signal()
+}
+
+// discard closes broken reader, so it is not used again
+func (p *readerPool) discard(r *pooledReader) {
+	r.r.Close()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.total--
+	p.cond.Signal()
+}
+
+// ReadAt reads len(b) bytes unless end of file is reached
+func (p *readerPool) ReadAt(b []byte, off int64) (int, error) {
+	r, err := p.get(off)
+	if err != nil {
+		return 0, err
+	}
+
+	if r.pos != off {
+		if _, err := r.r.Seek(off, io.SeekStart); err != nil {
+			p.discard(r)
+			return 0, err
+		}
+		r.pos = off
+	}
+
+	n, err := readAtLeast(r.r, p.timeouts, b, len(b))
+	r.pos += int64(n)
+	p.put(r)
+	return n, err
+}
+
+// Close closes idle readers, busy ones are closed when their reads finish
+func (p *readerPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+
+	var err error
+	for _, r := range p.idle {
+		if cerr := r.r.Close(); cerr != nil {
+			err = cerr
+		}
+	}
+	p.total -= len(p.idle)
+	p.idle = nil
+	p.cond.Broadcast()
+
+	return err
+}
+
+func distance(a, b int64) int64 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
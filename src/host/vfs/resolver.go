@@ -1,6 +1,7 @@
 package vfs
 
 import (
+	"errors"
 	"fmt"
 	"io/fs"
 	"path"
@@ -12,6 +13,8 @@ import (
 type ResolveFS struct {
 	rootFS   Filesystem
 	resolver *resolver
+	views    ViewsFunc
+	index    *Index
 }
 
 func NewResolveFS(rootFs Filesystem, factories map[string]FsFactory) *ResolveFS {
@@ -23,6 +26,15 @@ func NewResolveFS(rootFs Filesystem, factories map[string]FsFactory) *ResolveFS
 
 // Open implements Filesystem.
 func (r *ResolveFS) Open(filename string) (File, error) {
+	name := filename
+	filename, viewEntries, err := r.resolveView(filename)
+	if err != nil {
+		return nil, err
+	}
+	if viewEntries != nil {
+		return NewDir(name), nil
+	}
+
 	fsPath, nestedFs, nestedFsPath, err := r.resolver.resolvePath(filename, r.rootFS.Open)
 	if err != nil {
 		return nil, err
@@ -36,6 +48,14 @@ func (r *ResolveFS) Open(filename string) (File, error) {
 
 // ReadDir implements Filesystem.
 func (r *ResolveFS) ReadDir(dir string) ([]fs.DirEntry, error) {
+	dir, viewEntries, err := r.resolveView(dir)
+	if err != nil {
+		return nil, err
+	}
+	if viewEntries != nil {
+		return viewEntries, nil
+	}
+
 	fsPath, nestedFs, nestedFsPath, err := r.resolver.resolvePath(dir, r.rootFS.Open)
 	if err != nil {
 		return nil, err
@@ -48,7 +68,10 @@ func (r *ResolveFS) ReadDir(dir string) ([]fs.DirEntry, error) {
 	if err != nil {
 		return nil, err
 	}
-	out := make([]fs.DirEntry, 0, len(entries))
+	out := make([]fs.DirEntry, 0, len(entries)+1)
+	if r.views != nil && fsPath == Separator {
+		out = append(out, newDirInfo(path.Base(ViewsDir)))
+	}
 	for _, e := range entries {
 		if r.resolver.isNestedFs(e.Name()) {
 			out = append(out, newDirInfo(e.Name()))
@@ -61,6 +84,15 @@ func (r *ResolveFS) ReadDir(dir string) ([]fs.DirEntry, error) {
 
 // Stat implements Filesystem.
 func (r *ResolveFS) Stat(filename string) (fs.FileInfo, error) {
+	name := filename
+	filename, viewEntries, err := r.resolveView(filename)
+	if err != nil {
+		return nil, err
+	}
+	if viewEntries != nil {
+		return newDirInfo(path.Base(name)), nil
+	}
+
 	fsPath, nestedFs, nestedFsPath, err := r.resolver.resolvePath(filename, r.rootFS.Open)
 	if err != nil {
 		return nil, err
@@ -74,6 +106,23 @@ func (r *ResolveFS) Stat(filename string) (fs.FileInfo, error) {
 
 // Unlink implements Filesystem.
 func (r *ResolveFS) Unlink(filename string) error {
+	// views are links, removing them must not remove linked files
+	link, err := r.isViewLink(filename)
+	if err != nil {
+		return err
+	}
+	if link {
+		return ErrPermission
+	}
+
+	filename, viewEntries, err := r.resolveView(filename)
+	if err != nil {
+		return err
+	}
+	if viewEntries != nil {
+		return ErrPermission
+	}
+
 	fsPath, nestedFs, nestedFsPath, err := r.resolver.resolvePath(filename, r.rootFS.Open)
 	if err != nil {
 		return err
@@ -85,6 +134,78 @@ func (r *ResolveFS) Unlink(filename string) error {
 	return r.rootFS.Unlink(fsPath)
 }
 
+// Evict removes nested filesystem from cache, it will be created again on next access
+func (r *ResolveFS) Evict(nestedFs Filesystem) {
+	r.resolver.evict(func(_ string, fs Filesystem) bool {
+		return fs == nestedFs
+	})
+}
+
+// EvictPath removes nested filesystem created from source file at p from cache and returns it,
+// e.g. when the file is replaced
+func (r *ResolveFS) EvictPath(p string) []Filesystem {
+	p = AbsPath(strings.TrimPrefix(path.Clean(p), Separator))
+	return r.resolver.evict(func(fsPath string, _ Filesystem) bool {
+		return fsPath == p
+	})
+}
+
+// IsTrashDir reports whether path is a virtual TrashDir at the root of a torrent filesystem
+func (r *ResolveFS) IsTrashDir(p string) bool {
+	if path.Base(p) != path.Base(TrashDir) {
+		return false
+	}
+	_, nestedFs, nestedFsPath, err := r.resolver.resolvePath(p, r.rootFS.Open)
+	if err != nil {
+		return false
+	}
+	_, ok := nestedFs.(*TorrentFs)
+	return ok && nestedFsPath == TrashDir
+}
+
+// Nested returns cached nested filesystems
+func (r *ResolveFS) Nested() []Filesystem {
+	r.resolver.m.Lock()
+	defer r.resolver.m.Unlock()
+
+	out := make([]Filesystem, 0, len(r.resolver.fsmap))
+	for _, fs := range r.resolver.fsmap {
+		out = append(out, fs)
+	}
+	return out
+}
+
+// EvictMissing removes cached nested filesystems which source files no longer exist
+// and returns removed filesystems.
+func (r *ResolveFS) EvictMissing() []Filesystem {
+	var missing []string
+	for _, p := range r.resolver.nestedPaths() {
+		if _, err := r.rootFS.Stat(p); errors.Is(err, ErrNotExist) {
+			missing = append(missing, p)
+		}
+	}
+
+	if r.index != nil {
+		for _, p := range missing {
+			r.index.remove(p)
+		}
+	}
+
+	return r.resolver.evict(func(p string, _ Filesystem) bool {
+		return slices.Contains(missing, p)
+	})
+}
+
+// SetIndex makes nested filesystems feed their file lists to the search index.
+// Files stay indexed when nested filesystem is evicted until its source file is removed.
+func (r *ResolveFS) SetIndex(idx *Index) {
+	r.index = idx
+	r.resolver.setIndex(&indexTarget{
+		idx:    idx,
+		source: Separator,
+	})
+}
+
 var _ Filesystem = &ResolveFS{}
 
 type FsFactory func(f File) (Filesystem, error)
@@ -103,10 +224,45 @@ type resolver struct {
 	factories map[string]FsFactory
 	fsmap     map[string]Filesystem // filesystem cache
 	// TODO: add fsmap clean
+
+	// index receives file lists of created nested filesystems, can be nil
+	index *indexTarget
+}
+
+func (r *resolver) setIndex(t *indexTarget) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.index = t
 }
 
 type openFile func(path string) (File, error)
 
+func (r *resolver) nestedPaths() []string {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	out := make([]string, 0, len(r.fsmap))
+	for p := range r.fsmap {
+		out = append(out, p)
+	}
+	return out
+}
+
+func (r *resolver) evict(match func(path string, fs Filesystem) bool) []Filesystem {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	var out []Filesystem
+	for p, fs := range r.fsmap {
+		if match(p, fs) {
+			out = append(out, fs)
+			delete(r.fsmap, p)
+		}
+	}
+	return out
+}
+
 func (r *resolver) isNestedFs(f string) bool {
 	for ext := range r.factories {
 		if strings.HasSuffix(f, ext) {
@@ -164,33 +320,56 @@ PARTS_LOOP:
 		}
 		r.fsmap[fsPath] = nestedFs
 
+		if r.index != nil {
+			if ifs, ok := nestedFs.(indexedFs); ok {
+				ifs.setIndex(&indexTarget{
+					idx:      r.index.idx,
+					source:   path.Join(r.index.source, fsPath),
+					infoHash: r.index.infoHash,
+				})
+			}
+		}
+
 		return fsPath, nestedFs, nestedFsPath, nil
 	}
 
 }
 
 var ErrNotExist = fs.ErrNotExist
+var ErrPermission = fs.ErrPermission
 
 func getFile[F File](m map[string]F, name string) (File, error) {
-	if name == Separator {
+	f, ok, err := lookupFile(m, name)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
 		return &dir{}, nil
 	}
+	return f, nil
+}
+
+// lookupFile finds file of files list, ok is false if name is a directory
+func lookupFile[F any](m map[string]F, name string) (f F, ok bool, err error) {
+	if name == Separator {
+		return f, false, nil
+	}
 
-	f, ok := m[name]
+	f, ok = m[name]
 	if ok {
-		return f, nil
+		return f, true, nil
 	}
 
 	for p := range m {
 		if strings.HasPrefix(p, name) {
-			return &dir{}, nil
+			return f, false, nil
 		}
 	}
 
-	return nil, ErrNotExist
+	return f, false, ErrNotExist
 }
 
-func listDirFromFiles[F File](m map[string]F, name string) ([]fs.DirEntry, error) {
+func listDirFromFiles[F interface{ Size() int64 }](m map[string]F, name string) ([]fs.DirEntry, error) {
 	out := make([]fs.DirEntry, 0, len(m))
 	name = AddTrailSlash(name)
 	for p, f := range m {
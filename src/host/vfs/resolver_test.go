@@ -5,6 +5,7 @@ import (
 	"os"
 	"path"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -207,3 +208,116 @@ func TestFiles(t *testing.T) {
 		require.True(out[1].IsDir())
 	}
 }
+
+func TestResolveFSEvictMissing(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	files := map[string]*MemoryFile{
+		"/f1.test": NewMemoryFile("f1.test", nil),
+		"/f2.test": NewMemoryFile("f2.test", nil),
+	}
+	rfs := NewResolveFS(NewMemoryFS(files), map[string]FsFactory{
+		".test": func(f File) (Filesystem, error) {
+			return &DummyFs{}, nil
+		},
+	})
+
+	_, err := rfs.Stat("/f1.test/file.txt")
+	require.NoError(err)
+	_, err = rfs.Stat("/f2.test/file.txt")
+	require.NoError(err)
+	require.Len(rfs.resolver.nestedPaths(), 2)
+
+	delete(files, "/f1.test")
+
+	evicted := rfs.EvictMissing()
+	require.Len(evicted, 1)
+	require.Equal([]string{"/f2.test"}, rfs.resolver.nestedPaths())
+
+	rfs.Evict(rfs.resolver.fsmap["/f2.test"])
+	require.Empty(rfs.resolver.nestedPaths())
+
+	_, err = rfs.Stat("/f2.test/file.txt")
+	require.NoError(err)
+	require.Empty(rfs.EvictPath("/f1.test"))
+	require.Len(rfs.EvictPath("f2.test"), 1)
+	require.Empty(rfs.resolver.nestedPaths())
+}
+
+func TestResolveFSViews(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	rfs := NewResolveFS(NewMemoryFS(map[string]*MemoryFile{
+		"/movies/f1.test": NewMemoryFile("f1.test", nil),
+	}), map[string]FsFactory{
+		".test": func(f File) (Filesystem, error) {
+			return &DummyFs{}, nil
+		},
+	})
+	rfs.SetViews(func() (map[string]string, error) {
+		return map[string]string{
+			"/by-hash/abcd":       "/movies/f1.test",
+			"/by-tag/video/movie": "/movies/f1.test",
+		}, nil
+	})
+
+	entries, err := rfs.ReadDir("/")
+	require.NoError(err)
+	require.Equal(".views", entries[0].Name())
+
+	entries, err = rfs.ReadDir(ViewsDir)
+	require.NoError(err)
+	require.Len(entries, 2)
+	require.Equal("by-hash", entries[0].Name())
+	require.Equal("by-tag", entries[1].Name())
+
+	entries, err = rfs.ReadDir("/.views/by-tag/video/movie/dir/here")
+	require.NoError(err)
+	require.Len(entries, 2)
+
+	info, err := rfs.Stat("/.views/by-tag/video")
+	require.NoError(err)
+	require.True(info.IsDir())
+	require.Equal("video", info.Name())
+
+	_, err = rfs.Stat("/.views/by-tag/audio")
+	require.ErrorIs(err, ErrNotExist)
+
+	require.ErrorIs(rfs.Unlink("/.views/by-hash/abcd"), ErrPermission)
+	require.ErrorIs(rfs.Unlink("/.views/by-hash/abcd/file.txt"), ErrNotImplemented)
+	_, err = rfs.Stat("/movies/f1.test")
+	require.NoError(err)
+
+	// views share nested filesystems with original paths
+	require.Equal([]string{"/movies/f1.test"}, rfs.resolver.nestedPaths())
+
+	// paths outside of views are not normalized
+	for _, p := range []string{"", "movies/", "/movies/"} {
+		target, entries, err := rfs.resolveView(p)
+		require.NoError(err)
+		require.Nil(entries)
+		require.Equal(p, target)
+	}
+}
+
+func TestResolveFSIsTrashDir(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	to := addLocalTorrent(t, make([]byte, 1024))
+	rfs := NewResolveFS(NewMemoryFS(map[string]*MemoryFile{
+		"/a.torrent":     NewMemoryFile("a.torrent", nil),
+		"/dir/.trash/f1": NewMemoryFile("f1", nil),
+	}), map[string]FsFactory{
+		".torrent": func(f File) (Filesystem, error) {
+			return NewTorrentFs(to, newMemRepository(), Timeouts{Metadata: time.Second}), nil
+		},
+	})
+
+	require.True(rfs.IsTrashDir("/a.torrent/.trash"))
+	require.False(rfs.IsTrashDir("/a.torrent/dir/.trash"))
+	require.False(rfs.IsTrashDir("/dir/.trash"))
+	require.False(rfs.IsTrashDir("/a.torrent"))
+}
@@ -0,0 +1,42 @@
+package vfs
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrReadTimeout is matched by errors of reads not completed in time, data can be available on retry
+var ErrReadTimeout = errors.New("read timeout")
+
+type TimeoutOp string
+
+const (
+	// TimeoutMetadata is a wait for torrent info
+	TimeoutMetadata TimeoutOp = "metadata"
+	// TimeoutFirstByte is a wait for the first data of a read
+	TimeoutFirstByte TimeoutOp = "first byte"
+	// TimeoutStall is a wait for more data of a started read
+	TimeoutStall TimeoutOp = "stall"
+)
+
+// Timeouts of torrent operations, zero disables timeout
+type Timeouts struct {
+	Metadata  time.Duration
+	FirstByte time.Duration
+	Stall     time.Duration
+}
+
+// TimeoutError is returned when torrent operation times out, it matches ErrReadTimeout
+type TimeoutError struct {
+	Op      TimeoutOp
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s: waiting for %s exceeded %s", ErrReadTimeout, e.Op, e.Timeout)
+}
+
+func (e *TimeoutError) Is(target error) bool {
+	return target == ErrReadTimeout
+}
@@ -2,19 +2,21 @@ package vfs
 
 import (
 	"context"
+	"errors"
 	"io"
 	"io/fs"
+	"os"
 	"path"
 	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"git.kmsign.ru/royalcat/tstor/src/host/storage"
-	"git.kmsign.ru/royalcat/tstor/src/iio"
 	"github.com/anacrolix/missinggo/v2"
 	"github.com/anacrolix/torrent"
-	"golang.org/x/exp/maps"
+	"github.com/anacrolix/torrent/metainfo"
 )
 
 var _ Filesystem = &TorrentFs{}
@@ -24,72 +26,192 @@ type TorrentFs struct {
 	t   *torrent.Torrent
 	rep storage.TorrentsRepository
 
-	readTimeout int
+	timeouts Timeouts
+
+	// unix nano time of last filesystem or file access
+	lastAccess atomic.Int64
+	// number of open file handles, including handles of files dropped from cache
+	openFiles atomic.Int64
+	// onRead is called on every read of torrent files
+	onRead atomic.Pointer[func()]
+	// diskPath locates complete torrent files in storage
+	diskPath atomic.Pointer[func(*torrent.File) (string, bool)]
 
 	//cache
 	filesCache map[string]*torrentFile
 
+	index *indexTarget
+
 	resolver *resolver
 }
 
-func NewTorrentFs(t *torrent.Torrent, rep storage.TorrentsRepository, readTimeout int) *TorrentFs {
-	return &TorrentFs{
-		t:           t,
-		rep:         rep,
-		readTimeout: readTimeout,
-		resolver:    newResolver(ArchiveFactories),
+func NewTorrentFs(t *torrent.Torrent, rep storage.TorrentsRepository, timeouts Timeouts) *TorrentFs {
+	fs := &TorrentFs{
+		t:        t,
+		rep:      rep,
+		timeouts: timeouts,
+		resolver: newResolver(ArchiveFactories),
+	}
+	fs.touch()
+	return fs
+}
+
+func (fs *TorrentFs) InfoHash() metainfo.Hash {
+	return fs.t.InfoHash()
+}
+
+// LastAccess returns time of last access to filesystem or any of its files
+func (fs *TorrentFs) LastAccess() time.Time {
+	return time.Unix(0, fs.lastAccess.Load())
+}
+
+// OpenFiles returns number of open file handles, filesystem is in use while it's not zero
+func (fs *TorrentFs) OpenFiles() int {
+	return int(fs.openFiles.Load())
+}
+
+func (fs *TorrentFs) touch() {
+	fs.lastAccess.Store(time.Now().UnixNano())
+}
+
+// OnRead sets a callback called when data of any torrent file is read
+func (fs *TorrentFs) OnRead(f func()) {
+	fs.onRead.Store(&f)
+}
+
+func (fs *TorrentFs) fileRead() {
+	fs.touch()
+	if f := fs.onRead.Load(); f != nil && *f != nil {
+		(*f)()
+	}
+}
+
+// SetDiskPath sets a function locating torrent files data on local disk, files are not DiskFile without it
+func (fs *TorrentFs) SetDiskPath(f func(*torrent.File) (string, bool)) {
+	fs.diskPath.Store(&f)
+}
+
+func (fs *TorrentFs) fileDiskPath(file *torrent.File) (string, bool) {
+	if f := fs.diskPath.Load(); f != nil && *f != nil {
+		return (*f)(file)
 	}
+	return "", false
 }
 
+// TrashDir is a virtual directory at torrent root listing files excluded with Unlink
+const TrashDir = "/.trash"
+
 func (fs *TorrentFs) files() (map[string]*torrentFile, error) {
-	if fs.filesCache == nil {
-		fs.mu.Lock()
-		<-fs.t.GotInfo()
-		files := fs.t.Files()
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
 
-		excludedFiles, err := fs.rep.ExcludedFiles(fs.t.InfoHash())
-		if err != nil {
-			return nil, err
-		}
+	if fs.filesCache != nil {
+		return fs.filesCache, nil
+	}
 
-		fs.filesCache = make(map[string]*torrentFile)
-		for _, file := range files {
+	if err := WaitInfo(fs.t, fs.timeouts.Metadata); err != nil {
+		return nil, err
+	}
+	files := fs.t.Files()
 
-			p := file.Path()
+	excludedFiles, err := fs.rep.ExcludedFiles(fs.t.InfoHash())
+	if err != nil {
+		return nil, err
+	}
 
-			if slices.Contains(excludedFiles, p) {
-				continue
-			}
-			if strings.Contains(p, "/.pad/") {
-				continue
-			}
+	fs.filesCache = make(map[string]*torrentFile)
+	for _, file := range files {
 
-			p = AbsPath(file.Path())
+		p := file.Path()
 
-			// TODO make optional
-			// removing the torrent root directory of same name  as torrent
-			p, _ = strings.CutPrefix(p, "/"+fs.t.Name()+"/")
-			p = AbsPath(p)
+		if strings.Contains(p, "/.pad/") {
+			continue
+		}
 
-			fs.filesCache[p] = &torrentFile{
-				name:    path.Base(p),
-				timeout: fs.readTimeout,
-				file:    file,
+		p = AbsPath(file.Path())
+
+		// TODO make optional
+		// removing the torrent root directory of same name  as torrent
+		p, _ = strings.CutPrefix(p, "/"+fs.t.Name()+"/")
+		p = AbsPath(p)
+
+		if slices.Contains(excludedFiles, file.Path()) {
+			p = path.Join(TrashDir, p)
+		}
+
+		fs.filesCache[p] = &torrentFile{
+			name:     path.Base(p),
+			timeouts: fs.timeouts,
+			file:     file,
+			touch:    fs.fileRead,
+			diskPath: fs.fileDiskPath,
+			handles:  &fs.openFiles,
+		}
+	}
+
+	if fs.index != nil {
+		indexed := make(map[string]int64, len(fs.filesCache))
+		for p, f := range fs.filesCache {
+			if !isTrashPath(p) {
+				indexed[p] = f.Size()
 			}
 		}
-		fs.mu.Unlock()
+		fs.index.add(indexed)
 	}
 
 	return fs.filesCache, nil
 }
 
+// InvalidateCache drops cached file list, so changes of excluded files become visible
+func (fs *TorrentFs) InvalidateCache() {
+	fs.mu.Lock()
+	fs.filesCache = nil
+	indexed := fs.index != nil
+	fs.mu.Unlock()
+
+	// refresh search index right away, so excluded files aren't found
+	if indexed {
+		_, _ = fs.files()
+	}
+}
+
+func (fs *TorrentFs) setIndex(t *indexTarget) {
+	t = &indexTarget{
+		idx:      t.idx,
+		source:   t.source,
+		infoHash: fs.t.InfoHash().HexString(),
+	}
+
+	fs.mu.Lock()
+	fs.index = t
+	fs.mu.Unlock()
+	fs.resolver.setIndex(t)
+
+	// torrent info is already loaded, so files are indexed when torrent is added
+	_, _ = fs.files()
+}
+
+func isTrashPath(p string) bool {
+	return p == TrashDir || strings.HasPrefix(p, TrashDir+Separator)
+}
+
 func (fs *TorrentFs) rawOpen(path string) (File, error) {
 	files, err := fs.files()
 	if err != nil {
 		return nil, err
 	}
-	file, err := getFile(files, path)
-	return file, err
+	file, ok, err := lookupFile(files, path)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return &dir{}, nil
+	}
+	// excluded files data is deleted, reading it will download it again
+	if isTrashPath(path) {
+		return nil, ErrPermission
+	}
+	return file.open(), nil
 }
 
 func (fs *TorrentFs) rawStat(filename string) (fs.FileInfo, error) {
@@ -97,11 +219,11 @@ func (fs *TorrentFs) rawStat(filename string) (fs.FileInfo, error) {
 	if err != nil {
 		return nil, err
 	}
-	file, err := getFile(files, filename)
+	file, ok, err := lookupFile(files, filename)
 	if err != nil {
 		return nil, err
 	}
-	if file.IsDir() {
+	if !ok {
 		return newDirInfo(path.Base(filename)), nil
 	} else {
 		return newFileInfo(path.Base(filename), file.Size()), nil
@@ -111,6 +233,7 @@ func (fs *TorrentFs) rawStat(filename string) (fs.FileInfo, error) {
 
 // Stat implements Filesystem.
 func (fs *TorrentFs) Stat(filename string) (fs.FileInfo, error) {
+	fs.touch()
 	if filename == Separator {
 		return newDirInfo(filename), nil
 	}
@@ -127,6 +250,7 @@ func (fs *TorrentFs) Stat(filename string) (fs.FileInfo, error) {
 }
 
 func (fs *TorrentFs) Open(filename string) (File, error) {
+	fs.touch()
 	fsPath, nestedFs, nestedFsPath, err := fs.resolver.resolvePath(filename, fs.rawOpen)
 	if err != nil {
 		return nil, err
@@ -139,6 +263,7 @@ func (fs *TorrentFs) Open(filename string) (File, error) {
 }
 
 func (fs *TorrentFs) ReadDir(name string) ([]fs.DirEntry, error) {
+	fs.touch()
 	fsPath, nestedFs, nestedFsPath, err := fs.resolver.resolvePath(name, fs.rawOpen)
 	if err != nil {
 		return nil, err
@@ -157,66 +282,42 @@ func (fs *TorrentFs) ReadDir(name string) ([]fs.DirEntry, error) {
 func (fs *TorrentFs) Unlink(name string) error {
 	name = AbsPath(name)
 
-	fs.mu.Lock()
-	defer fs.mu.Unlock()
+	if isTrashPath(name) {
+		return ErrNotImplemented
+	}
 
 	files, err := fs.files()
 	if err != nil {
 		return err
 	}
 
-	if !slices.Contains(maps.Keys(files), name) {
+	file, ok := files[name]
+	if !ok {
 		return ErrNotExist
 	}
 
-	file := files[name]
-	delete(fs.filesCache, name)
-
-	return fs.rep.ExcludeFile(file.file)
-}
-
-type reader interface {
-	iio.Reader
-	missinggo.ReadContexter
-}
-
-type readAtWrapper struct {
-	timeout int
-	mu      sync.Mutex
-
-	torrent.Reader
-	io.ReaderAt
-	io.Closer
-}
-
-func newReadAtWrapper(r torrent.Reader, timeout int) reader {
-	w := &readAtWrapper{Reader: r, timeout: timeout}
-	w.SetResponsive()
-	return w
-}
-
-func (rw *readAtWrapper) ReadAt(p []byte, off int64) (int, error) {
-	rw.mu.Lock()
-	defer rw.mu.Unlock()
-	_, err := rw.Seek(off, io.SeekStart)
+	err = fs.rep.ExcludeFile(file.file)
 	if err != nil {
-		return 0, err
+		return err
 	}
 
-	return readAtLeast(rw, rw.timeout, p, len(p))
+	fs.InvalidateCache()
+	return nil
 }
 
-func readAtLeast(r missinggo.ReadContexter, timeout int, buf []byte, min int) (n int, err error) {
+// readAtLeast waits for the first data of the read for FirstByte timeout,
+// then every next chunk of data is waited for Stall timeout
+func readAtLeast(r missinggo.ReadContexter, timeouts Timeouts, buf []byte, min int) (n int, err error) {
 	if len(buf) < min {
 		return 0, io.ErrShortBuffer
 	}
 	for n < min && err == nil {
 		var nn int
-
-		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
-		defer cancel()
-
-		nn, err = r.ReadContext(ctx, buf[n:])
+		if n == 0 {
+			nn, err = readContext(r, TimeoutFirstByte, timeouts.FirstByte, buf[n:])
+		} else {
+			nn, err = readContext(r, TimeoutStall, timeouts.Stall, buf[n:])
+		}
 		n += nn
 	}
 	if n >= min {
@@ -227,62 +328,239 @@ func readAtLeast(r missinggo.ReadContexter, timeout int, buf []byte, min int) (n
 	return
 }
 
-func (rw *readAtWrapper) Close() error {
-	rw.mu.Lock()
-	defer rw.mu.Unlock()
-	return rw.Reader.Close()
+// readContext reads with timeout, expired timeout is reported as TimeoutError
+func readContext(r missinggo.ReadContexter, op TimeoutOp, timeout time.Duration, buf []byte) (int, error) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	n, err := r.ReadContext(ctx, buf)
+	if err != nil && errors.Is(err, context.DeadlineExceeded) {
+		err = &TimeoutError{Op: op, Timeout: timeout}
+	}
+	return n, err
 }
 
-var _ File = &torrentFile{}
+// WaitInfo waits for torrent info for timeout, zero timeout waits forever
+func WaitInfo(t *torrent.Torrent, timeout time.Duration) error {
+	if timeout <= 0 {
+		<-t.GotInfo()
+		return nil
+	}
 
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-t.GotInfo():
+		return nil
+	case <-timer.C:
+		return &TimeoutError{Op: TimeoutMetadata, Timeout: timeout}
+	}
+}
+
+// torrentFile is a file of torrent shared by all its opens, data is read with handles returned by open
 type torrentFile struct {
 	name string
 
-	reader  reader
-	timeout int
+	timeouts Timeouts
 
 	file *torrent.File
+
+	// complete is set once the whole file is downloaded, then only stored completion of read pieces
+	// is checked, it is reset when a piece becomes incomplete again, e.g. after failed scrub or unlink
+	complete atomic.Bool
+
+	// mu protects refs and readers
+	mu sync.Mutex
+	// refs is a number of open handles
+	refs int
+	// readers are shared by open handles, created on first read of incomplete data
+	// and closed with the last handle
+	readers *readerPool
+
+	// touch marks filesystem as accessed, can be nil
+	touch func()
+	// diskPath locates file data on local disk, can be nil
+	diskPath func(*torrent.File) (string, bool)
+	// handles counts open handles of all files of filesystem, can be nil
+	handles *atomic.Int64
 }
 
-func (d *torrentFile) Stat() (fs.FileInfo, error) {
-	return newFileInfo(d.name, d.file.Length()), nil
+func (d *torrentFile) Size() int64 {
+	return d.file.Length()
 }
 
-func (d *torrentFile) load() {
-	if d.reader != nil {
-		return
+// open returns a new handle of the file, every handle must be closed
+func (d *torrentFile) open() *torrentFileHandle {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.refs++
+	if d.handles != nil {
+		d.handles.Add(1)
 	}
-	d.reader = newReadAtWrapper(d.file.NewReader(), d.timeout)
+	return &torrentFileHandle{f: d}
 }
 
-func (d *torrentFile) Size() int64 {
-	return d.file.Length()
+func (d *torrentFile) pool() (*readerPool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// handle was closed during read, readers aren't needed anymore
+	if d.refs == 0 {
+		return nil, os.ErrClosed
+	}
+	if d.readers == nil {
+		d.readers = newReaderPool(d.file, d.timeouts)
+	}
+	return d.readers, nil
+}
+
+// release closes shared readers when the last handle is closed
+func (d *torrentFile) release() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.refs--
+	if d.handles != nil {
+		d.handles.Add(-1)
+	}
+	if d.refs > 0 || d.readers == nil {
+		return nil
+	}
+	p := d.readers
+	d.readers = nil
+	return p.Close()
+}
+
+var _ File = &torrentFileHandle{}
+var _ DiskFile = &torrentFileHandle{}
+
+// torrentFileHandle is an open torrentFile, it has its own offset and is closed
+// without affecting other handles of the same file
+type torrentFileHandle struct {
+	f *torrentFile
+
+	closed atomic.Bool
+
+	// mu protects offset of sequential reads
+	mu     sync.Mutex
+	offset int64
+}
+
+// DiskPath implements DiskFile.
+func (d *torrentFileHandle) DiskPath() (string, bool) {
+	if d.f.diskPath == nil {
+		return "", false
+	}
+	return d.f.diskPath(d.f.file)
+}
+
+func (d *torrentFileHandle) Stat() (fs.FileInfo, error) {
+	return newFileInfo(d.f.name, d.f.file.Length()), nil
 }
 
-func (d *torrentFile) IsDir() bool {
+func (d *torrentFileHandle) Size() int64 {
+	return d.f.file.Length()
+}
+
+func (d *torrentFileHandle) IsDir() bool {
 	return false
 }
 
-func (d *torrentFile) Close() error {
-	var err error
-	if d.reader != nil {
-		err = d.reader.Close()
+func (d *torrentFileHandle) Close() error {
+	if !d.closed.CompareAndSwap(false, true) {
+		return nil
 	}
+	return d.f.release()
+}
 
-	d.reader = nil
+func (d *torrentFileHandle) Read(p []byte) (n int, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 
-	return err
+	n, err = d.ReadAt(p, d.offset)
+	d.offset += int64(n)
+	return n, err
 }
 
-func (d *torrentFile) Read(p []byte) (n int, err error) {
-	d.load()
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(d.timeout)*time.Second)
-	defer cancel()
+// ReadAt is safe for concurrent use. Complete data is read from storage directly,
+// other reads are served by a pool of torrent readers.
+func (d *torrentFileHandle) ReadAt(p []byte, off int64) (n int, err error) {
+	if d.closed.Load() {
+		return 0, os.ErrClosed
+	}
+	if d.f.touch != nil {
+		d.f.touch()
+	}
+
+	size := d.f.file.Length()
+	if off >= size {
+		return 0, io.EOF
+	}
+	end := min(off+int64(len(p)), size)
+	buf := p[:end-off]
 
-	return d.reader.ReadContext(ctx, p)
+	if ok, err := d.f.readComplete(buf, off); ok {
+		if err != nil {
+			return 0, err
+		}
+		n = len(buf)
+	} else {
+		pool, err := d.f.pool()
+		if err != nil {
+			return 0, err
+		}
+		n, err = pool.ReadAt(buf, off)
+		if err != nil {
+			return n, err
+		}
+	}
+
+	if len(buf) < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
 }
 
-func (d *torrentFile) ReadAt(p []byte, off int64) (n int, err error) {
-	d.load()
-	return d.reader.ReadAt(p, off)
+// readComplete reads data of file from storage without torrent readers
+// if the whole file is complete, false is returned otherwise.
+// File completion check takes the client lock, so it is done only until the file is complete,
+// after that completion of read pieces is checked in storage without the lock.
+func (d *torrentFile) readComplete(p []byte, off int64) (bool, error) {
+	f := d.file
+	if !d.complete.Load() {
+		if f.BytesCompleted() != f.Length() {
+			return false, nil
+		}
+		d.complete.Store(true)
+	}
+
+	t := f.Torrent()
+	pieceLength := t.Info().PieceLength
+	start := f.Offset() + off
+	end := start + int64(len(p))
+
+	for i := start / pieceLength; i*pieceLength < end; i++ {
+		pieceStart := i * pieceLength
+		from, to := max(start, pieceStart), min(end, pieceStart+pieceLength)
+		ps := t.Piece(int(i)).Storage()
+		if c := ps.Completion(); !c.Ok || !c.Complete {
+			// piece is downloaded again by torrent readers
+			d.complete.Store(false)
+			return false, nil
+		}
+		n, err := ps.ReadAt(p[from-start:to-start], from-pieceStart)
+		if n == int(to-from) {
+			continue
+		}
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return true, err
+	}
+	return true, nil
 }
@@ -1,11 +1,25 @@
 package vfs
 
 import (
+	"context"
+	"io"
+	"io/fs"
+	"math/rand"
 	"os"
+	"path/filepath"
+	"slices"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
 
+	hstorage "git.kmsign.ru/royalcat/tstor/src/host/storage"
+
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -95,10 +109,10 @@ func TestReadAtTorrent(t *testing.T) {
 	<-to.GotInfo()
 	torrFile := to.Files()[0]
 
-	tf := torrentFile{
-		file:    torrFile,
-		timeout: 500,
-	}
+	tf := (&torrentFile{
+		file:     torrFile,
+		timeouts: Timeouts{FirstByte: 500 * time.Second, Stall: 500 * time.Second},
+	}).open()
 
 	defer tf.Close()
 
@@ -114,7 +128,7 @@ func TestReadAtTorrent(t *testing.T) {
 	require.Equal([]byte{0x49, 0x44, 0x33, 0x3, 0x0}, toRead)
 }
 
-func TestReadAtWrapper(t *testing.T) {
+func TestReadAtPool(t *testing.T) {
 	t.Parallel()
 
 	require := require.New(t)
@@ -125,7 +139,7 @@ func TestReadAtWrapper(t *testing.T) {
 	<-to.GotInfo()
 	torrFile := to.Files()[0]
 
-	r := newReadAtWrapper(torrFile.NewReader(), 10)
+	r := newReaderPool(torrFile, Timeouts{FirstByte: 10 * time.Second, Stall: 10 * time.Second})
 	defer r.Close()
 
 	toRead := make([]byte, 5)
@@ -139,3 +153,429 @@ func TestReadAtWrapper(t *testing.T) {
 	require.Equal(5, n)
 	require.Equal([]byte{0x49, 0x44, 0x33, 0x3, 0x0}, toRead)
 }
+
+// chunkReader returns chunks one per read and blocks when they are over
+type chunkReader struct {
+	chunks [][]byte
+}
+
+func (r *chunkReader) ReadContext(ctx context.Context, p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}
+	n := copy(p, r.chunks[0])
+	r.chunks = r.chunks[1:]
+	return n, nil
+}
+
+func TestReadAtLeastTimeout(t *testing.T) {
+	t.Parallel()
+
+	require := require.New(t)
+
+	timeouts := Timeouts{FirstByte: 10 * time.Millisecond, Stall: 20 * time.Millisecond}
+	buf := make([]byte, 4)
+
+	_, err := readAtLeast(&chunkReader{}, timeouts, buf, len(buf))
+	require.ErrorIs(err, ErrReadTimeout)
+	var terr *TimeoutError
+	require.ErrorAs(err, &terr)
+	require.Equal(TimeoutFirstByte, terr.Op)
+
+	n, err := readAtLeast(&chunkReader{chunks: [][]byte{{1, 2}}}, timeouts, buf, len(buf))
+	require.ErrorIs(err, ErrReadTimeout)
+	require.ErrorAs(err, &terr)
+	require.Equal(TimeoutStall, terr.Op)
+	require.Equal(2, n)
+
+	n, err = readAtLeast(&chunkReader{chunks: [][]byte{{1, 2}, {3, 4}}}, timeouts, buf, len(buf))
+	require.NoError(err)
+	require.Equal(4, n)
+	require.Equal([]byte{1, 2, 3, 4}, buf)
+}
+
+// addLocalTorrent adds single file torrent with complete data stored in temporary directory
+func addLocalTorrent(t *testing.T, data []byte) *torrent.Torrent {
+	require := require.New(t)
+
+	dir := t.TempDir()
+	p := filepath.Join(dir, "data.bin")
+	require.NoError(os.WriteFile(p, data, 0644))
+
+	info := metainfo.Info{PieceLength: 16 * 1024}
+	require.NoError(info.BuildFromFilePath(p))
+	infoBytes, err := bencode.Marshal(info)
+	require.NoError(err)
+
+	st := storage.NewFileOpts(storage.NewFileClientOpts{
+		ClientBaseDir:   dir,
+		PieceCompletion: storage.NewMapPieceCompletion(),
+	})
+	to, _, err := Cli.AddTorrentSpec(&torrent.TorrentSpec{
+		InfoHash:  metainfo.HashBytes(infoBytes),
+		InfoBytes: infoBytes,
+		Storage:   st,
+	})
+	require.NoError(err)
+	t.Cleanup(func() {
+		to.Drop()
+		st.Close()
+	})
+
+	select {
+	case <-to.Complete.On():
+	case <-time.After(10 * time.Second):
+		t.Fatal("torrent data is not verified")
+	}
+	return to
+}
+
+func TestTorrentFileConcurrentReadAt(t *testing.T) {
+	t.Parallel()
+
+	data := make([]byte, 1024*1024+123)
+	rand.New(rand.NewSource(1)).Read(data)
+	to := addLocalTorrent(t, data)
+
+	tf := (&torrentFile{
+		file:     to.Files()[0],
+		timeouts: Timeouts{FirstByte: 10 * time.Second, Stall: 10 * time.Second},
+	}).open()
+	defer tf.Close()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(seed))
+			for i := 0; i < 50; i++ {
+				off := rnd.Int63n(int64(len(data)))
+				buf := make([]byte, rnd.Intn(64*1024)+1)
+
+				n, err := tf.ReadAt(buf, off)
+				want := data[off:min(off+int64(len(buf)), int64(len(data)))]
+				if len(want) < len(buf) {
+					assert.ErrorIs(t, err, io.EOF)
+				} else {
+					assert.NoError(t, err)
+				}
+				assert.Equal(t, want, buf[:n])
+			}
+		}(int64(g))
+	}
+	wg.Wait()
+
+	n, err := tf.ReadAt(make([]byte, 1), int64(len(data)))
+	require.ErrorIs(t, err, io.EOF)
+	require.Zero(t, n)
+
+	all, err := io.ReadAll(tf)
+	require.NoError(t, err)
+	require.Equal(t, data, all)
+}
+
+func TestReaderPoolConcurrent(t *testing.T) {
+	t.Parallel()
+
+	data := make([]byte, 256*1024)
+	rand.New(rand.NewSource(2)).Read(data)
+	to := addLocalTorrent(t, data)
+
+	pool := newReaderPool(to.Files()[0], Timeouts{FirstByte: 10 * time.Second, Stall: 10 * time.Second})
+
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(seed))
+			for i := 0; i < 20; i++ {
+				off := rnd.Int63n(int64(len(data)) - 1024)
+				buf := make([]byte, 1024)
+
+				n, err := pool.ReadAt(buf, off)
+				assert.NoError(t, err)
+				assert.Equal(t, data[off:off+1024], buf[:n])
+			}
+		}(int64(g))
+	}
+	wg.Wait()
+
+	pool.mu.Lock()
+	require.LessOrEqual(t, pool.total, maxFileReaders)
+	pool.mu.Unlock()
+
+	require.NoError(t, pool.Close())
+	_, err := pool.ReadAt(make([]byte, 1), 0)
+	require.ErrorIs(t, err, os.ErrClosed)
+}
+
+func TestTorrentFileHandles(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	data := make([]byte, 64*1024)
+	rand.New(rand.NewSource(3)).Read(data)
+	to := addLocalTorrent(t, data)
+
+	f := &torrentFile{
+		file:     to.Files()[0],
+		timeouts: Timeouts{FirstByte: 10 * time.Second, Stall: 10 * time.Second},
+	}
+	h1, h2 := f.open(), f.open()
+
+	// handles have their own offsets
+	buf := make([]byte, 100)
+	_, err := io.ReadFull(h1, buf)
+	require.NoError(err)
+	require.Equal(data[:100], buf)
+	_, err = io.ReadFull(h1, buf)
+	require.NoError(err)
+	require.Equal(data[100:200], buf)
+	_, err = io.ReadFull(h2, buf)
+	require.NoError(err)
+	require.Equal(data[:100], buf)
+
+	pool, err := f.pool()
+	require.NoError(err)
+
+	// closing one handle doesn't affect another
+	require.NoError(h1.Close())
+	require.NoError(h1.Close())
+	_, err = h1.ReadAt(buf, 0)
+	require.ErrorIs(err, os.ErrClosed)
+
+	_, err = pool.ReadAt(buf, 1000)
+	require.NoError(err)
+	require.Equal(data[1000:1100], buf)
+	_, err = h2.ReadAt(buf, 2000)
+	require.NoError(err)
+	require.Equal(data[2000:2100], buf)
+
+	// shared readers are closed with the last handle
+	require.NoError(h2.Close())
+	_, err = pool.ReadAt(buf, 0)
+	require.ErrorIs(err, os.ErrClosed)
+	_, err = f.pool()
+	require.ErrorIs(err, os.ErrClosed)
+
+	h3 := f.open()
+	defer h3.Close()
+	_, err = h3.ReadAt(buf, 3000)
+	require.NoError(err)
+	require.Equal(data[3000:3100], buf)
+}
+
+func TestTorrentFileConcurrentOpen(t *testing.T) {
+	t.Parallel()
+
+	data := make([]byte, 256*1024)
+	rand.New(rand.NewSource(4)).Read(data)
+	to := addLocalTorrent(t, data)
+
+	f := &torrentFile{
+		file:     to.Files()[0],
+		timeouts: Timeouts{FirstByte: 10 * time.Second, Stall: 10 * time.Second},
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(seed))
+			for i := 0; i < 20; i++ {
+				h := f.open()
+				off := rnd.Int63n(int64(len(data)) - 1024)
+				buf := make([]byte, 1024)
+
+				_, err := h.ReadAt(buf, off)
+				assert.NoError(t, err)
+				assert.Equal(t, data[off:off+1024], buf)
+
+				// reads of incomplete data go through shared readers
+				if pool, err := f.pool(); assert.NoError(t, err) {
+					_, err = pool.ReadAt(buf, off)
+					assert.NoError(t, err)
+					assert.Equal(t, data[off:off+1024], buf)
+				}
+
+				assert.NoError(t, h.Close())
+			}
+		}(int64(g))
+	}
+	wg.Wait()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	require.Zero(t, f.refs)
+	require.Nil(t, f.readers)
+}
+
+// memRepository keeps excluded files in memory, other methods aren't implemented
+type memRepository struct {
+	hstorage.TorrentsRepository
+
+	mu       sync.Mutex
+	excluded map[metainfo.Hash][]string
+}
+
+func newMemRepository() *memRepository {
+	return &memRepository{excluded: map[metainfo.Hash][]string{}}
+}
+
+func (r *memRepository) ExcludeFile(file *torrent.File) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	hash := file.Torrent().InfoHash()
+	r.excluded[hash] = append(r.excluded[hash], file.Path())
+	return nil
+}
+
+func (r *memRepository) ExcludedFiles(hash metainfo.Hash) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.excluded[hash]), nil
+}
+
+func (r *memRepository) RestoreFile(hash metainfo.Hash, path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !slices.Contains(r.excluded[hash], path) {
+		return hstorage.ErrNotFound
+	}
+	r.excluded[hash] = slices.DeleteFunc(r.excluded[hash], func(p string) bool { return p == path })
+	return nil
+}
+
+func dirNames(entries []fs.DirEntry) []string {
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func TestTorrentFsTrash(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	to := addLocalTorrent(t, make([]byte, 32*1024))
+	rep := newMemRepository()
+	tfs := NewTorrentFs(to, rep, Timeouts{Metadata: time.Second})
+
+	entries, err := tfs.ReadDir("/")
+	require.NoError(err)
+	require.Equal([]string{"data.bin"}, dirNames(entries))
+
+	// unlinked file is moved to trash
+	require.NoError(tfs.Unlink("/data.bin"))
+	require.ErrorIs(tfs.Unlink("/data.bin"), ErrNotExist)
+	entries, err = tfs.ReadDir("/")
+	require.NoError(err)
+	require.Equal([]string{".trash"}, dirNames(entries))
+	require.True(entries[0].IsDir())
+	entries, err = tfs.ReadDir(TrashDir)
+	require.NoError(err)
+	require.Equal([]string{"data.bin"}, dirNames(entries))
+
+	info, err := tfs.Stat(TrashDir + "/data.bin")
+	require.NoError(err)
+	require.Equal(int64(32*1024), info.Size())
+	_, err = tfs.Open(TrashDir + "/data.bin")
+	require.ErrorIs(err, ErrPermission)
+	require.ErrorIs(tfs.Unlink(TrashDir+"/data.bin"), ErrNotImplemented)
+
+	// restored file is back after cache invalidation
+	require.NoError(rep.RestoreFile(to.InfoHash(), to.Files()[0].Path()))
+	tfs.InvalidateCache()
+	entries, err = tfs.ReadDir("/")
+	require.NoError(err)
+	require.Equal([]string{"data.bin"}, dirNames(entries))
+	f, err := tfs.Open("/data.bin")
+	require.NoError(err)
+	require.NoError(f.Close())
+}
+
+func TestTorrentFsOpenFiles(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	to := addLocalTorrent(t, make([]byte, 32*1024))
+	tfs := NewTorrentFs(to, newMemRepository(), Timeouts{Metadata: time.Second})
+	require.Equal(0, tfs.OpenFiles())
+
+	f1, err := tfs.Open("/data.bin")
+	require.NoError(err)
+	f2, err := tfs.Open("/data.bin")
+	require.NoError(err)
+	require.Equal(2, tfs.OpenFiles())
+
+	// handles of files dropped from cache are still counted
+	tfs.InvalidateCache()
+	f3, err := tfs.Open("/data.bin")
+	require.NoError(err)
+	require.Equal(3, tfs.OpenFiles())
+
+	require.NoError(f1.Close())
+	require.NoError(f1.Close())
+	require.Equal(2, tfs.OpenFiles())
+	require.NoError(f2.Close())
+	require.NoError(f3.Close())
+	require.Equal(0, tfs.OpenFiles())
+}
+
+func TestReadComplete(t *testing.T) {
+	t.Parallel()
+	require := require.New(t)
+
+	data := make([]byte, 40*1024)
+	rand.New(rand.NewSource(4)).Read(data)
+	to := addLocalTorrent(t, data)
+
+	f := &torrentFile{file: to.Files()[0]}
+	buf := make([]byte, 20*1024)
+	ok, err := f.readComplete(buf, 10*1024)
+	require.True(ok)
+	require.NoError(err)
+	require.Equal(data[10*1024:30*1024], buf)
+	// completion is remembered
+	require.True(f.complete.Load())
+
+	// piece marked not complete, e.g. by failed scrub, isn't read from storage anymore
+	require.NoError(to.Piece(1).Storage().MarkNotComplete())
+	ok, err = f.readComplete(buf, 10*1024)
+	require.False(ok)
+	require.NoError(err)
+	require.False(f.complete.Load())
+
+	// torrent without stored data isn't read from storage
+	dir := t.TempDir()
+	p := filepath.Join(dir, "missing.bin")
+	require.NoError(os.WriteFile(p, data[:20*1024], 0644))
+	info := metainfo.Info{PieceLength: 16 * 1024}
+	require.NoError(info.BuildFromFilePath(p))
+	require.NoError(os.Remove(p))
+	infoBytes, err := bencode.Marshal(info)
+	require.NoError(err)
+	st := storage.NewFileOpts(storage.NewFileClientOpts{
+		ClientBaseDir:   dir,
+		PieceCompletion: storage.NewMapPieceCompletion(),
+	})
+	missing, _, err := Cli.AddTorrentSpec(&torrent.TorrentSpec{
+		InfoHash:  metainfo.HashBytes(infoBytes),
+		InfoBytes: infoBytes,
+		Storage:   st,
+	})
+	require.NoError(err)
+	defer st.Close()
+	defer missing.Drop()
+
+	f = &torrentFile{file: missing.Files()[0]}
+	ok, err = f.readComplete(buf[:100], 0)
+	require.False(ok)
+	require.NoError(err)
+	require.False(f.complete.Load())
+}
@@ -0,0 +1,125 @@
+package vfs
+
+import (
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+)
+
+// ViewsDir is a virtual directory at the root of ResolveFS with views of nested filesystems
+const ViewsDir = "/.views"
+
+// ViewsFunc returns links of views, keys are paths relative to ViewsDir and values are
+// paths of nested filesystem source files in root filesystem, e.g. "/by-hash/<hash>": "/movies/a.torrent".
+// Directories of views are made from links paths.
+type ViewsFunc func() (map[string]string, error)
+
+// SetViews enables ViewsDir, views are mapped onto nested filesystems without copying
+func (r *ResolveFS) SetViews(views ViewsFunc) {
+	r.views = views
+}
+
+func isViewPath(p string) bool {
+	return p == ViewsDir || strings.HasPrefix(p, ViewsDir+Separator)
+}
+
+// resolveView maps path inside ViewsDir to a path in root filesystem, other paths are returned unchanged.
+// If path is a virtual directory of views, its entries are returned instead.
+func (r *ResolveFS) resolveView(filename string) (target string, entries []fs.DirEntry, err error) {
+	if r.views == nil || !isViewPath(AbsPath(path.Clean(filename))) {
+		return filename, nil, nil
+	}
+	filename = AbsPath(path.Clean(filename))
+
+	links, err := r.views()
+	if err != nil {
+		return "", nil, err
+	}
+
+	rel := strings.TrimPrefix(filename, ViewsDir)
+	for link, target := range links {
+		if rel == link || strings.HasPrefix(rel, link+Separator) {
+			return target + strings.TrimPrefix(rel, link), nil, nil
+		}
+	}
+
+	prefix := AddTrailSlash(rel)
+	names := []string{}
+	for link := range links {
+		if after, ok := strings.CutPrefix(link, prefix); ok {
+			name, _, _ := strings.Cut(after, Separator)
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 && rel != "" {
+		return "", nil, ErrNotExist
+	}
+
+	slices.Sort(names)
+	names = slices.Compact(names)
+	entries = make([]fs.DirEntry, 0, len(names))
+	for _, name := range names {
+		target, ok := links[prefix+name]
+		if !ok || r.isNestedSource(target) {
+			entries = append(entries, newDirInfo(name))
+			continue
+		}
+
+		// links to files inside nested filesystems
+		info, err := r.Stat(target)
+		if err != nil {
+			continue
+		}
+		if info.IsDir() {
+			entries = append(entries, newDirInfo(name))
+		} else {
+			entries = append(entries, newFileInfo(name, info.Size()))
+		}
+	}
+
+	return "", entries, nil
+}
+
+// isNestedSource reports whether path is a file nested filesystem is created from,
+// it is always a directory in ResolveFS
+func (r *ResolveFS) isNestedSource(p string) bool {
+	for ext := range r.resolver.factories {
+		if strings.HasSuffix(p, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// isViewLink reports whether path is a link of views itself, not a path inside linked filesystem
+func (r *ResolveFS) isViewLink(filename string) (bool, error) {
+	filename = AbsPath(path.Clean(filename))
+	if r.views == nil || !isViewPath(filename) {
+		return false, nil
+	}
+
+	links, err := r.views()
+	if err != nil {
+		return false, err
+	}
+	_, ok := links[strings.TrimPrefix(filename, ViewsDir)]
+	return ok, nil
+}
+
+// MergeViews joins links of several views
+func MergeViews(views ...ViewsFunc) ViewsFunc {
+	return func() (map[string]string, error) {
+		out := map[string]string{}
+		for _, v := range views {
+			links, err := v()
+			if err != nil {
+				return nil, err
+			}
+			for link, target := range links {
+				out[link] = target
+			}
+		}
+		return out, nil
+	}
+}
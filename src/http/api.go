@@ -2,13 +2,19 @@ package http
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"math"
 	"net/http"
+	"net/netip"
 	"os"
+	"strconv"
+	"time"
 
 	"git.kmsign.ru/royalcat/tstor/src/host/service"
+	"git.kmsign.ru/royalcat/tstor/src/host/storage"
 	"github.com/anacrolix/missinggo/v2/filecache"
+	"github.com/anacrolix/torrent/metainfo"
 	"github.com/gin-gonic/gin"
 )
 
@@ -80,6 +86,839 @@ var apiStatusHandler = func(fc *filecache.Cache, ss *service.Stats) gin.HandlerF
 // 	}
 // }
 
+func hashParam(ctx *gin.Context) (metainfo.Hash, bool) {
+	var hash metainfo.Hash
+	if err := hash.FromHexString(ctx.Param("hash")); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return hash, false
+	}
+	return hash, true
+}
+
+var apiVerifyHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		hash, ok := hashParam(ctx)
+		if !ok {
+			return
+		}
+
+		if err := s.VerifyTorrent(hash); err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusAccepted, nil)
+	}
+}
+
+var apiVerifyAllHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if err := s.VerifyAll(); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusAccepted, nil)
+	}
+}
+
+var apiVerifyCancelHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		hash, ok := hashParam(ctx)
+		if !ok {
+			return
+		}
+
+		s.CancelVerify(hash)
+		ctx.JSON(http.StatusOK, nil)
+	}
+}
+
+var apiVerifyReportHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		hash, ok := hashParam(ctx)
+		if !ok {
+			return
+		}
+
+		r, err := s.VerifyReport(hash)
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, r)
+	}
+}
+
+var apiVerifyReportsHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, s.VerifyReports())
+	}
+}
+
+// apiVerifyEventsHandler streams verification progress as server-sent events until the check finishes
+var apiVerifyEventsHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		hash, ok := hashParam(ctx)
+		if !ok {
+			return
+		}
+
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		ctx.Stream(func(w io.Writer) bool {
+			r, err := s.VerifyReport(hash)
+			if err != nil {
+				ctx.SSEvent("error", err.Error())
+				return false
+			}
+			ctx.SSEvent("progress", r)
+			if r.State != service.VerifyRunning {
+				return false
+			}
+
+			select {
+			case <-ctx.Request.Context().Done():
+				return false
+			case <-ticker.C:
+				return true
+			}
+		})
+	}
+}
+
+var apiExcludedHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		hash, ok := hashParam(ctx)
+		if !ok {
+			return
+		}
+
+		files, err := s.ExcludedFiles(hash)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if files == nil {
+			files = []string{}
+		}
+
+		ctx.JSON(http.StatusOK, files)
+	}
+}
+
+var apiListExcludedHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		excluded, err := s.ListExcluded()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		out := make(map[string][]string, len(excluded))
+		for h, files := range excluded {
+			out[h.HexString()] = files
+		}
+
+		ctx.JSON(http.StatusOK, out)
+	}
+}
+
+var apiRestoreFileHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		hash, ok := hashParam(ctx)
+		if !ok {
+			return
+		}
+
+		var json RestoreFile
+		if err := ctx.ShouldBindJSON(&json); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := s.RestoreFile(hash, json.Path); err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, nil)
+	}
+}
+
+var apiTorrentsHandler = func(ss *service.Stats) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, ss.TorrentsStats())
+	}
+}
+
+var apiTorrentStatsHandler = func(ss *service.Stats) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		hash, ok := hashParam(ctx)
+		if !ok {
+			return
+		}
+
+		st, err := ss.Stats(hash.HexString())
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, st)
+	}
+}
+
+var apiPeersHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		hash, ok := hashParam(ctx)
+		if !ok {
+			return
+		}
+
+		peers, err := s.Peers(hash)
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, peers)
+	}
+}
+
+var apiTrackersHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		hash, ok := hashParam(ctx)
+		if !ok {
+			return
+		}
+
+		trackers, err := s.Trackers(ctx.Request.Context(), hash)
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, trackers)
+	}
+}
+
+var apiAddTrackersHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		hash, ok := hashParam(ctx)
+		if !ok {
+			return
+		}
+
+		var json TrackersAdd
+		if err := ctx.ShouldBindJSON(&json); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := s.AddTrackers(hash, json.URLs); err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, nil)
+	}
+}
+
+var apiRemoveTrackerHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		hash, ok := hashParam(ctx)
+		if !ok {
+			return
+		}
+
+		url := ctx.Query("url")
+		if url == "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "url query parameter required"})
+			return
+		}
+
+		if err := s.RemoveTracker(hash, url); err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, nil)
+	}
+}
+
+var apiBannedPeersHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, s.BannedPeers())
+	}
+}
+
+var apiBanPeerHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var json PeerBan
+		if err := ctx.ShouldBindJSON(&json); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		addr, err := netip.ParseAddr(json.Address)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := s.BanPeer(addr); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, nil)
+	}
+}
+
+var apiUnbanPeerHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		addr, err := netip.ParseAddr(ctx.Query("address"))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := s.UnbanPeer(addr); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, nil)
+	}
+}
+
+var apiBlocklistHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, s.BlocklistStats())
+	}
+}
+
+var apiReloadBlocklistHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if err := s.ReloadBlocklist(); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, s.BlocklistStats())
+	}
+}
+
+var apiDuplicatesHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		groups, err := s.Duplicates()
+		if errors.Is(err, service.ErrDedupUnsupported) {
+			ctx.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, groups)
+	}
+}
+
+var apiDeduplicateHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		n, err := s.Deduplicate()
+		if errors.Is(err, service.ErrDedupUnsupported) {
+			ctx.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, gin.H{"linkedPieces": n})
+	}
+}
+
+var apiImportHandler = func(s *service.Service, torrentsDir string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var json Import
+		if err := ctx.ShouldBindJSON(&json); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if json.Mode == "" {
+			json.Mode = string(storage.ImportCopy)
+		}
+		if !storage.ImportMode(json.Mode).Valid() {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "unknown import mode: " + json.Mode})
+			return
+		}
+
+		res, err := s.ImportTorrent(ctx, service.ImportSource{
+			Torrent: json.Torrent,
+			Magnet:  json.Magnet,
+			Dir:     json.Dir,
+			Mode:    storage.ImportMode(json.Mode),
+		}, torrentsDir)
+		if errors.Is(err, service.ErrImportUnsupported) {
+			ctx.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, res)
+	}
+}
+
+var apiExportsHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		jobs, err := s.ExportJobs()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, jobs)
+	}
+}
+
+var apiExportHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var json Export
+		if err := ctx.ShouldBindJSON(&json); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if json.Mode == "" {
+			json.Mode = string(storage.ExportCopy)
+		}
+		if !storage.ExportMode(json.Mode).Valid() {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "unknown export mode: " + json.Mode})
+			return
+		}
+
+		job, err := s.Export(json.Source, json.Target, storage.ExportMode(json.Mode))
+		if errors.Is(err, os.ErrNotExist) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, job)
+	}
+}
+
+var apiExportJobHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		job, err := s.ExportJob(ctx.Param("id"))
+		if errors.Is(err, storage.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, job)
+	}
+}
+
+var apiDeleteExportHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		err := s.DeleteExport(ctx.Param("id"))
+		if errors.Is(err, storage.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, nil)
+	}
+}
+
+// apiWatchEventsHandler streams torrent files added to or removed from data folder as server-sent events
+var apiWatchEventsHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		events, unsubscribe := s.WatchEvents()
+		defer unsubscribe()
+
+		ctx.Stream(func(w io.Writer) bool {
+			select {
+			case <-ctx.Request.Context().Done():
+				return false
+			case e := <-events:
+				ctx.SSEvent(string(e.Op), e)
+				return true
+			}
+		})
+	}
+}
+
+var apiDHTPutHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var json DHTPut
+		if err := ctx.ShouldBindJSON(&json); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		item, err := s.PutDHTItem(ctx, json.Value, json.Key, json.Salt)
+		if errors.Is(err, storage.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, item)
+	}
+}
+
+var apiDHTGetHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		item, err := s.GetDHTItem(ctx, ctx.Param("target"), ctx.Query("salt"))
+		if errors.Is(err, storage.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, item)
+	}
+}
+
+var apiDHTDeleteHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if err := s.DeleteDHTItem(ctx.Param("target")); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, nil)
+	}
+}
+
+var apiDHTKeysHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		keys, err := s.DHTKeys()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, keys)
+	}
+}
+
+var apiDHTCreateKeyHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var json DHTKeyCreate
+		if err := ctx.ShouldBindJSON(&json); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		key, err := s.CreateDHTKey(json.Name)
+		if errors.Is(err, storage.ErrKeyExists) {
+			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, key)
+	}
+}
+
+var apiDHTDeleteKeyHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		err := s.DeleteDHTKey(ctx.Param("name"))
+		if errors.Is(err, storage.ErrNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, nil)
+	}
+}
+
+var apiCategoriesHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, s.Categories())
+	}
+}
+
+var apiListLabelsHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		labels, err := s.ListLabels()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		out := make(map[string]storage.Labels, len(labels))
+		for hash, l := range labels {
+			out[hash.HexString()] = l
+		}
+
+		ctx.JSON(http.StatusOK, out)
+	}
+}
+
+var apiLabelsHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		hash, ok := hashParam(ctx)
+		if !ok {
+			return
+		}
+
+		labels, err := s.Labels(hash)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, labels)
+	}
+}
+
+var apiSetLabelsHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		hash, ok := hashParam(ctx)
+		if !ok {
+			return
+		}
+
+		var json storage.Labels
+		if err := ctx.ShouldBindJSON(&json); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		err := s.SetLabels(hash, json)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, nil)
+	}
+}
+
+var apiSearchHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		query := ctx.Query("q")
+		if query == "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "query parameter q is required"})
+			return
+		}
+
+		limit := 100
+		if l := ctx.Query("limit"); l != "" {
+			var err error
+			limit, err = strconv.Atoi(l)
+			if err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		entries, err := s.Search(query, limit)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, entries)
+	}
+}
+
+var apiQueueHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		queue, err := s.Queue()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, queue)
+	}
+}
+
+var apiSeedingPolicyHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, s.GlobalSeedingPolicy())
+	}
+}
+
+var apiSeedingStatusHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		hash, ok := hashParam(ctx)
+		if !ok {
+			return
+		}
+
+		status, err := s.SeedingStatus(hash)
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, status)
+	}
+}
+
+var apiSetSeedingHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		hash, ok := hashParam(ctx)
+		if !ok {
+			return
+		}
+
+		var json SeedingSet
+		if err := ctx.ShouldBindJSON(&json); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := s.SetSeeding(hash, json.Pinned, json.Policy); err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, nil)
+	}
+}
+
+var apiPauseHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		hash, ok := hashParam(ctx)
+		if !ok {
+			return
+		}
+
+		if err := s.PauseTorrent(hash); err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, nil)
+	}
+}
+
+var apiResumeHandler = func(s *service.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		hash, ok := hashParam(ctx)
+		if !ok {
+			return
+		}
+
+		if err := s.ResumeTorrent(hash); err != nil {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, nil)
+	}
+}
+
+// timeRangeQuery parses from and to unix timestamps, by default last day is returned
+func timeRangeQuery(ctx *gin.Context) (from, to time.Time, ok bool) {
+	to = time.Now()
+	from = to.Add(-24 * time.Hour)
+
+	if v := ctx.Query("from"); v != "" {
+		sec, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return from, to, false
+		}
+		from = time.Unix(sec, 0)
+	}
+	if v := ctx.Query("to"); v != "" {
+		sec, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return from, to, false
+		}
+		to = time.Unix(sec, 0)
+	}
+
+	return from, to, true
+}
+
+var apiHistoryHandler = func(ss *service.Stats) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		from, to, ok := timeRangeQuery(ctx)
+		if !ok {
+			return
+		}
+
+		points, err := ss.History("", from, to)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, points)
+	}
+}
+
+var apiTorrentHistoryHandler = func(ss *service.Stats) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		hash, ok := hashParam(ctx)
+		if !ok {
+			return
+		}
+		from, to, ok := timeRangeQuery(ctx)
+		if !ok {
+			return
+		}
+
+		points, err := ss.History(hash.HexString(), from, to)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, points)
+	}
+}
+
 var apiLogHandler = func(path string) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		f, err := os.Open(path)
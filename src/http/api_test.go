@@ -0,0 +1,74 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"git.kmsign.ru/royalcat/tstor/src/config"
+	"git.kmsign.ru/royalcat/tstor/src/host/service"
+	"git.kmsign.ru/royalcat/tstor/src/host/storage"
+	"git.kmsign.ru/royalcat/tstor/src/host/vfs"
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTorrentStatsHandler(t *testing.T) {
+	require := require.New(t)
+
+	ccfg := torrent.NewDefaultClientConfig()
+	ccfg.DataDir = t.TempDir()
+	ccfg.ListenPort = 0
+	ccfg.NoDHT = true
+	ccfg.DisableTrackers = true
+	c, err := torrent.NewClient(ccfg)
+	require.NoError(err)
+	t.Cleanup(func() { c.Close() })
+	rep, err := storage.NewTorrentMetaRepository(t.TempDir(), nil)
+	require.NoError(err)
+	s := service.NewService(c, rep, nil, nil, nil, nil, nil, nil, &config.TorrentClient{AddTimeout: 10})
+
+	p := filepath.Join(t.TempDir(), "data.bin")
+	require.NoError(os.WriteFile(p, []byte("stats"), 0644))
+	info := metainfo.Info{PieceLength: 16 * 1024}
+	require.NoError(info.BuildFromFilePath(p))
+	mi := metainfo.MetaInfo{}
+	mi.InfoBytes, err = bencode.Marshal(info)
+	require.NoError(err)
+	var buf bytes.Buffer
+	require.NoError(mi.Write(&buf))
+	hash := mi.HashInfoBytes()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/torrents/:hash/stats", apiTorrentStatsHandler(s.Stats()))
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/torrents/"+hash.HexString()+"/stats", nil))
+		return w
+	}
+
+	require.Equal(http.StatusNotFound, get().Code)
+
+	// loaded torrent is registered in stats
+	_, err = s.NewTorrentFs(vfs.NewMemoryFile("data.torrent", buf.Bytes()))
+	require.NoError(err)
+	w := get()
+	require.Equal(http.StatusOK, w.Code)
+	var st service.TorrentStats
+	require.NoError(json.Unmarshal(w.Body.Bytes(), &st))
+	require.Equal(hash.HexString(), st.Hash)
+	require.Equal("data.bin", st.Name)
+	require.Equal(1, st.TotalPieces)
+
+	// dropped torrent is removed from stats
+	require.NoError(s.DropTorrent(hash))
+	require.Equal(http.StatusNotFound, get().Code)
+}
@@ -3,6 +3,7 @@ package http
 import (
 	"fmt"
 	"net/http"
+	"path/filepath"
 
 	"git.kmsign.ru/royalcat/tstor"
 	"git.kmsign.ru/royalcat/tstor/src/config"
@@ -42,6 +43,64 @@ func New(fc *filecache.Cache, ss *service.Stats, s *service.Service, logPath str
 	{
 		api.GET("/log", apiLogHandler(logPath))
 		api.GET("/status", apiStatusHandler(fc, ss))
+		api.GET("/stats/history", apiHistoryHandler(ss))
+		api.GET("/torrents", apiTorrentsHandler(ss))
+		api.GET("/torrents/:hash/stats", apiTorrentStatsHandler(ss))
+		api.GET("/torrents/:hash/stats/history", apiTorrentHistoryHandler(ss))
+
+		api.GET("/verify", apiVerifyReportsHandler(s))
+		api.POST("/verify", apiVerifyAllHandler(s))
+		api.GET("/torrents/:hash/verify", apiVerifyReportHandler(s))
+		api.POST("/torrents/:hash/verify", apiVerifyHandler(s))
+		api.DELETE("/torrents/:hash/verify", apiVerifyCancelHandler(s))
+		api.GET("/torrents/:hash/verify/events", apiVerifyEventsHandler(s))
+
+		api.GET("/excluded", apiListExcludedHandler(s))
+		api.GET("/torrents/:hash/excluded", apiExcludedHandler(s))
+		api.POST("/torrents/:hash/restore", apiRestoreFileHandler(s))
+
+		api.GET("/torrents/:hash/peers", apiPeersHandler(s))
+		api.GET("/torrents/:hash/trackers", apiTrackersHandler(s))
+		api.POST("/torrents/:hash/trackers", apiAddTrackersHandler(s))
+		api.DELETE("/torrents/:hash/trackers", apiRemoveTrackerHandler(s))
+		api.GET("/queue", apiQueueHandler(s))
+		api.GET("/search", apiSearchHandler(s))
+
+		api.GET("/categories", apiCategoriesHandler(s))
+		api.GET("/labels", apiListLabelsHandler(s))
+		api.GET("/torrents/:hash/labels", apiLabelsHandler(s))
+		api.PUT("/torrents/:hash/labels", apiSetLabelsHandler(s))
+
+		api.POST("/dht/items", apiDHTPutHandler(s))
+		api.GET("/dht/items/:target", apiDHTGetHandler(s))
+		api.DELETE("/dht/items/:target", apiDHTDeleteHandler(s))
+		api.GET("/dht/keys", apiDHTKeysHandler(s))
+		api.POST("/dht/keys", apiDHTCreateKeyHandler(s))
+		api.DELETE("/dht/keys/:name", apiDHTDeleteKeyHandler(s))
+
+		api.GET("/seeding/policy", apiSeedingPolicyHandler(s))
+		api.GET("/torrents/:hash/seeding", apiSeedingStatusHandler(s))
+		api.PUT("/torrents/:hash/seeding", apiSetSeedingHandler(s))
+		api.POST("/torrents/:hash/pause", apiPauseHandler(s))
+		api.POST("/torrents/:hash/resume", apiResumeHandler(s))
+
+		api.GET("/peers/banned", apiBannedPeersHandler(s))
+		api.POST("/peers/banned", apiBanPeerHandler(s))
+		api.DELETE("/peers/banned", apiUnbanPeerHandler(s))
+
+		api.GET("/blocklist", apiBlocklistHandler(s))
+		api.POST("/blocklist/reload", apiReloadBlocklistHandler(s))
+		api.GET("/duplicates", apiDuplicatesHandler(s))
+		api.POST("/duplicates/dedup", apiDeduplicateHandler(s))
+		api.POST("/import", apiImportHandler(s, filepath.Join(cfg.DataFolder, "imported")))
+
+		api.GET("/exports", apiExportsHandler(s))
+		api.POST("/exports", apiExportHandler(s))
+		api.GET("/exports/:id", apiExportJobHandler(s))
+		api.DELETE("/exports/:id", apiDeleteExportHandler(s))
+
+		api.GET("/watch/events", apiWatchEventsHandler(s))
+
 		// api.GET("/servers", apiServersHandler(tss))
 
 		// api.GET("/routes", apiRoutesHandler(ss))
@@ -1,9 +1,56 @@
 package http
 
+import "git.kmsign.ru/royalcat/tstor/src/host/storage"
+
 type RouteAdd struct {
 	Magnet string `json:"magnet" binding:"required"`
 }
 
+type RestoreFile struct {
+	Path string `json:"path" binding:"required"`
+}
+
+type TrackersAdd struct {
+	URLs []string `json:"urls" binding:"required"`
+}
+
+type PeerBan struct {
+	Address string `json:"address" binding:"required"`
+}
+
+type SeedingSet struct {
+	Pinned bool                   `json:"pinned"`
+	Policy *storage.SeedingPolicy `json:"policy"`
+}
+
+type DHTPut struct {
+	Value string `json:"value" binding:"required"`
+	// Key is a name of stored key to publish mutable item, immutable item is published if empty
+	Key  string `json:"key"`
+	Salt string `json:"salt"`
+}
+
+type DHTKeyCreate struct {
+	Name string `json:"name" binding:"required"`
+}
+
 type Error struct {
 	Error string `json:"error"`
 }
+
+type Export struct {
+	// Source is a path of file or directory in filesystem
+	Source string `json:"source" binding:"required"`
+	// Target is a path relative to export directory, source name is used if empty
+	Target string `json:"target"`
+	Mode   string `json:"mode"`
+}
+
+type Import struct {
+	// Torrent is a content of torrent file, Magnet is used if it is empty
+	Torrent []byte `json:"torrent"`
+	Magnet  string `json:"magnet"`
+	// Dir is a local directory with downloaded data
+	Dir  string `json:"dir" binding:"required"`
+	Mode string `json:"mode"`
+}